@@ -5,17 +5,21 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/vito/bass-loop/pkg/access"
 	"github.com/vito/bass-loop/pkg/blobs"
 	"github.com/vito/bass-loop/pkg/logs"
 	"github.com/vito/bass-loop/pkg/models"
 	"github.com/vito/bass-loop/pkg/present"
+	"github.com/vito/bass-loop/pkg/session"
 	"go.uber.org/zap"
 )
 
 type Controller struct {
-	Log   *logs.Logger
-	DB    *models.Conn
-	Blobs *blobs.Bucket
+	Log     *logs.Logger
+	DB      *models.Conn
+	Blobs   *blobs.Bucket
+	Access  *access.Checker
+	Session *session.Session
 
 	*present.Workaround
 }
@@ -45,12 +49,23 @@ func (c *Controller) Index(ctx context.Context) (*Home, error) {
 		Runs: []*present.Run{},
 	}
 
+	viewer := c.Session.User
+
 	for _, r := range runs {
 		model, err := models.RunByID(ctx, c.DB, r.ID)
 		if err != nil {
 			return nil, fmt.Errorf("get run %s: %w", r.ID, err)
 		}
 
+		visible, err := c.Access.CanView(ctx, viewer, model)
+		if err != nil {
+			return nil, fmt.Errorf("check run %s: %w", r.ID, err)
+		}
+
+		if !visible {
+			continue
+		}
+
 		run, err := present.NewRun(ctx, c.DB, model)
 		if err != nil {
 			return nil, fmt.Errorf("present run: %w", err)
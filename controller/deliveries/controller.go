@@ -0,0 +1,57 @@
+package delivery
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/vito/bass-loop/pkg/access"
+	"github.com/vito/bass-loop/pkg/logs"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/present"
+	"github.com/vito/bass-loop/pkg/session"
+)
+
+type Controller struct {
+	Log     *logs.Logger
+	Conn    *models.Conn
+	Access  *access.Checker
+	Session *session.Session
+}
+
+type IndexProps struct {
+	Deliveries []*present.Delivery `json:"deliveries"`
+
+	// CSRFToken is submitted by the redeliver forms.
+	CSRFToken string `json:"csrf_token"`
+}
+
+// Index of deliveries, only shown to admins
+// GET /deliveries
+func (c *Controller) Index(ctx context.Context) (props *IndexProps, err error) {
+	if !c.Access.IsAdmin(c.Session.User) {
+		// don't reveal the page to anyone else
+		return nil, fmt.Errorf("list deliveries: %w", sql.ErrNoRows)
+	}
+
+	results, err := models.GetIndexDeliveriesResults(ctx, c.Conn)
+	if err != nil {
+		return nil, fmt.Errorf("list deliveries: %w", err)
+	}
+
+	props = &IndexProps{
+		Deliveries: []*present.Delivery{},
+		CSRFToken:  c.Session.CSRFToken(),
+	}
+
+	for _, r := range results {
+		model, err := models.DeliveryByID(ctx, c.Conn, r.ID)
+		if err != nil {
+			return nil, fmt.Errorf("get delivery %s: %w", r.ID, err)
+		}
+
+		props.Deliveries = append(props.Deliveries, present.NewDelivery(model))
+	}
+
+	return props, nil
+}
@@ -0,0 +1,55 @@
+package redeliver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/vito/bass-loop/pkg/access"
+	"github.com/vito/bass-loop/pkg/logs"
+	"github.com/vito/bass-loop/pkg/queue"
+	"github.com/vito/bass-loop/pkg/session"
+	"go.uber.org/zap"
+)
+
+type Controller struct {
+	Log     *logs.Logger
+	Queue   *queue.Queue
+	Access  *access.Checker
+	Session *session.Session
+}
+
+// Create schedules a delivery to be dispatched again from its stored payload.
+//
+// Only admins may redeliver; anyone else gets a 404.
+//
+// POST /deliveries/:delivery_id/redeliver
+func (c *Controller) Create(w http.ResponseWriter, r *http.Request) {
+	deliveryID := r.URL.Query().Get("delivery_id")
+
+	logger := c.Log.With(zap.String("delivery", deliveryID))
+
+	if !c.Access.IsAdmin(c.Session.User) {
+		logger.Warn("viewer may not redeliver")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "delivery not found")
+		return
+	}
+
+	if !c.Session.VerifyCSRF(r) {
+		logger.Warn("invalid csrf token")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintln(w, "invalid csrf token")
+		return
+	}
+
+	if err := c.Queue.Redeliver(r.Context(), deliveryID); err != nil {
+		logger.Warn("failed to redeliver", zap.Error(err))
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+
+	logger.Info("redelivering", zap.String("by", c.Session.User.Login))
+
+	http.Redirect(w, r, "/deliveries", http.StatusSeeOther)
+}
@@ -0,0 +1,96 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v43/github"
+)
+
+// RepoConfigPath is the path to a repo's Loop config.
+//
+// It is read from the repo's default branch so that it can't be changed by a
+// pull request.
+const RepoConfigPath = "bass/loop.json"
+
+// Runtime pools to use for dispatching an event.
+const (
+	// SenderRunners are the runtimes registered by the event's sender.
+	SenderRunners = "sender"
+
+	// RepoRunners are the runtimes shared with the repo.
+	RepoRunners = "repo"
+
+	// OrgRunners are the runtimes shared with the repo's org.
+	OrgRunners = "org"
+)
+
+// DefaultRunners are the runtime pools used if a repo does not configure any.
+//
+// Runtimes shared with the repo or its org are only used if the repo opts in,
+// since anyone who can send an event, e.g. by opening a pull request from a
+// fork, would otherwise be able to run their code on them.
+var DefaultRunners = []string{SenderRunners}
+
+// RepoConfig configures how Loop handles a repo's events.
+type RepoConfig struct {
+	// Runners lists the runtime pools to try, in order. The first pool with
+	// any runtimes is used.
+	//
+	// Include "repo" or "org" to fall back to runtimes shared with the repo or
+	// its org, e.g. ["sender", "repo", "org"]. These are only used for GitHub
+	// repos.
+	Runners []string `json:"runners,omitempty"`
+}
+
+func loadRepoConfig(ctx context.Context, ghClient *github.Client, repo *github.Repository) (*RepoConfig, error) {
+	config := &RepoConfig{
+		Runners: DefaultRunners,
+	}
+
+	file, _, resp, err := ghClient.Repositories.GetContents(
+		ctx,
+		repo.GetOwner().GetLogin(),
+		repo.GetName(),
+		RepoConfigPath,
+		&github.RepositoryContentGetOptions{
+			Ref: repo.GetDefaultBranch(),
+		},
+	)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return config, nil
+		}
+
+		return nil, fmt.Errorf("get %s: %w", RepoConfigPath, err)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("get content %s: %w", RepoConfigPath, err)
+	}
+
+	return parseRepoConfig([]byte(content))
+}
+
+func parseRepoConfig(content []byte) (*RepoConfig, error) {
+	config := &RepoConfig{
+		Runners: DefaultRunners,
+	}
+
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", RepoConfigPath, err)
+	}
+
+	for _, runners := range config.Runners {
+		switch runners {
+		case SenderRunners, RepoRunners, OrgRunners:
+		default:
+			return nil, fmt.Errorf("%s: unknown runners %q", RepoConfigPath, runners)
+		}
+	}
+
+	return config, nil
+}
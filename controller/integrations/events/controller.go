@@ -2,26 +2,32 @@ package events
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"strings"
 
 	"github.com/google/go-github/v43/github"
+	"github.com/vito/bass-loop/pkg/access"
 	"github.com/vito/bass-loop/pkg/bassgh"
+	"github.com/vito/bass-loop/pkg/bassgitea"
 	"github.com/vito/bass-loop/pkg/blobs"
 	"github.com/vito/bass-loop/pkg/cfg"
 	"github.com/vito/bass-loop/pkg/ghapp"
 	"github.com/vito/bass-loop/pkg/logs"
 	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/pool"
+	"github.com/vito/bass-loop/pkg/queue"
+	"github.com/vito/bass-loop/pkg/runnel"
+	"github.com/vito/bass-loop/pkg/runs"
 	"github.com/vito/bass/pkg/bass"
-	"github.com/vito/bass/pkg/proto"
-	"github.com/vito/bass/pkg/runtimes"
+	"github.com/vito/bass/pkg/cli"
+	"github.com/vito/bass/pkg/ioctx"
 	"github.com/vito/bass/pkg/zapctx"
 	"go.uber.org/zap"
-	"golang.org/x/sync/errgroup"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 type Controller struct {
@@ -30,15 +36,25 @@ type Controller struct {
 	Blobs     *blobs.Bucket
 	Config    *cfg.Config
 	Transport *ghapp.Transport
+	Streams   *runs.Streams
+	Active    *runs.Active
+	Redactor  *runs.Redactor
+	Queue     *queue.Queue
 
-	externalURL *url.URL
-	dispatches  *errgroup.Group
+	// decides who may cancel runs from their checks
+	Access *access.Checker
+
+	externalURL  *url.URL
+	policy       pool.Policy
+	integrations map[string]Integration
 }
 
 const DefaultExternalURL = "http://localhost:3000"
 const HookScript = "bass/github-hook"
 
-func Load(log *logs.Logger, config *cfg.Config, db *models.Conn, blobs *blobs.Bucket, transport *ghapp.Transport) *Controller {
+const GitHubIntegration = "github"
+
+func Load(log *logs.Logger, config *cfg.Config, db *models.Conn, blobs *blobs.Bucket, transport *ghapp.Transport, streams *runs.Streams, active *runs.Active, redactor *runs.Redactor, queue *queue.Queue, checker *access.Checker) *Controller {
 	e := config.ExternalURL
 	if e == "" {
 		e = DefaultExternalURL
@@ -50,68 +66,252 @@ func Load(log *logs.Logger, config *cfg.Config, db *models.Conn, blobs *blobs.Bu
 		panic(err)
 	}
 
-	return &Controller{
+	policy, err := pool.ParsePolicy(config.RuntimePolicy)
+	if err != nil {
+		// XXX: Controllers can't return error atm
+		panic(err)
+	}
+
+	c := &Controller{
 		Log:       log,
 		DB:        db,
 		Blobs:     blobs,
 		Config:    config,
 		Transport: transport,
+		Streams:   streams,
+		Active:    active,
+		Redactor:  redactor,
+		Queue:     queue,
+
+		Access: checker,
 
 		externalURL: externalURL,
-		dispatches:  new(errgroup.Group),
+		policy:      policy,
+	}
+
+	c.integrations = map[string]Integration{
+		GitHubIntegration: &gitHubIntegration{c},
 	}
+
+	if config.Gitea.URL != "" {
+		gitea, err := newGiteaIntegration(c)
+		if err != nil {
+			// XXX: Controllers can't return error atm
+			panic(err)
+		}
+
+		c.integrations[GiteaIntegration] = gitea
+	}
+
+	if len(config.HTTP.Secrets) > 0 {
+		h, err := newHTTPIntegration(c)
+		if err != nil {
+			// XXX: Controllers can't return error atm
+			panic(err)
+		}
+
+		c.integrations[HTTPIntegration] = h
+	}
+
+	go func() {
+		err := queue.Run(zapctx.ToContext(context.Background(), log), c.handleDelivery)
+		if err != nil {
+			log.Error("delivery queue errored", zap.Error(err))
+		}
+	}()
+
+	return c
 }
 
 func (c *Controller) Create(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Query().Get("integration_id") {
-	case "github":
-		c.handleGitHub(w, r)
+	ctx := r.Context()
+	ctx = ioctx.StderrToContext(ctx, os.Stderr)
+
+	integrationID := r.URL.Query().Get("integration_id")
+
+	logger := c.Log.With(zap.String("integration", integrationID))
+
+	integration, found := c.integrations[integrationID]
+	if !found {
+		logger.Warn("unknown integration")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "unknown integration")
+		return
+	}
+
+	webhook, err := integration.Validate(r)
+	if err != nil {
+		logger.Warn("invalid webhook", zap.Error(err))
+
+		if errors.Is(err, ErrInvalidSignature) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprintln(w, "invalid secret")
+		} else if errors.Is(err, ErrDuplicateDelivery) {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintln(w, err.Error())
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, err.Error())
+		}
+
+		return
+	}
+
+	logger = logger.With(
+		zap.String("event", webhook.Event),
+		zap.String("delivery", webhook.DeliveryID),
+	)
+	ctx = zapctx.ToContext(ctx, logger)
+
+	// dispatch again even if the delivery has been seen before
+	force := r.URL.Query().Get("force") == "1"
+
+	err = c.receive(ctx, integrationID, integration, webhook, force)
+	if err != nil {
+		logger.Error("failed to handle event", zap.Error(err))
+		cli.WriteError(ctx, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err.Error())
+		return
 	}
 }
 
-func (c *Controller) withUserPool(ctx context.Context, user *github.User) (context.Context, *runtimes.Pool, error) {
+// receive handles a webhook and enqueues it to be dispatched if the
+// integration wants it to be.
+func (c *Controller) receive(ctx context.Context, integrationID string, integration Integration, webhook Webhook, force bool) error {
 	logger := zapctx.FromContext(ctx)
 
-	rts, err := models.RuntimesByUserID(ctx, c.DB, user.GetNodeID())
+	logger.Info("handling")
+
+	dispatch, err := integration.Handle(ctx, webhook)
 	if err != nil {
-		return nil, nil, fmt.Errorf("get runtimes: %w", err)
+		return err
 	}
 
-	pool := &runtimes.Pool{}
+	if !dispatch {
+		return nil
+	}
 
-	for _, rt := range rts {
-		svc, err := models.ServiceByUserIDRuntimeNameService(ctx, c.DB, user.GetNodeID(), rt.Name, runtimes.RuntimeServiceName)
-		if err != nil {
-			logger.Error("failed to get service", zap.Error(err))
-			pool.Close()
-			return nil, nil, fmt.Errorf("get runtime service: %w", err)
+	// handle the rest async
+	enqueued, err := c.Queue.Enqueue(ctx, integrationID, webhook.Event, webhook.DeliveryID, webhook.Payload, force)
+	if err != nil {
+		return fmt.Errorf("enqueue: %w", err)
+	}
+
+	if !enqueued {
+		// webhooks are redelivered on timeouts; don't create another set of checks
+		logger.Info("ignoring duplicate delivery")
+		return nil
+	}
+
+	logger.Info("enqueued")
+
+	return nil
+}
+
+func (c *Controller) handleDelivery(ctx context.Context, delivery *models.Delivery) error {
+	// held by a hook's check rather than received from an integration
+	switch delivery.Integration {
+	case bassgh.HeldCheckIntegration:
+		return c.resumeCheck(ctx, delivery)
+	case bassgitea.HeldCheckIntegration:
+		gitea, found := c.integrations[GiteaIntegration].(*giteaIntegration)
+		if !found {
+			return fmt.Errorf("cannot resume check: %s integration is not configured", GiteaIntegration)
 		}
 
-		conn, err := grpc.Dial(svc.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		return gitea.resumeCheck(ctx, delivery)
+	}
+
+	integration, found := c.integrations[delivery.Integration]
+	if !found {
+		return fmt.Errorf("unknown integration: %s", delivery.Integration)
+	}
+
+	return integration.Dispatch(ctx, delivery)
+}
+
+// withPool loads the runtime pool for dispatching an event sent by the user
+// for the repo on the forge.
+//
+// Each of the runners in order is tried in turn, and the first with any
+// runtimes is used. Repo and org runners are skipped for repos on forges that
+// runtimes can't be shared with.
+func (c *Controller) withPool(ctx context.Context, sender *github.User, forge, repoFullName string, order []string) (context.Context, *pool.Pool, error) {
+	logger := zapctx.FromContext(ctx)
+
+	for _, runners := range order {
+		if (runners == RepoRunners || runners == OrgRunners) && !canShareRunners(forge) {
+			logger.Warn("runtimes can't be shared with repos on this forge; skipping",
+				zap.String("forge", forge),
+				zap.String("runners", runners))
+			continue
+		}
+
+		var rts []*models.Runtime
+		switch runners {
+		case SenderRunners:
+			userRts, err := models.RuntimesByUserID(ctx, c.DB, sender.GetNodeID())
+			if err != nil {
+				return nil, nil, fmt.Errorf("get runtimes: %w", err)
+			}
+
+			for _, rt := range userRts {
+				if rt.Scope == "" {
+					rts = append(rts, rt)
+				}
+			}
+		case RepoRunners:
+			var err error
+			rts, err = models.RuntimesByScope(ctx, c.DB, pool.RepoScope(repoFullName))
+			if err != nil {
+				return nil, nil, fmt.Errorf("get repo runtimes: %w", err)
+			}
+		case OrgRunners:
+			var err error
+			owner, _, _ := strings.Cut(repoFullName, "/")
+			rts, err = models.RuntimesByScope(ctx, c.DB, pool.OrgScope(owner))
+			if err != nil {
+				return nil, nil, fmt.Errorf("get org runtimes: %w", err)
+			}
+		default:
+			return nil, nil, fmt.Errorf("unknown runners: %q", runners)
+		}
+
+		if len(rts) == 0 {
+			continue
+		}
+
+		runtimePool, err := runnel.LoadPool(ctx, c.DB, c.Config.SSH.Node(), c.Config.SSH.PeerToken, c.policy, c.Active, rts)
 		if err != nil {
-			logger.Error("grpc dial failed", zap.Error(err))
-			pool.Close()
 			return nil, nil, err
 		}
 
-		assoc := runtimes.Assoc{
-			Platform: bass.Platform{
-				OS:           rt.Os,
-				Architecture: rt.Arch,
-			},
-			Runtime: &runtimes.Client{
-				Conn:          conn,
-				RuntimeClient: proto.NewRuntimeClient(conn),
-			},
-		}
+		logger.Info("using runtimes",
+			zap.String("runners", runners),
+			zap.Int("count", len(runtimePool.Runtimes)))
 
-		pool.Runtimes = append(pool.Runtimes, assoc)
+		return bass.WithRuntimePool(ctx, runtimePool), runtimePool, nil
 	}
 
-	return bass.WithRuntimePool(ctx, pool), pool, nil
+	logger.Warn("no runtimes available")
+
+	emptyPool := &pool.Pool{}
+
+	return bass.WithRuntimePool(ctx, emptyPool), emptyPool, nil
+}
+
+// canShareRunners returns true if runtimes may be shared with repos and orgs
+// on the forge.
+//
+// Only GitHub repos and orgs can be shared with, since sharing is verified
+// against GitHub collaborators and org members. A repo with the same name on
+// another forge may belong to someone else entirely.
+func canShareRunners(forge string) bool {
+	return forge == GitHubForge
 }
 
-func callHook(ctx context.Context, hookThunk bass.Thunk, client *bassgh.Client) error {
+func callHook(ctx context.Context, hookThunk bass.Thunk, module *bass.Scope) error {
 	logger := zapctx.FromContext(ctx).With(
 		zap.Stringer("thunk", hookThunk),
 	)
@@ -119,7 +319,7 @@ func callHook(ctx context.Context, hookThunk bass.Thunk, client *bassgh.Client)
 	// track thunk runs separately so we can log them later
 	ctx, runs := bass.TrackRuns(ctx)
 
-	err := bass.NewSession(newLoopScope(client)).Run(ctx, hookThunk, hookThunk.RunState(io.Discard))
+	err := bass.NewSession(newLoopScope(module)).Run(ctx, hookThunk, hookThunk.RunState(io.Discard))
 	if err != nil {
 		return fmt.Errorf("run hook thunk: %w", err)
 	}
@@ -136,6 +336,6 @@ func callHook(ctx context.Context, hookThunk bass.Thunk, client *bassgh.Client)
 	return err
 }
 
-func newLoopScope(client *bassgh.Client) *bass.Scope {
-	return bass.Bindings{"*loop*": client.Module()}.Scope(bass.Ground)
+func newLoopScope(module *bass.Scope) *bass.Scope {
+	return bass.Bindings{"*loop*": module}.Scope(bass.Ground)
 }
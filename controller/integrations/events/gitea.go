@@ -0,0 +1,429 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+	"github.com/vito/bass-loop/pkg/bassgitea"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/pool"
+	"github.com/vito/bass-loop/pkg/queue"
+	"github.com/vito/bass-loop/pkg/runnel"
+	"github.com/vito/bass/pkg/bass"
+	"github.com/vito/bass/pkg/zapctx"
+)
+
+const GiteaIntegration = "gitea"
+
+// GiteaHookScript is the path to the hook script for Gitea events.
+const GiteaHookScript = "bass/gitea-hook"
+
+// Gitea events dispatched to the hook; all others are ignored.
+const (
+	GiteaPushEvent        = "push"
+	GiteaPullRequestEvent = "pull_request"
+)
+
+// pushed to when a branch is deleted
+const nullSHA = "0000000000000000000000000000000000000000"
+
+// giteaIntegration receives webhooks from a Gitea server.
+type giteaIntegration struct {
+	c   *Controller
+	api *bassgitea.API
+}
+
+func newGiteaIntegration(c *Controller) (*giteaIntegration, error) {
+	giteaURL, err := url.Parse(c.Config.Gitea.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse gitea url: %w", err)
+	}
+
+	return &giteaIntegration{
+		c: c,
+		api: &bassgitea.API{
+			URL:   giteaURL,
+			Token: c.Config.Gitea.Token,
+		},
+	}, nil
+}
+
+func (gitea *giteaIntegration) Validate(r *http.Request) (Webhook, error) {
+	eventName := r.Header.Get("X-Gitea-Event")
+	if eventName == "" {
+		return Webhook{}, fmt.Errorf("missing event type")
+	}
+
+	deliveryID := r.Header.Get("X-Gitea-Delivery")
+	if deliveryID == "" {
+		return Webhook{}, fmt.Errorf("missing delivery id")
+	}
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("read payload: %w", err)
+	}
+
+	if err := validateHMAC(payload, r.Header.Get("X-Gitea-Signature"), gitea.c.Config.Gitea.WebhookSecret); err != nil {
+		return Webhook{}, err
+	}
+
+	return Webhook{
+		Event:      eventName,
+		DeliveryID: deliveryID,
+		Payload:    payload,
+	}, nil
+}
+
+func (gitea *giteaIntegration) Handle(ctx context.Context, webhook Webhook) (bool, error) {
+	logger := zapctx.FromContext(ctx)
+
+	switch webhook.Event {
+	case GiteaPushEvent, GiteaPullRequestEvent:
+	default:
+		logger.Info("ignoring unsupported event")
+		return false, nil
+	}
+
+	event, err := parseGiteaEvent(webhook.Payload)
+	if err != nil {
+		return false, err
+	}
+
+	if event.Sender == nil || event.Repo == nil {
+		logger.Warn("ignoring unknown event")
+		return false, nil
+	}
+
+	if event.After == nullSHA {
+		logger.Info("ignoring branch deletion")
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (gitea *giteaIntegration) Dispatch(ctx context.Context, delivery *models.Delivery) error {
+	c := gitea.c
+
+	payload, err := parseGiteaEvent(delivery.Payload)
+	if err != nil {
+		return err
+	}
+
+	// calling context is ignored; this outlives the hook handler
+	ctx = detach(ctx)
+
+	repo := payload.Repo
+	sender := payload.LoopUser()
+	event := giteaEvent{payload, gitea.api}
+
+	repoConfig, err := gitea.loadRepoConfig(ctx, repo)
+	if err != nil {
+		return fmt.Errorf("load repo config: %w", err)
+	}
+
+	ctx, runtimePool, err := c.withPool(ctx, sender, GiteaForge, repo.FullName, repoConfig.Runners)
+	if err != nil {
+		return fmt.Errorf("user %s (%s) pool: %w", sender.GetLogin(), sender.GetNodeID(), err)
+	}
+	defer runtimePool.Close()
+
+	if len(runtimePool.Runtimes) == 0 {
+		// nothing to even load the hook with; wait for a runner to show up
+		return gitea.awaitRunner(ctx, payload, delivery)
+	}
+
+	sha := payload.SHA()
+
+	return c.runHook(ctx, delivery, Hook{
+		Integration: GiteaIntegration,
+		Script:      GiteaHookScript,
+		Event:       event,
+		Sender:      sender,
+		FS: func(ref string) fs.FS {
+			return bassgitea.NewFS(ctx, gitea.api, repo, ref)
+		},
+		CloneURL: repo.CloneURL,
+		Module:   gitea.checksClient(sender, repo, repoConfig.Runners, event.Meta()).Module(),
+
+		// Gitea has no check suites, so report the hook itself as a status to
+		// show that it ran
+		Started: func(ctx context.Context, run *models.Run) error {
+			return gitea.setHookStatus(ctx, repo, sha, run, bassgitea.StatusPending, "Running hook")
+		},
+		Finished: func(ctx context.Context, run *models.Run, hookErr error) error {
+			state, description := bassgitea.StatusSuccess, "Hook succeeded"
+			if run.Cancelled == 1 {
+				state, description = bassgitea.StatusError, "Hook cancelled"
+			} else if hookErr != nil {
+				state, description = bassgitea.StatusFailure, "Hook failed"
+			}
+
+			return gitea.setHookStatus(ctx, repo, sha, run, state, description)
+		},
+	})
+}
+
+// resumeCheck resumes a check which was waiting for a runtime when the
+// process stopped.
+func (gitea *giteaIntegration) resumeCheck(ctx context.Context, delivery *models.Delivery) error {
+	var held bassgitea.HeldCheck
+	if err := json.Unmarshal(delivery.Payload, &held); err != nil {
+		return fmt.Errorf("unmarshal held check: %w", err)
+	}
+
+	ctx = detach(ctx)
+
+	client := gitea.checksClient(held.Sender, held.Repo, held.Runners, held.Meta)
+
+	return client.ResumeCheck(ctx, delivery, held)
+}
+
+// checksClient returns a client for the hook to create checks with.
+func (gitea *giteaIntegration) checksClient(sender *github.User, repo *bassgitea.Repository, runners []string, meta models.Meta) *bassgitea.Client {
+	c := gitea.c
+
+	return &bassgitea.Client{
+		ExternalURL: c.externalURL,
+		DB:          c.DB,
+		Blobs:       c.Blobs,
+		Streams:     c.Streams,
+		Active:      c.Active,
+		Redactor:    c.Redactor,
+		API:         gitea.api,
+		Sender:      sender,
+		Repo:        repo,
+		Meta:        meta,
+
+		Queue:   c.Queue,
+		Runners: runners,
+
+		RunnerTimeout: c.Config.RunnerTimeout,
+		LoadPool: func(ctx context.Context) (*pool.Pool, error) {
+			_, runtimePool, err := c.withPool(ctx, sender, GiteaForge, repo.FullName, runners)
+			return runtimePool, err
+		},
+	}
+}
+
+// awaitRunner postpones a delivery until a runner is available, setting a
+// pending status on the commit in the meantime.
+//
+// Once the runner timeout elapses the status is set to an error and the
+// delivery is abandoned.
+func (gitea *giteaIntegration) awaitRunner(ctx context.Context, payload GiteaEventPayload, delivery *models.Delivery) error {
+	logger := zapctx.FromContext(ctx)
+
+	timedOut := time.Since(delivery.CreatedAt.Time()) > gitea.c.runnerTimeout()
+
+	state, description := bassgitea.StatusPending, "Waiting for a runner"
+	if timedOut {
+		state, description = bassgitea.StatusError, "No runner available"
+	}
+
+	err := gitea.api.CreateStatus(ctx, payload.Repo, payload.SHA(), bassgitea.CommitStatus{
+		State:       state,
+		Description: description,
+		Context:     WaitingCheckName,
+	})
+	if err != nil {
+		return fmt.Errorf("create status: %w", err)
+	}
+
+	if !timedOut {
+		logger.Info("no runner available; postponing delivery")
+		return queue.Postpone(ErrNoRunner)
+	}
+
+	logger.Warn("timed out waiting for a runner")
+
+	return queue.Abandon(ErrNoRunner)
+}
+
+func (gitea *giteaIntegration) setHookStatus(ctx context.Context, repo *bassgitea.Repository, sha string, run *models.Run, state, description string) error {
+	runURL, err := gitea.c.externalURL.Parse("/runs/" + run.ID)
+	if err != nil {
+		return err
+	}
+
+	err = gitea.api.CreateStatus(ctx, repo, sha, bassgitea.CommitStatus{
+		State:       state,
+		TargetURL:   runURL.String(),
+		Description: description,
+		Context:     WaitingCheckName,
+	})
+	if err != nil {
+		return fmt.Errorf("create status: %w", err)
+	}
+
+	return nil
+}
+
+// loadRepoConfig loads the repo's config from its default branch.
+func (gitea *giteaIntegration) loadRepoConfig(ctx context.Context, repo *bassgitea.Repository) (*RepoConfig, error) {
+	content, err := gitea.api.GetRaw(ctx, repo, RepoConfigPath, repo.DefaultBranch)
+	if err != nil {
+		if errors.Is(err, bassgitea.ErrNotFound) {
+			return &RepoConfig{
+				Runners: DefaultRunners,
+			}, nil
+		}
+
+		return nil, fmt.Errorf("get %s: %w", RepoConfigPath, err)
+	}
+
+	return parseRepoConfig(content)
+}
+
+type GiteaEventPayload struct {
+	// set on pull_request events
+	Action *string `json:"action,omitempty"`
+
+	// set on push events
+	Ref   string `json:"ref,omitempty"`
+	After string `json:"after,omitempty"`
+
+	// set on pull_request events
+	PullRequest *GiteaPullRequest `json:"pull_request,omitempty"`
+
+	// set on all events
+	Repo   *bassgitea.Repository `json:"repository,omitempty"`
+	Sender *bassgitea.User       `json:"sender,omitempty"`
+}
+
+type GiteaPullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Head    struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+func parseGiteaEvent(payload []byte) (GiteaEventPayload, error) {
+	var event GiteaEventPayload
+	err := json.Unmarshal(payload, &event)
+	if err != nil {
+		return GiteaEventPayload{}, fmt.Errorf("unmarshal event: %w", err)
+	}
+
+	return event, nil
+}
+
+// LoopUser returns the Loop user for the event's sender.
+//
+// Gitea users are identified by their login, matching users authenticated
+// with an authorized_keys file so that their runtimes are used for their
+// events.
+func (event GiteaEventPayload) LoopUser() *github.User {
+	login := event.Sender.GetLogin()
+
+	return &github.User{
+		NodeID: github.String(runnel.AuthorizedKeysIDPrefix + login),
+		Login:  github.String(login),
+	}
+}
+
+func (event GiteaEventPayload) Meta() models.Meta {
+	meta := models.Meta{
+		"sender": models.Meta{
+			"login":  event.Sender.GetLogin(),
+			"action": event.Action,
+		},
+	}
+
+	if event.Repo != nil {
+		meta["repo"] = models.Meta{
+			"name":      event.Repo.Name,
+			"full_name": event.Repo.FullName,
+			"url":       event.Repo.HTMLURL,
+			"private":   event.Repo.Private,
+		}
+
+		sha := event.SHA()
+		if sha != "" {
+			meta["commit"] = models.Meta{
+				"sha": sha,
+				"url": event.Repo.HTMLURL + "/commit/" + sha,
+			}
+		}
+
+		if branch := event.Branch(); branch != "" {
+			meta["branch"] = models.Meta{
+				"name": branch,
+				"url":  event.Repo.HTMLURL + "/src/branch/" + branch,
+			}
+		}
+
+		if event.PullRequest != nil {
+			meta["pull_request"] = models.Meta{
+				"number": event.PullRequest.Number,
+				"url":    event.PullRequest.HTMLURL,
+			}
+		}
+	}
+
+	return meta
+}
+
+func (event GiteaEventPayload) SHA() string {
+	if event.PullRequest != nil {
+		return event.PullRequest.Head.SHA
+	}
+
+	return event.After
+}
+
+func (event GiteaEventPayload) Branch() string {
+	if event.PullRequest != nil {
+		return event.PullRequest.Head.Ref
+	}
+
+	return strings.TrimPrefix(event.Ref, "refs/heads/")
+}
+
+// giteaEvent binds an event to the API of the server that sent it.
+type giteaEvent struct {
+	GiteaEventPayload
+
+	api *bassgitea.API
+}
+
+// RefToLoad determines the ref to use for dispatching the event.
+//
+// For pull_request events, this is the pull_request.head.sha.
+//
+// For push events, this is the pushed sha.
+//
+// For every other event, this is the repo's default branch's current sha.
+func (event giteaEvent) RefToLoad(ctx context.Context) (string, error) {
+	sha := event.SHA()
+	if sha != "" {
+		return sha, nil
+	}
+
+	sha, err := event.api.GetBranch(ctx, event.Repo, event.Repo.DefaultBranch)
+	if err != nil {
+		return "", fmt.Errorf("get branch: %w", err)
+	}
+
+	return sha, nil
+}
+
+// detach returns a context for work which outlives the request that started
+// it, keeping its logger.
+func detach(ctx context.Context) context.Context {
+	// each concurrent Bass must have its own trace
+	detached := bass.WithTrace(context.Background(), &bass.Trace{})
+	return zapctx.ToContext(detached, zapctx.FromContext(ctx))
+}
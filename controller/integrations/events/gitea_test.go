@@ -0,0 +1,349 @@
+package events
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vito/bass-loop/pkg/bassgitea"
+	"github.com/vito/bass-loop/pkg/cfg"
+	"github.com/vito/bass-loop/pkg/models"
+)
+
+func TestGiteaValidate(t *testing.T) {
+	const (
+		secret = "mysecret"
+		body   = `{"ref":"refs/heads/main","after":"abc123"}`
+	)
+
+	sign := func(secret, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	for _, example := range []struct {
+		Name    string
+		Secret  string
+		Headers map[string]string
+
+		// Err is nil if the webhook is valid
+		Err error
+
+		// AnyErr is set if the webhook is rejected for another reason
+		AnyErr bool
+	}{
+		{
+			Name:   "valid signature",
+			Secret: secret,
+			Headers: map[string]string{
+				"X-Gitea-Event":     "push",
+				"X-Gitea-Delivery":  "some-delivery",
+				"X-Gitea-Signature": sign(secret, body),
+			},
+		},
+		{
+			Name:   "signed with another secret",
+			Secret: secret,
+			Headers: map[string]string{
+				"X-Gitea-Event":     "push",
+				"X-Gitea-Delivery":  "some-delivery",
+				"X-Gitea-Signature": sign("wrong", body),
+			},
+			Err: ErrInvalidSignature,
+		},
+		{
+			Name:   "malformed signature",
+			Secret: secret,
+			Headers: map[string]string{
+				"X-Gitea-Event":     "push",
+				"X-Gitea-Delivery":  "some-delivery",
+				"X-Gitea-Signature": "not-hex",
+			},
+			Err: ErrInvalidSignature,
+		},
+		{
+			Name:   "missing signature",
+			Secret: secret,
+			Headers: map[string]string{
+				"X-Gitea-Event":    "push",
+				"X-Gitea-Delivery": "some-delivery",
+			},
+			Err: ErrInvalidSignature,
+		},
+		{
+			Name: "no secret configured",
+			Headers: map[string]string{
+				"X-Gitea-Event":     "push",
+				"X-Gitea-Delivery":  "some-delivery",
+				"X-Gitea-Signature": sign("", body),
+			},
+			Err: ErrInvalidSignature,
+		},
+		{
+			Name:   "missing event",
+			Secret: secret,
+			Headers: map[string]string{
+				"X-Gitea-Delivery":  "some-delivery",
+				"X-Gitea-Signature": sign(secret, body),
+			},
+			AnyErr: true,
+		},
+		{
+			Name:   "missing delivery",
+			Secret: secret,
+			Headers: map[string]string{
+				"X-Gitea-Event":     "push",
+				"X-Gitea-Signature": sign(secret, body),
+			},
+			AnyErr: true,
+		},
+	} {
+		example := example
+		t.Run(example.Name, func(t *testing.T) {
+			config := &cfg.Config{}
+			config.Gitea.WebhookSecret = example.Secret
+
+			gitea := &giteaIntegration{
+				c: &Controller{Config: config},
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/integrations/gitea/events", strings.NewReader(body))
+			for k, v := range example.Headers {
+				req.Header.Set(k, v)
+			}
+
+			webhook, err := gitea.Validate(req)
+			switch {
+			case example.AnyErr:
+				if err == nil || errors.Is(err, ErrInvalidSignature) {
+					t.Errorf("expected a malformed webhook error, got %v", err)
+				}
+			case example.Err != nil:
+				if !errors.Is(err, example.Err) {
+					t.Errorf("expected %q, got %v", example.Err, err)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+
+				if webhook.Event != "push" {
+					t.Errorf("expected event %q, got %q", "push", webhook.Event)
+				}
+
+				if webhook.DeliveryID != "some-delivery" {
+					t.Errorf("expected delivery %q, got %q", "some-delivery", webhook.DeliveryID)
+				}
+
+				if string(webhook.Payload) != body {
+					t.Errorf("expected payload %q, got %q", body, string(webhook.Payload))
+				}
+			}
+		})
+	}
+}
+
+func TestGiteaHandle(t *testing.T) {
+	const (
+		repo   = `"repository":{"full_name":"vito/bass","owner":{"login":"vito"}}`
+		sender = `"sender":{"login":"alice"}`
+	)
+
+	for _, example := range []struct {
+		Name     string
+		Event    string
+		Payload  string
+		Dispatch bool
+	}{
+		{
+			Name:     "push",
+			Event:    GiteaPushEvent,
+			Payload:  `{"ref":"refs/heads/main","after":"abc123",` + repo + `,` + sender + `}`,
+			Dispatch: true,
+		},
+		{
+			Name:     "pull request",
+			Event:    GiteaPullRequestEvent,
+			Payload:  `{"action":"opened","pull_request":{"number":1,"head":{"ref":"feature","sha":"abc123"}},` + repo + `,` + sender + `}`,
+			Dispatch: true,
+		},
+		{
+			Name:     "unsupported event",
+			Event:    "issues",
+			Payload:  `{"action":"opened",` + repo + `,` + sender + `}`,
+			Dispatch: false,
+		},
+		{
+			Name:     "branch deletion",
+			Event:    GiteaPushEvent,
+			Payload:  `{"ref":"refs/heads/gone","after":"` + nullSHA + `",` + repo + `,` + sender + `}`,
+			Dispatch: false,
+		},
+		{
+			Name:     "no repo",
+			Event:    GiteaPushEvent,
+			Payload:  `{"ref":"refs/heads/main","after":"abc123",` + sender + `}`,
+			Dispatch: false,
+		},
+		{
+			Name:     "no sender",
+			Event:    GiteaPushEvent,
+			Payload:  `{"ref":"refs/heads/main","after":"abc123",` + repo + `}`,
+			Dispatch: false,
+		},
+	} {
+		example := example
+		t.Run(example.Name, func(t *testing.T) {
+			gitea := &giteaIntegration{}
+
+			dispatch, err := gitea.Handle(context.Background(), Webhook{
+				Event:      example.Event,
+				DeliveryID: "some-delivery",
+				Payload:    []byte(example.Payload),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if dispatch != example.Dispatch {
+				t.Errorf("expected dispatch to be %t, got %t", example.Dispatch, dispatch)
+			}
+		})
+	}
+
+	t.Run("malformed payload", func(t *testing.T) {
+		gitea := &giteaIntegration{}
+
+		_, err := gitea.Handle(context.Background(), Webhook{
+			Event:   GiteaPushEvent,
+			Payload: []byte(`{`),
+		})
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestGiteaEventPayload(t *testing.T) {
+	repo := &bassgitea.Repository{
+		Name:     "bass",
+		FullName: "vito/bass",
+		HTMLURL:  "https://gitea.example.com/vito/bass",
+		Private:  true,
+	}
+
+	sender := &bassgitea.User{Login: "alice"}
+
+	t.Run("push", func(t *testing.T) {
+		event := GiteaEventPayload{
+			Ref:    "refs/heads/main",
+			After:  "abc123",
+			Repo:   repo,
+			Sender: sender,
+		}
+
+		if sha := event.SHA(); sha != "abc123" {
+			t.Errorf("expected sha %q, got %q", "abc123", sha)
+		}
+
+		if branch := event.Branch(); branch != "main" {
+			t.Errorf("expected branch %q, got %q", "main", branch)
+		}
+
+		meta := event.Meta()
+
+		expectMeta(t, meta, "repo", "full_name", "vito/bass")
+		expectMeta(t, meta, "repo", "private", true)
+		expectMeta(t, meta, "commit", "sha", "abc123")
+		expectMeta(t, meta, "commit", "url", "https://gitea.example.com/vito/bass/commit/abc123")
+		expectMeta(t, meta, "branch", "name", "main")
+		expectMeta(t, meta, "branch", "url", "https://gitea.example.com/vito/bass/src/branch/main")
+		expectMeta(t, meta, "sender", "login", "alice")
+
+		if _, found := meta["pull_request"]; found {
+			t.Errorf("expected no pull_request meta, got %v", meta["pull_request"])
+		}
+	})
+
+	t.Run("pull request", func(t *testing.T) {
+		event := GiteaEventPayload{
+			PullRequest: &GiteaPullRequest{
+				Number:  42,
+				HTMLURL: "https://gitea.example.com/vito/bass/pulls/42",
+			},
+			Repo:   repo,
+			Sender: sender,
+		}
+		event.PullRequest.Head.Ref = "feature"
+		event.PullRequest.Head.SHA = "def456"
+
+		if sha := event.SHA(); sha != "def456" {
+			t.Errorf("expected sha %q, got %q", "def456", sha)
+		}
+
+		if branch := event.Branch(); branch != "feature" {
+			t.Errorf("expected branch %q, got %q", "feature", branch)
+		}
+
+		meta := event.Meta()
+
+		expectMeta(t, meta, "commit", "sha", "def456")
+		expectMeta(t, meta, "branch", "name", "feature")
+		expectMeta(t, meta, "pull_request", "number", 42)
+		expectMeta(t, meta, "pull_request", "url", "https://gitea.example.com/vito/bass/pulls/42")
+	})
+
+	t.Run("recorded as the run's repo", func(t *testing.T) {
+		event := GiteaEventPayload{
+			After:  "abc123",
+			Repo:   repo,
+			Sender: sender,
+		}
+
+		run := &models.Run{}
+		run.Meta.Valid = true
+		run.Meta.String = mustMarshal(t, models.Meta{GiteaIntegration: event.Meta()})
+
+		runRepo, ok := run.Repo()
+		if !ok {
+			t.Fatal("expected the run to have a repo")
+		}
+
+		if runRepo.Forge != GiteaForge || runRepo.FullName != "vito/bass" || !runRepo.Private {
+			t.Errorf("unexpected repo: %+v", runRepo)
+		}
+	})
+}
+
+func expectMeta(t *testing.T, meta models.Meta, key, field string, expected any) {
+	t.Helper()
+
+	sub, ok := meta[key].(models.Meta)
+	if !ok {
+		t.Errorf("expected %s meta, got %v", key, meta[key])
+		return
+	}
+
+	if sub[field] != expected {
+		t.Errorf("expected %s.%s to be %v, got %v", key, field, expected, sub[field])
+	}
+}
+
+func mustMarshal(t *testing.T, val any) string {
+	t.Helper()
+
+	payload, err := json.Marshal(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(payload)
+}
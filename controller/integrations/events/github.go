@@ -2,65 +2,52 @@ package events
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"net/http"
-	"os"
 
 	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/google/go-github/v43/github"
-	"github.com/opencontainers/go-digest"
 	defaultinit "github.com/vito/bass-loop/bass/default-init"
 	"github.com/vito/bass-loop/pkg/bassgh"
 	"github.com/vito/bass-loop/pkg/models"
-	"github.com/vito/bass-loop/pkg/runs"
+	"github.com/vito/bass-loop/pkg/pool"
 	"github.com/vito/bass/pkg/bass"
-	"github.com/vito/bass/pkg/cli"
-	"github.com/vito/bass/pkg/ioctx"
 	"github.com/vito/bass/pkg/zapctx"
-	"github.com/vito/progrock"
 	"go.uber.org/zap"
 )
 
 const initPath = "bass/init.bass"
 
-func (c *Controller) handleGitHub(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	ctx = ioctx.StderrToContext(ctx, os.Stderr)
+// gitHubIntegration receives webhooks from the GitHub app.
+type gitHubIntegration struct {
+	c *Controller
+}
 
+func (gh *gitHubIntegration) Validate(r *http.Request) (Webhook, error) {
 	eventName := r.Header.Get("X-GitHub-Event")
-	deliveryID := r.Header.Get("X-GitHub-Delivery")
-
-	logger := c.Log.With(
-		zap.String("event", eventName),
-		zap.String("delivery", deliveryID),
-	)
-	ctx = zapctx.ToContext(ctx, logger)
-
 	if eventName == "" {
-		logger.Warn("missing event type")
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintln(w, "missing event type")
-		return
+		return Webhook{}, fmt.Errorf("missing event type")
 	}
 
-	payloadBytes, err := github.ValidatePayload(r, []byte(c.Config.GitHubApp.WebhookSecret))
-	if err != nil {
-		logger.Warn("invalid secret")
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		fmt.Fprintln(w, "invalid secret")
-		return
+	deliveryID := r.Header.Get("X-GitHub-Delivery")
+	if deliveryID == "" {
+		return Webhook{}, fmt.Errorf("missing delivery id")
 	}
 
-	err = c.handleGitHubEvent(ctx, eventName, deliveryID, payloadBytes)
+	payload, err := github.ValidatePayload(r, []byte(gh.c.Config.GitHubApp.WebhookSecret))
 	if err != nil {
-		logger.Error("failed to handle event", zap.Error(err))
-		cli.WriteError(ctx, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintln(w, err.Error())
-		return
+		return Webhook{}, fmt.Errorf("%w: %s", ErrInvalidSignature, err)
 	}
+
+	return Webhook{
+		Event:      eventName,
+		DeliveryID: deliveryID,
+		Payload:    payload,
+	}, nil
 }
 
 type GitHubEventPayload struct {
@@ -76,6 +63,9 @@ type GitHubEventPayload struct {
 	// set on check_run events
 	CheckRun *github.CheckRun `json:"check_run,omitempty"`
 
+	// set on check_run requested_action events
+	RequestedAction *github.RequestedAction `json:"requested_action,omitempty"`
+
 	// set on pull_request events
 	PullRequest *github.PullRequest `json:"pull_request,omitempty"`
 
@@ -98,6 +88,7 @@ func (event GitHubEventPayload) Meta() models.Meta {
 			"name":      event.Repo.GetName(),
 			"full_name": event.Repo.GetFullName(),
 			"url":       event.Repo.GetHTMLURL(),
+			"private":   event.Repo.GetPrivate(),
 		}
 
 		sha := event.SHA()
@@ -186,30 +177,18 @@ func (event *GitHubEventPayload) RefToLoad(ctx context.Context, ghClient *github
 	return branch.GetCommit().GetSHA(), nil
 }
 
-func (c *Controller) handleGitHubEvent(ctx context.Context, eventName, deliveryID string, payload []byte) error {
-	logger := zapctx.FromContext(ctx).With(
-		zap.String("event", eventName),
-		zap.String("delivery", deliveryID),
-	)
-
-	logger.Info("handling")
+func (gh *gitHubIntegration) Handle(ctx context.Context, webhook Webhook) (bool, error) {
+	logger := zapctx.FromContext(ctx)
 
-	var payloadScope *bass.Scope
-	err := json.Unmarshal(payload, &payloadScope)
+	event, err := parseGitHubEvent(webhook.Payload)
 	if err != nil {
-		return fmt.Errorf("payload->scope: %w", err)
-	}
-
-	var event GitHubEventPayload
-	err = json.Unmarshal(payload, &event)
-	if err != nil {
-		return fmt.Errorf("unmarshal check suite: %w", err)
+		return false, err
 	}
 
 	if event.Sender == nil || event.Repo == nil || event.Installation == nil {
 		// be defensive just because we don't really know what events we'll receive
 		logger.Warn("ignoring unknown event")
-		return nil
+		return false, nil
 	}
 
 	logger = logger.With(
@@ -217,34 +196,136 @@ func (c *Controller) handleGitHubEvent(ctx context.Context, eventName, deliveryI
 		zap.String("repo", event.Repo.GetFullName()),
 	)
 
-	// handle the rest async
-	c.dispatches.Go(func() error {
-		defer func() {
-			// we're forking a goroutine from a goroutine, so prevent panics from
-			// taking down the whole loop
-			if err := recover(); err != nil {
-				logger.Error("dispatch panic!", zap.Any("recovered", err))
-			}
-		}()
-
-		err := c.dispatch(
-			zapctx.ToContext(context.Background(), logger),
-			event,
-			eventName,
-			deliveryID,
-			payloadScope,
-		)
-		if err != nil {
-			logger.Warn("dispatch errored", zap.Error(err))
+	if webhook.Event == "check_run" &&
+		event.RequestedAction != nil &&
+		event.RequestedAction.Identifier == bassgh.CancelActionIdentifier {
+		// handled by the loop itself rather than the repo's hook
+		return false, gh.cancel(zapctx.ToContext(ctx, logger), event)
+	}
+
+	return true, nil
+}
+
+// cancel cancels a check's run when its sender presses the check's Cancel
+// button.
+//
+// Only the user who ran it or users who can push to its repo may cancel a
+// run, same as from the web UI. Runs can only be cancelled by the node running
+// them, so if the run isn't in flight on this node the check is updated to say
+// it couldn't be cancelled.
+func (gh *gitHubIntegration) cancel(ctx context.Context, event GitHubEventPayload) error {
+	runID := event.CheckRun.GetExternalID()
+
+	logger := zapctx.FromContext(ctx).With(zap.String("run", runID))
+
+	run, err := models.RunByID(ctx, gh.c.DB, runID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Warn("run not found")
+			return nil
 		}
 
+		return fmt.Errorf("get run: %w", err)
+	}
+
+	if run.EndTime != nil {
+		logger.Info("run already completed")
 		return nil
+	}
+
+	sender := &models.User{
+		ID:    event.Sender.GetNodeID(),
+		Login: event.Sender.GetLogin(),
+	}
+
+	allowed, err := gh.c.Access.CanCancel(ctx, sender, run)
+	if err != nil {
+		return fmt.Errorf("check run: %w", err)
+	}
+
+	if !allowed {
+		logger.Warn("sender may not cancel run")
+		return gh.noteOnCheck(ctx, event, fmt.Sprintf(
+			"@%s may not cancel this run; only the user who ran it or users who can push to the repo may.",
+			sender.Login,
+		))
+	}
+
+	if !gh.c.Active.Cancel(runID) {
+		logger.Warn("run not in flight")
+		return gh.noteOnCheck(ctx, event,
+			"This run could not be cancelled, since it isn't running on the Loop node which received the request. Try again from the run's page.")
+	}
+
+	logger.Info("cancelled run")
+
+	return nil
+}
+
+// noteOnCheck adds a note to the output of the event's check run, keeping its
+// title and summary.
+func (gh *gitHubIntegration) noteOnCheck(ctx context.Context, event GitHubEventPayload, note string) error {
+	ghClient := github.NewClient(&http.Client{
+		Transport: ghinstallation.NewFromAppsTransport(gh.c.Transport, event.Installation.GetID()),
+	})
+
+	checkRun := event.CheckRun
+	output := checkRun.GetOutput()
+
+	title := output.GetTitle()
+	if title == "" {
+		title = checkRun.GetName()
+	}
+
+	summary := output.GetSummary()
+	if summary == "" {
+		summary = note
+	}
+
+	_, _, err := ghClient.Checks.UpdateCheckRun(ctx, event.Repo.GetOwner().GetLogin(), event.Repo.GetName(), checkRun.GetID(), github.UpdateCheckRunOptions{
+		Name: checkRun.GetName(),
+		Output: &github.CheckRunOutput{
+			Title:   github.String(title),
+			Summary: github.String(summary),
+			Text:    github.String(note),
+		},
 	})
+	if err != nil {
+		return fmt.Errorf("update check run: %w", err)
+	}
 
 	return nil
 }
 
-func (c *Controller) dispatch(ctx context.Context, payload GitHubEventPayload, eventName, deliveryID string, payloadScope *bass.Scope) error {
+func parseGitHubEvent(payload []byte) (GitHubEventPayload, error) {
+	var event GitHubEventPayload
+	err := json.Unmarshal(payload, &event)
+	if err != nil {
+		return GitHubEventPayload{}, fmt.Errorf("unmarshal event: %w", err)
+	}
+
+	return event, nil
+}
+
+// gitHubEvent binds an event to a client for the installation that sent it.
+type gitHubEvent struct {
+	GitHubEventPayload
+
+	client *github.Client
+}
+
+func (event gitHubEvent) RefToLoad(ctx context.Context) (string, error) {
+	return event.GitHubEventPayload.RefToLoad(ctx, event.client)
+}
+
+func (gh *gitHubIntegration) Dispatch(ctx context.Context, delivery *models.Delivery) error {
+	c := gh.c
+
+	payload, err := parseGitHubEvent(delivery.Payload)
+	if err != nil {
+		return err
+	}
+
 	// calling context is ignored; this outlives the hook handler
 	_ = ctx
 
@@ -255,86 +336,80 @@ func (c *Controller) dispatch(ctx context.Context, payload GitHubEventPayload, e
 	sender := payload.Sender
 	repo := payload.Repo
 
-	// load the user's forwarded runtime pool
-	ctx, pool, err := c.withUserPool(ctx, sender)
-	if err != nil {
-		return fmt.Errorf("user %s (%s) pool: %w", sender.GetLogin(), sender.GetNodeID(), err)
-	}
-	defer pool.Close()
-
 	ghClient := github.NewClient(&http.Client{
 		Transport: ghinstallation.NewFromAppsTransport(c.Transport, instID),
 	})
 
-	ref, err := payload.RefToLoad(ctx, ghClient)
+	repoConfig, err := loadRepoConfig(ctx, ghClient, repo)
 	if err != nil {
-		return fmt.Errorf("get ref to load: %w", err)
+		return fmt.Errorf("load repo config: %w", err)
 	}
 
-	repoFS := bassgh.NewFS(ctx, ghClient, repo, ref)
-
-	repoRoot, err := c.checkoutRepo(ctx, repoFS, repo.GetCloneURL(), ref)
+	// load the user's forwarded runtime pool, or the repo's or org's
+	ctx, pool, err := c.withPool(ctx, sender, GitHubForge, repo.GetFullName(), repoConfig.Runners)
 	if err != nil {
-		return fmt.Errorf("checkout repo: %w", err)
+		return fmt.Errorf("user %s (%s) pool: %w", sender.GetLogin(), sender.GetNodeID(), err)
 	}
+	defer pool.Close()
 
-	hookPath, err := repoRoot.Extend(bass.FilePath{Path: HookScript})
-	if err != nil {
-		return fmt.Errorf("extend repo path: %w", err)
+	if len(pool.Runtimes) == 0 {
+		// nothing to even load the hook with; wait for a runner to show up
+		return c.awaitRunner(ctx, ghClient, payload, delivery)
 	}
 
-	hookThunk := bass.Thunk{
-		Args: []bass.Value{hookPath},
-		Stdin: []bass.Value{
-			bass.Bindings{
-				"event":   bass.String(eventName),
-				"payload": payloadScope,
-			}.Scope(),
+	event := gitHubEvent{payload, ghClient}
+
+	hook := Hook{
+		Integration: GitHubIntegration,
+		Script:      HookScript,
+		Event:       event,
+		Sender:      sender,
+		FS: func(ref string) fs.FS {
+			return bassgh.NewFS(ctx, ghClient, repo, ref)
 		},
+		CloneURL: repo.GetCloneURL(),
+		Module:   c.checksClient(ghClient, instID, sender, repo, repoConfig.Runners, event.Meta()).Module(),
 	}
 
-	payloadMeta := payload.Meta()
+	if delivery.CheckRunID.Valid {
+		checkRunID := delivery.CheckRunID.Int64
 
-	run, err := models.CreateThunkRun(ctx, c.DB, sender, hookThunk, models.Meta{
-		"github": payloadMeta,
-		"event": models.Meta{
-			"name":     eventName,
-			"delivery": deliveryID,
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("create hook thunk run: %w", err)
-	}
+		hook.Started = func(ctx context.Context, run *models.Run) error {
+			return c.startWaitingCheck(ctx, ghClient, repo, checkRunID, run)
+		}
 
-	tape := progrock.NewTape()
-	recorder := progrock.NewRecorder(tape)
-	runCtx := progrock.RecorderToContext(ctx, recorder)
+		hook.Finished = func(ctx context.Context, run *models.Run, hookErr error) error {
+			return c.concludeWaitingCheck(ctx, ghClient, repo, checkRunID, run, hookErr)
+		}
+	}
 
-	rec := recorder.Vertex(digest.Digest("delivery:"+deliveryID), fmt.Sprintf("[delivery] %s %s", eventName, deliveryID))
-	logger := bass.LoggerTo(rec.Stderr(), zap.DebugLevel)
-	runCtx = zapctx.ToContext(runCtx, logger)
-	runCtx = ioctx.StderrToContext(runCtx, rec.Stderr())
+	return c.runHook(ctx, delivery, hook)
+}
 
-	err = callHook(runCtx, hookThunk, &bassgh.Client{
+// checksClient returns a client for the hook to create checks with.
+func (c *Controller) checksClient(ghClient *github.Client, instID int64, sender *github.User, repo *github.Repository, runners []string, meta models.Meta) *bassgh.Client {
+	return &bassgh.Client{
 		ExternalURL: c.externalURL,
 		DB:          c.DB,
 		GH:          ghClient,
 		Blobs:       c.Blobs,
+		Streams:     c.Streams,
+		Active:      c.Active,
+		Redactor:    c.Redactor,
 		Sender:      sender,
 		Repo:        repo,
-		Meta:        payloadMeta,
-	})
-	if err != nil {
-		cli.WriteError(runCtx, err)
-	}
+		Meta:        meta,
 
-	rec.Done(err)
+		Queue:          c.Queue,
+		InstallationID: instID,
+		Runners:        runners,
 
-	if completeErr := runs.Record(ctx, c.DB, c.Blobs, run, tape, err == nil); completeErr != nil {
-		return fmt.Errorf("failed to complete: %w", completeErr)
+		RunnerTimeout: c.Config.RunnerTimeout,
+		LoadPool: func(ctx context.Context) (*pool.Pool, error) {
+			_, runtimePool, err := c.withPool(ctx, sender, GitHubForge, repo.GetFullName(), runners)
+			return runtimePool, err
+		},
 	}
-
-	return err
 }
 
 func (c *Controller) checkoutRepo(ctx context.Context, repoFS fs.FS, cloneURL, ref string) (bass.Path, error) {
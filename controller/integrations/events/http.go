@@ -0,0 +1,491 @@
+package events
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation"
+	"github.com/google/go-github/v43/github"
+	"github.com/vito/bass-loop/pkg/bassgh"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/queue"
+	"github.com/vito/bass/pkg/bass"
+	"github.com/vito/bass/pkg/zapctx"
+)
+
+const HTTPIntegration = "http"
+
+// HTTPUserID is the ID of the user that HTTP events are sent as.
+const HTTPUserID = "http"
+
+// Forges hosting the repos that events are dispatched for.
+const (
+	GitHubForge = "github"
+	GiteaForge  = "gitea"
+)
+
+// ErrNoSharedRunners is returned when an HTTP event is sent to a repo which
+// hasn't opted in to using its shared runtimes.
+var ErrNoSharedRunners = errors.New(`http events need runners shared with the repo or org; add "repo" or "org" to the runners in ` + RepoConfigPath)
+
+// ErrUnsupportedForge is returned when an HTTP event is sent to a repo which
+// isn't on GitHub. Runtimes can't be shared with repos on other forges, so
+// there would be nothing to run the hook on.
+var ErrUnsupportedForge = errors.New("http events can only be sent to GitHub repos")
+
+// HTTPTimestampTolerance is how far a signed event's timestamp may be from
+// the current time, so that captured requests can't be replayed later on.
+const HTTPTimestampTolerance = 5 * time.Minute
+
+// httpIntegration receives events sent directly over HTTP, e.g. from cron or
+// another system, authenticated with a secret configured for each repo.
+type httpIntegration struct {
+	c *Controller
+
+	// secrets by repo ID, as returned by parseRepoID
+	secrets map[string]string
+
+	// returns the current time, for checking timestamps
+	now func() time.Time
+
+	// returns true if the delivery has already been received
+	seen func(ctx context.Context, deliveryID string) (bool, error)
+}
+
+func newHTTPIntegration(c *Controller) (*httpIntegration, error) {
+	secrets := map[string]string{}
+	for _, pair := range c.Config.HTTP.Secrets {
+		repoID, secret, ok := strings.Cut(pair, "=")
+		if !ok || secret == "" {
+			return nil, fmt.Errorf("malformed http secret for %q; expected REPO=SECRET", repoID)
+		}
+
+		forge, owner, name, err := parseRepoID(repoID)
+		if err != nil {
+			return nil, err
+		}
+
+		if forge != GitHubForge {
+			return nil, fmt.Errorf("http secret for %q: %w", repoID, ErrUnsupportedForge)
+		}
+
+		secrets[repoKey(forge, owner, name)] = secret
+	}
+
+	return &httpIntegration{
+		c:       c,
+		secrets: secrets,
+		now:     time.Now,
+		seen: func(ctx context.Context, deliveryID string) (bool, error) {
+			_, err := models.DeliveryByID(ctx, c.DB, deliveryID)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return false, nil
+				}
+
+				return false, fmt.Errorf("get delivery: %w", err)
+			}
+
+			return true, nil
+		},
+	}, nil
+}
+
+// HTTPEventPayload is the body of an HTTP event.
+type HTTPEventPayload struct {
+	// Repo identifies the repo as OWNER/NAME or github:OWNER/NAME. Only GitHub
+	// repos are supported.
+	Repo string `json:"repo"`
+
+	// Ref is the branch, tag, or sha to load the hook from. Defaults to the
+	// repo's default branch.
+	Ref string `json:"ref,omitempty"`
+
+	// Event is the event name passed to the hook.
+	Event string `json:"event"`
+
+	// Payload is passed to the hook as-is.
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+func parseHTTPEvent(payload []byte) (HTTPEventPayload, error) {
+	var event HTTPEventPayload
+	err := json.Unmarshal(payload, &event)
+	if err != nil {
+		return HTTPEventPayload{}, fmt.Errorf("unmarshal event: %w", err)
+	}
+
+	return event, nil
+}
+
+// Validate authenticates the event with the repo's secret, either sent as-is
+// as a bearer token or used to sign the request with HMAC-SHA256 in the
+// X-Loop-Signature header.
+//
+// Every event must have a unique ID in the X-Loop-Delivery header, and events
+// with an ID that has already been received are rejected unless they're sent
+// with the bearer token and ?force=1. Signatures cover the ID and the time in
+// the X-Loop-Timestamp header along with the body, and are rejected once the
+// time is more than HTTPTimestampTolerance away, so a signed event can only be
+// sent again with a fresh ID.
+func (h *httpIntegration) Validate(r *http.Request) (Webhook, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("read payload: %w", err)
+	}
+
+	event, err := parseHTTPEvent(body)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	if event.Repo == "" {
+		return Webhook{}, fmt.Errorf("missing repo")
+	}
+
+	if event.Event == "" {
+		return Webhook{}, fmt.Errorf("missing event")
+	}
+
+	forge, owner, name, err := parseRepoID(event.Repo)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	if forge != GitHubForge {
+		return Webhook{}, fmt.Errorf("%w: %s", ErrUnsupportedForge, event.Repo)
+	}
+
+	deliveryID := r.Header.Get("X-Loop-Delivery")
+	if deliveryID == "" {
+		return Webhook{}, fmt.Errorf("missing X-Loop-Delivery")
+	}
+
+	// unknown repos have no secret, so they fail validation
+	secret := h.secrets[repoKey(forge, owner, name)]
+
+	token, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if bearer {
+		if secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			return Webhook{}, ErrInvalidSignature
+		}
+	} else {
+		timestamp := r.Header.Get("X-Loop-Timestamp")
+		if err := h.checkTimestamp(timestamp); err != nil {
+			return Webhook{}, err
+		}
+
+		signature := strings.TrimPrefix(r.Header.Get("X-Loop-Signature"), "sha256=")
+		if err := validateHMAC(httpSignedPayload(timestamp, deliveryID, body), signature, secret); err != nil {
+			return Webhook{}, err
+		}
+	}
+
+	// keep client-provided IDs from colliding with other integrations
+	deliveryID = HTTPIntegration + ":" + deliveryID
+
+	// ?force=1 from whoever holds the secret dispatches the event again; a
+	// signed request must not be replayable that way, since the query isn't
+	// covered by its signature
+	force := bearer && r.URL.Query().Get("force") == "1"
+
+	seen, err := h.seen(r.Context(), deliveryID)
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	if seen && !force {
+		return Webhook{}, fmt.Errorf("%w: %s", ErrDuplicateDelivery, deliveryID)
+	}
+
+	return Webhook{
+		Event:      event.Event,
+		DeliveryID: deliveryID,
+		Payload:    body,
+	}, nil
+}
+
+// checkTimestamp checks that the timestamp, in seconds since the Unix epoch,
+// is within HTTPTimestampTolerance of the current time.
+func (h *httpIntegration) checkTimestamp(timestamp string) error {
+	if timestamp == "" {
+		return fmt.Errorf("%w: missing X-Loop-Timestamp", ErrInvalidSignature)
+	}
+
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp: %s", ErrInvalidSignature, err)
+	}
+
+	skew := h.now().Sub(time.Unix(secs, 0))
+	if skew > HTTPTimestampTolerance || skew < -HTTPTimestampTolerance {
+		return fmt.Errorf("%w: timestamp is %s off", ErrInvalidSignature, skew.Truncate(time.Second))
+	}
+
+	return nil
+}
+
+// httpSignedPayload returns the content signed by X-Loop-Signature:
+// TIMESTAMP.DELIVERY.BODY
+func httpSignedPayload(timestamp, deliveryID string, body []byte) []byte {
+	return append([]byte(timestamp+"."+deliveryID+"."), body...)
+}
+
+func (h *httpIntegration) Handle(ctx context.Context, webhook Webhook) (bool, error) {
+	return true, nil
+}
+
+func (h *httpIntegration) Dispatch(ctx context.Context, delivery *models.Delivery) error {
+	c := h.c
+
+	payload, err := parseHTTPEvent(delivery.Payload)
+	if err != nil {
+		return err
+	}
+
+	// calling context is ignored; this outlives the hook handler
+	ctx = detach(ctx)
+	logger := zapctx.FromContext(ctx)
+
+	repo, err := h.repo(ctx, payload.Repo)
+	if err != nil {
+		return fmt.Errorf("load repo %s: %w", payload.Repo, err)
+	}
+
+	repoConfig, err := repo.Config(ctx)
+	if err != nil {
+		return fmt.Errorf("load repo config: %w", err)
+	}
+
+	runners := httpRunners(repoConfig.Runners)
+	if len(runners) == 0 {
+		return queue.Abandon(ErrNoSharedRunners)
+	}
+
+	sender := &github.User{
+		NodeID: github.String(HTTPUserID),
+		Login:  github.String(HTTPUserID),
+	}
+
+	ctx, runtimePool, err := c.withPool(ctx, sender, repo.Forge, repo.FullName, runners)
+	if err != nil {
+		return fmt.Errorf("repo %s pool: %w", repo.FullName, err)
+	}
+	defer runtimePool.Close()
+
+	if len(runtimePool.Runtimes) == 0 {
+		// nothing to even load the hook with; wait for a runner to show up
+		if time.Since(delivery.CreatedAt.Time()) > c.runnerTimeout() {
+			logger.Warn("timed out waiting for a runner")
+			return queue.Abandon(ErrNoRunner)
+		}
+
+		logger.Info("no runner available; postponing delivery")
+		return queue.Postpone(ErrNoRunner)
+	}
+
+	hookPayload := []byte(payload.Payload)
+	if len(hookPayload) == 0 {
+		hookPayload = []byte("{}")
+	}
+
+	event := &httpEvent{
+		HTTPEventPayload: payload,
+		repo:             repo,
+	}
+
+	return c.runHook(ctx, delivery, Hook{
+		Integration: HTTPIntegration,
+		Script:      repo.Script,
+		Event:       event,
+		Sender:      sender,
+		Payload:     hookPayload,
+		FS:          repo.FS,
+		CloneURL:    repo.CloneURL,
+		Module:      repo.Module(sender, runners, event.Meta()),
+	})
+}
+
+// httpRunners returns the runtime pools to use for an HTTP event.
+//
+// The sender pool is skipped, since HTTP events are sent as the http user,
+// which never has any runtimes of its own.
+func httpRunners(runners []string) []string {
+	shared := []string{}
+	for _, r := range runners {
+		if r != SenderRunners {
+			shared = append(shared, r)
+		}
+	}
+
+	return shared
+}
+
+// httpEvent binds an event to the repo it was sent to.
+type httpEvent struct {
+	HTTPEventPayload
+
+	repo *httpRepo
+
+	// set once the ref is resolved
+	sha string
+}
+
+func (event *httpEvent) Meta() models.Meta {
+	meta := models.Meta{
+		"repo": models.Meta{
+			"name":      event.repo.Name,
+			"full_name": event.repo.FullName,
+			"url":       event.repo.HTMLURL,
+			"private":   event.repo.Private,
+			"forge":     event.repo.Forge,
+		},
+		"ref": event.Ref,
+	}
+
+	if event.sha != "" {
+		meta["commit"] = models.Meta{
+			"sha": event.sha,
+			"url": event.repo.HTMLURL + "/commit/" + event.sha,
+		}
+	}
+
+	return meta
+}
+
+// RefToLoad resolves the event's ref to a sha, defaulting to the repo's
+// default branch.
+func (event *httpEvent) RefToLoad(ctx context.Context) (string, error) {
+	ref := event.Ref
+	if ref == "" {
+		ref = event.repo.DefaultBranch
+	}
+
+	sha, err := event.repo.ResolveRef(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", ref, err)
+	}
+
+	event.sha = sha
+
+	return sha, nil
+}
+
+// httpRepo is a repo on a forge that HTTP events can be dispatched to.
+type httpRepo struct {
+	Forge         string
+	Private       bool
+	Name          string
+	FullName      string
+	HTMLURL       string
+	CloneURL      string
+	DefaultBranch string
+
+	// Script is the path to the forge's hook script.
+	Script string
+
+	// Config loads the repo's config.
+	Config func(context.Context) (*RepoConfig, error)
+
+	// ResolveRef returns the sha that a ref points to.
+	ResolveRef func(context.Context, string) (string, error)
+
+	// FS returns the repo's content at the given ref.
+	FS func(ref string) fs.FS
+
+	// Module returns the module for the hook to create checks with.
+	Module func(sender *github.User, runners []string, meta models.Meta) *bass.Scope
+}
+
+func (h *httpIntegration) repo(ctx context.Context, repoID string) (*httpRepo, error) {
+	forge, owner, name, err := parseRepoID(repoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if forge != GitHubForge {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedForge, forge)
+	}
+
+	return h.gitHubRepo(ctx, owner, name)
+}
+
+func (h *httpIntegration) gitHubRepo(ctx context.Context, owner, name string) (*httpRepo, error) {
+	c := h.c
+
+	appClient := github.NewClient(&http.Client{
+		Transport: c.Transport,
+	})
+
+	inst, _, err := appClient.Apps.FindRepositoryInstallation(ctx, owner, name)
+	if err != nil {
+		return nil, fmt.Errorf("find installation: %w", err)
+	}
+
+	instID := inst.GetID()
+
+	ghClient := github.NewClient(&http.Client{
+		Transport: ghinstallation.NewFromAppsTransport(c.Transport, instID),
+	})
+
+	repo, _, err := ghClient.Repositories.Get(ctx, owner, name)
+	if err != nil {
+		return nil, fmt.Errorf("get repo: %w", err)
+	}
+
+	return &httpRepo{
+		Forge:         GitHubForge,
+		Private:       repo.GetPrivate(),
+		Name:          repo.GetName(),
+		FullName:      repo.GetFullName(),
+		HTMLURL:       repo.GetHTMLURL(),
+		CloneURL:      repo.GetCloneURL(),
+		DefaultBranch: repo.GetDefaultBranch(),
+		Script:        HookScript,
+		Config: func(ctx context.Context) (*RepoConfig, error) {
+			return loadRepoConfig(ctx, ghClient, repo)
+		},
+		ResolveRef: func(ctx context.Context, ref string) (string, error) {
+			sha, _, err := ghClient.Repositories.GetCommitSHA1(ctx, owner, name, ref, "")
+			return sha, err
+		},
+		FS: func(ref string) fs.FS {
+			return bassgh.NewFS(ctx, ghClient, repo, ref)
+		},
+		Module: func(sender *github.User, runners []string, meta models.Meta) *bass.Scope {
+			return c.checksClient(ghClient, instID, sender, repo, runners, meta).Module()
+		},
+	}, nil
+}
+
+// parseRepoID parses a repo ID of the form FORGE:OWNER/NAME, where the forge
+// defaults to github.
+func parseRepoID(repoID string) (string, string, string, error) {
+	forge, fullName, found := strings.Cut(repoID, ":")
+	if !found {
+		forge, fullName = GitHubForge, repoID
+	}
+
+	owner, name, found := strings.Cut(fullName, "/")
+	if !found || owner == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", "", fmt.Errorf("malformed repo %q; expected FORGE:OWNER/NAME", repoID)
+	}
+
+	return forge, owner, name, nil
+}
+
+// repoKey returns a normalized key for a repo, since forges treat names
+// case-insensitively.
+func repoKey(forge, owner, name string) string {
+	return strings.ToLower(forge + ":" + owner + "/" + name)
+}
@@ -0,0 +1,282 @@
+package events
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vito/bass-loop/pkg/cfg"
+	"github.com/vito/is"
+)
+
+const (
+	testHTTPSecret = "mysecret"
+	testHTTPBody   = `{"repo":"github:vito/bass","event":"nightly"}`
+)
+
+var testHTTPNow = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+func TestHTTPValidate(t *testing.T) {
+	t.Run("bearer token", func(t *testing.T) {
+		is := is.New(t)
+
+		webhook, err := validateHTTP("", testHTTPBody, bearerHeaders(testHTTPSecret, "some-delivery"))
+		is.NoErr(err)
+		is.Equal(webhook.Event, "nightly")
+		is.Equal(webhook.DeliveryID, HTTPIntegration+":some-delivery")
+		is.Equal(string(webhook.Payload), testHTTPBody)
+	})
+
+	t.Run("wrong bearer token", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("", testHTTPBody, bearerHeaders("wrong", "some-delivery"))
+		is.True(errors.Is(err, ErrInvalidSignature))
+	})
+
+	t.Run("bearer token without delivery", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("", testHTTPBody, map[string]string{
+			"Authorization": "Bearer " + testHTTPSecret,
+		})
+		is.True(err != nil)
+		is.True(!errors.Is(err, ErrInvalidSignature)) // malformed, not unauthorized
+	})
+
+	t.Run("signed", func(t *testing.T) {
+		is := is.New(t)
+
+		webhook, err := validateHTTP("", testHTTPBody, signedHeaders(testHTTPSecret, 0, "some-delivery", testHTTPBody))
+		is.NoErr(err)
+		is.Equal(webhook.Event, "nightly")
+		is.Equal(webhook.DeliveryID, HTTPIntegration+":some-delivery")
+		is.Equal(string(webhook.Payload), testHTTPBody)
+	})
+
+	t.Run("signed within tolerance", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("", testHTTPBody, signedHeaders(testHTTPSecret, -HTTPTimestampTolerance+time.Second, "some-delivery", testHTTPBody))
+		is.NoErr(err)
+	})
+
+	t.Run("signed without delivery", func(t *testing.T) {
+		is := is.New(t)
+
+		headers := signedHeaders(testHTTPSecret, 0, "", testHTTPBody)
+		delete(headers, "X-Loop-Delivery")
+
+		_, err := validateHTTP("", testHTTPBody, headers)
+		is.True(err != nil)
+		is.True(!errors.Is(err, ErrInvalidSignature)) // malformed, not unauthorized
+	})
+
+	t.Run("signed without timestamp", func(t *testing.T) {
+		is := is.New(t)
+
+		headers := signedHeaders(testHTTPSecret, 0, "some-delivery", testHTTPBody)
+		delete(headers, "X-Loop-Timestamp")
+
+		_, err := validateHTTP("", testHTTPBody, headers)
+		is.True(errors.Is(err, ErrInvalidSignature))
+	})
+
+	t.Run("stale timestamp", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("", testHTTPBody, signedHeaders(testHTTPSecret, -HTTPTimestampTolerance-time.Second, "some-delivery", testHTTPBody))
+		is.True(errors.Is(err, ErrInvalidSignature))
+	})
+
+	t.Run("future timestamp", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("", testHTTPBody, signedHeaders(testHTTPSecret, HTTPTimestampTolerance+time.Second, "some-delivery", testHTTPBody))
+		is.True(errors.Is(err, ErrInvalidSignature))
+	})
+
+	t.Run("malformed timestamp", func(t *testing.T) {
+		is := is.New(t)
+
+		headers := signedHeaders(testHTTPSecret, 0, "some-delivery", testHTTPBody)
+		headers["X-Loop-Timestamp"] = "yesterday"
+
+		_, err := validateHTTP("", testHTTPBody, headers)
+		is.True(errors.Is(err, ErrInvalidSignature))
+	})
+
+	t.Run("timestamp not signed", func(t *testing.T) {
+		is := is.New(t)
+
+		headers := signedHeaders(testHTTPSecret, -time.Minute, "some-delivery", testHTTPBody)
+		headers["X-Loop-Timestamp"] = strconv.FormatInt(testHTTPNow.Unix(), 10)
+
+		_, err := validateHTTP("", testHTTPBody, headers)
+		is.True(errors.Is(err, ErrInvalidSignature))
+	})
+
+	t.Run("delivery not signed", func(t *testing.T) {
+		is := is.New(t)
+
+		headers := signedHeaders(testHTTPSecret, 0, "some-delivery", testHTTPBody)
+		headers["X-Loop-Delivery"] = "other-delivery"
+
+		_, err := validateHTTP("", testHTTPBody, headers)
+		is.True(errors.Is(err, ErrInvalidSignature))
+	})
+
+	t.Run("body not signed", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("", `{"repo":"github:vito/bass","event":"deploy"}`, signedHeaders(testHTTPSecret, 0, "some-delivery", testHTTPBody))
+		is.True(errors.Is(err, ErrInvalidSignature))
+	})
+
+	t.Run("signed with the wrong secret", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("", testHTTPBody, signedHeaders("wrong", 0, "some-delivery", testHTTPBody))
+		is.True(errors.Is(err, ErrInvalidSignature))
+	})
+
+	t.Run("unknown repo", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("", `{"repo":"github:vito/other","event":"nightly"}`, bearerHeaders(testHTTPSecret, "some-delivery"))
+		is.True(errors.Is(err, ErrInvalidSignature)) // unknown repos have no secret
+	})
+
+	t.Run("repo not on GitHub", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("", `{"repo":"gitea:vito/bass","event":"nightly"}`, bearerHeaders(testHTTPSecret, "some-delivery"))
+		is.True(errors.Is(err, ErrUnsupportedForge))
+	})
+
+	t.Run("missing event", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("", `{"repo":"github:vito/bass"}`, bearerHeaders(testHTTPSecret, "some-delivery"))
+		is.True(err != nil)
+		is.True(!errors.Is(err, ErrInvalidSignature)) // malformed, not unauthorized
+	})
+
+	t.Run("already seen", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("", testHTTPBody, signedHeaders(testHTTPSecret, 0, "seen-delivery", testHTTPBody))
+		is.True(errors.Is(err, ErrDuplicateDelivery))
+	})
+
+	t.Run("already seen, forced with the bearer token", func(t *testing.T) {
+		is := is.New(t)
+
+		webhook, err := validateHTTP("?force=1", testHTTPBody, bearerHeaders(testHTTPSecret, "seen-delivery"))
+		is.NoErr(err)
+		is.Equal(webhook.DeliveryID, HTTPIntegration+":seen-delivery")
+	})
+
+	t.Run("already seen, forced with a signature", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := validateHTTP("?force=1", testHTTPBody, signedHeaders(testHTTPSecret, 0, "seen-delivery", testHTTPBody))
+		is.True(errors.Is(err, ErrDuplicateDelivery)) // ?force=1 isn't signed, so it can't replay a request
+	})
+}
+
+func TestHTTPRunners(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(httpRunners(DefaultRunners), []string{})
+	is.Equal(httpRunners([]string{SenderRunners, RepoRunners, OrgRunners}), []string{RepoRunners, OrgRunners}) // sender is skipped
+	is.Equal(httpRunners([]string{OrgRunners, RepoRunners}), []string{OrgRunners, RepoRunners})                // order is kept
+}
+
+func TestNewHTTPIntegration(t *testing.T) {
+	t.Run("github repos", func(t *testing.T) {
+		is := is.New(t)
+
+		h, err := newHTTPIntegration(httpController("vito/bass=mysecret", "github:vito/booklit=othersecret"))
+		is.NoErr(err)
+		is.Equal(h.secrets[repoKey(GitHubForge, "vito", "bass")], "mysecret")
+		is.Equal(h.secrets[repoKey(GitHubForge, "vito", "booklit")], "othersecret")
+	})
+
+	t.Run("gitea repo", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := newHTTPIntegration(httpController("gitea:vito/bass=mysecret"))
+		is.True(errors.Is(err, ErrUnsupportedForge))
+	})
+
+	t.Run("missing secret", func(t *testing.T) {
+		is := is.New(t)
+
+		_, err := newHTTPIntegration(httpController("vito/bass"))
+		is.True(err != nil)
+	})
+}
+
+func httpController(secrets ...string) *Controller {
+	return &Controller{
+		Config: &cfg.Config{
+			HTTP: cfg.HTTPConfig{
+				Secrets: secrets,
+			},
+		},
+	}
+}
+
+// validateHTTP validates an event sent to vito/bass, which has already
+// received seen-delivery.
+func validateHTTP(query, body string, headers map[string]string) (Webhook, error) {
+	h := &httpIntegration{
+		secrets: map[string]string{
+			repoKey(GitHubForge, "vito", "bass"): testHTTPSecret,
+		},
+		now: func() time.Time {
+			return testHTTPNow
+		},
+		seen: func(ctx context.Context, deliveryID string) (bool, error) {
+			return deliveryID == HTTPIntegration+":seen-delivery", nil
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/integrations/http/events"+query, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	return h.Validate(req)
+}
+
+func bearerHeaders(secret, deliveryID string) map[string]string {
+	return map[string]string{
+		"Authorization":   "Bearer " + secret,
+		"X-Loop-Delivery": deliveryID,
+	}
+}
+
+// signedHeaders returns headers which sign the body with a timestamp offset from
+// testHTTPNow.
+func signedHeaders(secret string, offset time.Duration, deliveryID, body string) map[string]string {
+	timestamp := strconv.FormatInt(testHTTPNow.Add(offset).Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + deliveryID + "." + body))
+
+	return map[string]string{
+		"X-Loop-Delivery":  deliveryID,
+		"X-Loop-Timestamp": timestamp,
+		"X-Loop-Signature": "sha256=" + hex.EncodeToString(mac.Sum(nil)),
+	}
+}
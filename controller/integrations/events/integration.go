@@ -0,0 +1,230 @@
+package events
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/google/go-github/v43/github"
+	"github.com/opencontainers/go-digest"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/runs"
+	"github.com/vito/bass/pkg/bass"
+	"github.com/vito/bass/pkg/cli"
+	"github.com/vito/bass/pkg/ioctx"
+	"github.com/vito/bass/pkg/zapctx"
+	"github.com/vito/progrock"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidSignature is returned when a webhook's signature does not match
+// its payload.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// ErrDuplicateDelivery is returned when a webhook's delivery ID has already
+// been received.
+var ErrDuplicateDelivery = errors.New("duplicate delivery")
+
+// Integration receives webhooks from a source of events, e.g. a code forge,
+// and dispatches them to the repo's hook.
+type Integration interface {
+	// Validate checks that a webhook request came from the integration and
+	// returns the webhook it carries.
+	Validate(*http.Request) (Webhook, error)
+
+	// Handle is called with each webhook as soon as it's received. It returns
+	// true if the webhook should be enqueued for dispatching.
+	Handle(context.Context, Webhook) (bool, error)
+
+	// Dispatch dispatches an enqueued delivery to the repo's hook.
+	Dispatch(context.Context, *models.Delivery) error
+}
+
+// Webhook is an event received by an integration.
+type Webhook struct {
+	// Event is the name of the event, e.g. push.
+	Event string
+
+	// DeliveryID uniquely identifies the webhook.
+	DeliveryID string
+
+	// Payload is the event's JSON payload.
+	Payload []byte
+}
+
+// Event is a parsed webhook payload.
+type Event interface {
+	// Meta returns the metadata to record on the event's runs.
+	Meta() models.Meta
+
+	// RefToLoad returns the ref of the repo to load the hook from.
+	RefToLoad(context.Context) (string, error)
+}
+
+// Hook is an event to dispatch to a repo's hook script.
+type Hook struct {
+	// Integration is the key under which the event's metadata is recorded on
+	// the run.
+	Integration string
+
+	// Script is the path to the hook script in the repo.
+	Script string
+
+	Event  Event
+	Sender *github.User
+
+	// Payload is passed to the hook with the event name. Defaults to the
+	// delivery's payload.
+	Payload []byte
+
+	// FS returns the repo's content at the given ref.
+	FS func(ref string) fs.FS
+
+	CloneURL string
+
+	// Module is bound to *loop* for the hook to use.
+	Module *bass.Scope
+
+	// Started is called, if set, once the hook's run is created.
+	Started func(context.Context, *models.Run) error
+
+	// Finished is called, if set, once the hook's run is recorded.
+	Finished func(context.Context, *models.Run, error) error
+}
+
+// runHook checks out the repo at the event's ref and calls its hook script,
+// recording it as a run.
+func (c *Controller) runHook(ctx context.Context, delivery *models.Delivery, hook Hook) error {
+	eventName := delivery.Event
+	deliveryID := delivery.ID
+
+	payload := hook.Payload
+	if payload == nil {
+		payload = delivery.Payload
+	}
+
+	var payloadScope *bass.Scope
+	err := json.Unmarshal(payload, &payloadScope)
+	if err != nil {
+		return fmt.Errorf("payload->scope: %w", err)
+	}
+
+	ref, err := hook.Event.RefToLoad(ctx)
+	if err != nil {
+		return fmt.Errorf("get ref to load: %w", err)
+	}
+
+	repoRoot, err := c.checkoutRepo(ctx, hook.FS(ref), hook.CloneURL, ref)
+	if err != nil {
+		return fmt.Errorf("checkout repo: %w", err)
+	}
+
+	hookPath, err := repoRoot.Extend(bass.FilePath{Path: hook.Script})
+	if err != nil {
+		return fmt.Errorf("extend repo path: %w", err)
+	}
+
+	hookThunk := bass.Thunk{
+		Args: []bass.Value{hookPath},
+		Stdin: []bass.Value{
+			bass.Bindings{
+				"event":   bass.String(eventName),
+				"payload": payloadScope,
+			}.Scope(),
+		},
+	}
+
+	run, err := models.CreateThunkRun(ctx, c.DB, hook.Sender, hookThunk, models.Meta{
+		hook.Integration: hook.Event.Meta(),
+		"event": models.Meta{
+			"name":     eventName,
+			"delivery": deliveryID,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("create hook thunk run: %w", err)
+	}
+
+	// save the run right away so that the delivery isn't run again if the
+	// process stops partway through the hook
+	delivery.RunID = sql.NullString{String: run.ID, Valid: true}
+	if err := delivery.Update(ctx, c.DB); err != nil {
+		return fmt.Errorf("update delivery: %w", err)
+	}
+
+	tape := progrock.NewTape()
+	stream := c.Streams.Start(run.ID, c.Redactor.Redaction(run.ID))
+	defer stream.Close()
+
+	runCtx, untrack := c.Active.Track(ctx, run.ID)
+	defer untrack()
+
+	recorder := progrock.NewRecorder(progrock.MultiWriter{tape, stream})
+	runCtx = progrock.RecorderToContext(runCtx, recorder)
+
+	rec := recorder.Vertex(digest.Digest("delivery:"+deliveryID), fmt.Sprintf("[delivery] %s %s", eventName, deliveryID))
+	logger := bass.LoggerTo(rec.Stderr(), zap.DebugLevel)
+	runCtx = zapctx.ToContext(runCtx, logger)
+	runCtx = ioctx.StderrToContext(runCtx, rec.Stderr())
+
+	if hook.Started != nil {
+		if err := hook.Started(ctx, run); err != nil {
+			logger.Warn("failed to report start", zap.Error(err))
+		}
+	}
+
+	err = callHook(runCtx, hookThunk, hook.Module)
+	if err != nil {
+		cli.WriteError(runCtx, err)
+	}
+
+	rec.Done(err)
+
+	if err != nil && runCtx.Err() != nil {
+		run.Cancelled = 1
+	}
+
+	if completeErr := runs.Record(ctx, c.DB, c.Blobs, c.Redactor, run, tape, err == nil); completeErr != nil {
+		return fmt.Errorf("failed to complete: %w", completeErr)
+	}
+
+	if hook.Finished != nil {
+		if finishErr := hook.Finished(ctx, run, err); finishErr != nil {
+			logger.Warn("failed to report result", zap.Error(finishErr))
+		}
+	}
+
+	return err
+}
+
+// validateHMAC checks that the signature is the hex-encoded HMAC-SHA256 of the
+// payload using the secret.
+//
+// An empty secret matches nothing, so that webhooks aren't accepted from just
+// anyone by accident.
+func validateHMAC(payload []byte, signature, secret string) error {
+	if secret == "" {
+		return fmt.Errorf("%w: no secret configured", ErrInvalidSignature)
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
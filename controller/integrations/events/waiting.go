@@ -0,0 +1,192 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation"
+	"github.com/google/go-github/v43/github"
+	"github.com/vito/bass-loop/pkg/bassgh"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/queue"
+	"github.com/vito/bass/pkg/bass"
+	"github.com/vito/bass/pkg/zapctx"
+)
+
+// WaitingCheckName is the name of the check run created for a delivery while
+// it waits for a runner.
+const WaitingCheckName = "bass loop"
+
+// ErrNoRunner is returned when a delivery gives up waiting for a runner.
+var ErrNoRunner = errors.New("no runner available")
+
+func (c *Controller) runnerTimeout() time.Duration {
+	if c.Config.RunnerTimeout == 0 {
+		return bassgh.DefaultRunnerTimeout
+	}
+
+	return c.Config.RunnerTimeout
+}
+
+// awaitRunner postpones a delivery until a runner is available, creating a
+// queued check run in the meantime so there's something to see on GitHub.
+//
+// Once the runner timeout elapses the check is concluded as timed out and the
+// delivery is abandoned.
+func (c *Controller) awaitRunner(ctx context.Context, ghClient *github.Client, payload GitHubEventPayload, delivery *models.Delivery) error {
+	logger := zapctx.FromContext(ctx)
+
+	repo := payload.Repo
+
+	timedOut := time.Since(delivery.CreatedAt.Time()) > c.runnerTimeout()
+
+	if delivery.CheckRunID.Valid && delivery.Postponed == 0 && !timedOut {
+		// redelivered, or waiting again after a failure; the check may have
+		// concluded already, so queue it again
+		_, _, err := ghClient.Checks.UpdateCheckRun(ctx, repo.GetOwner().GetLogin(), repo.GetName(), delivery.CheckRunID.Int64, github.UpdateCheckRunOptions{
+			Name:   WaitingCheckName,
+			Status: github.String("queued"),
+			Output: &github.CheckRunOutput{
+				Title:   github.String("Waiting for a runner"),
+				Summary: github.String(waitingSummary(payload.Sender)),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("update check run: %w", err)
+		}
+	} else if !delivery.CheckRunID.Valid && !timedOut {
+		sha := payload.SHA()
+		if sha != "" {
+			checkRun, _, err := ghClient.Checks.CreateCheckRun(ctx, repo.GetOwner().GetLogin(), repo.GetName(), github.CreateCheckRunOptions{
+				Name:    WaitingCheckName,
+				HeadSHA: sha,
+				Status:  github.String("queued"),
+				Output: &github.CheckRunOutput{
+					Title:   github.String("Waiting for a runner"),
+					Summary: github.String(waitingSummary(payload.Sender)),
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("create check run: %w", err)
+			}
+
+			delivery.CheckRunID = sql.NullInt64{Int64: checkRun.GetID(), Valid: true}
+		}
+	}
+
+	if !timedOut {
+		logger.Info("no runner available; postponing delivery")
+		return queue.Postpone(ErrNoRunner)
+	}
+
+	logger.Warn("timed out waiting for a runner")
+
+	if delivery.CheckRunID.Valid {
+		_, _, err := ghClient.Checks.UpdateCheckRun(ctx, repo.GetOwner().GetLogin(), repo.GetName(), delivery.CheckRunID.Int64, github.UpdateCheckRunOptions{
+			Name:        WaitingCheckName,
+			Status:      github.String("completed"),
+			Conclusion:  github.String("timed_out"),
+			CompletedAt: &github.Timestamp{Time: time.Now()},
+			Output: &github.CheckRunOutput{
+				Title:   github.String("No runner available"),
+				Summary: github.String(waitingSummary(payload.Sender)),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("update check run: %w", err)
+		}
+	}
+
+	return queue.Abandon(ErrNoRunner)
+}
+
+// startWaitingCheck marks a delivery's check run as in progress now that a
+// runner is available.
+func (c *Controller) startWaitingCheck(ctx context.Context, ghClient *github.Client, repo *github.Repository, checkRunID int64, run *models.Run) error {
+	runURL, err := c.externalURL.Parse("/runs/" + run.ID)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = ghClient.Checks.UpdateCheckRun(ctx, repo.GetOwner().GetLogin(), repo.GetName(), checkRunID, github.UpdateCheckRunOptions{
+		Name:       WaitingCheckName,
+		Status:     github.String("in_progress"),
+		ExternalID: github.String(run.ID),
+		DetailsURL: github.String(runURL.String()),
+		Output: &github.CheckRunOutput{
+			Title:   github.String("Running hook"),
+			Summary: github.String("* **run** [" + run.ID + "](" + runURL.String() + ")"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("update check run: %w", err)
+	}
+
+	return nil
+}
+
+// concludeWaitingCheck concludes a delivery's check run with the result of the
+// hook.
+func (c *Controller) concludeWaitingCheck(ctx context.Context, ghClient *github.Client, repo *github.Repository, checkRunID int64, run *models.Run, hookErr error) error {
+	runURL, err := c.externalURL.Parse("/runs/" + run.ID)
+	if err != nil {
+		return err
+	}
+
+	conclusion := "success"
+	if run.Cancelled == 1 {
+		conclusion = "cancelled"
+	} else if hookErr != nil {
+		conclusion = "failure"
+	}
+
+	_, _, err = ghClient.Checks.UpdateCheckRun(ctx, repo.GetOwner().GetLogin(), repo.GetName(), checkRunID, github.UpdateCheckRunOptions{
+		Name:        WaitingCheckName,
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		CompletedAt: &github.Timestamp{Time: run.EndTime.Time()},
+		Output: &github.CheckRunOutput{
+			Title:   github.String("Hook finished"),
+			Summary: github.String("* **run** [" + run.ID + "](" + runURL.String() + ")"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("update check run: %w", err)
+	}
+
+	return nil
+}
+
+// resumeCheck resumes a check which was waiting for a runtime when the
+// process stopped.
+func (c *Controller) resumeCheck(ctx context.Context, delivery *models.Delivery) error {
+	var held bassgh.HeldCheck
+	if err := json.Unmarshal(delivery.Payload, &held); err != nil {
+		return fmt.Errorf("unmarshal held check: %w", err)
+	}
+
+	// each concurrent Bass must have its own trace
+	ctx = bass.WithTrace(ctx, &bass.Trace{})
+
+	ghClient := github.NewClient(&http.Client{
+		Transport: ghinstallation.NewFromAppsTransport(c.Transport, held.InstallationID),
+	})
+
+	client := c.checksClient(ghClient, held.InstallationID, held.Sender, held.Repo, held.Runners, held.Meta)
+
+	return client.ResumeCheck(ctx, delivery, held)
+}
+
+func waitingSummary(sender *github.User) string {
+	return strings.Join([]string{
+		"No runner is available for @" + sender.GetLogin() + ", so the hook has not run yet.",
+		"",
+		"Start one with `bass --runner` and this check will pick up where it left off.",
+	}, "\n")
+}
@@ -0,0 +1,160 @@
+package login
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/vito/bass-loop/pkg/cfg"
+	"github.com/vito/bass-loop/pkg/ghapp"
+	"github.com/vito/bass-loop/pkg/logs"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/session"
+	"go.uber.org/zap"
+)
+
+type Controller struct {
+	Log    *logs.Logger
+	DB     *models.Conn
+	Config *cfg.Config
+}
+
+// cookies remembering the sign-in attempt until GitHub redirects back
+const (
+	stateCookie    = "loop_oauth_state"
+	returnToCookie = "loop_oauth_return_to"
+)
+
+// how long a sign-in attempt may take, in seconds
+const attemptMaxAge = 10 * 60
+
+// Index signs in with GitHub.
+//
+// Without a code it sends the user to GitHub to authorize the app, which then
+// redirects back here with a code, completing the sign-in.
+//
+// GET /login
+func (c *Controller) Index(w http.ResponseWriter, r *http.Request) {
+	if c.Config.GitHubApp.ClientID == "" {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "sign in is not configured")
+		return
+	}
+
+	oauth := &ghapp.OAuth{
+		ClientID:     c.Config.GitHubApp.ClientID,
+		ClientSecret: c.Config.GitHubApp.ClientSecret,
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		c.authorize(w, r, oauth)
+	} else {
+		c.callback(w, r, oauth, code)
+	}
+}
+
+func (c *Controller) authorize(w http.ResponseWriter, r *http.Request, oauth *ghapp.OAuth) {
+	state, err := session.RandomToken()
+	if err != nil {
+		c.Log.Error("failed to generate state", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+
+	c.setCookie(w, stateCookie, state, attemptMaxAge)
+
+	if returnTo := r.URL.Query().Get("return_to"); isLocalPath(returnTo) {
+		c.setCookie(w, returnToCookie, returnTo, attemptMaxAge)
+	}
+
+	http.Redirect(w, r, oauth.AuthorizeURL(state), http.StatusFound)
+}
+
+func (c *Controller) callback(w http.ResponseWriter, r *http.Request, oauth *ghapp.OAuth, code string) {
+	ctx := r.Context()
+
+	state, err := r.Cookie(stateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(state.Value), []byte(r.URL.Query().Get("state"))) != 1 {
+		c.Log.Warn("state mismatch")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, "sign in expired or was not started here; try again")
+		return
+	}
+
+	token, err := oauth.Exchange(ctx, code)
+	if err != nil {
+		c.Log.Warn("failed to exchange code", zap.Error(err))
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+
+	ghUser, err := oauth.User(ctx, token)
+	if err != nil {
+		c.Log.Warn("failed to get user", zap.Error(err))
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+
+	logger := c.Log.With(zap.String("user", ghUser.GetLogin()))
+
+	user := &models.User{
+		ID:    ghUser.GetNodeID(),
+		Login: ghUser.GetLogin(),
+	}
+
+	if err := user.Upsert(ctx, c.DB); err != nil {
+		logger.Error("failed to save user", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+
+	if err := session.Start(ctx, c.DB, w, user, c.secure()); err != nil {
+		logger.Error("failed to start session", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+
+	logger.Info("signed in")
+
+	returnTo := "/"
+	if cookie, err := r.Cookie(returnToCookie); err == nil && isLocalPath(cookie.Value) {
+		returnTo = cookie.Value
+	}
+
+	c.setCookie(w, stateCookie, "", -1)
+	c.setCookie(w, returnToCookie, "", -1)
+
+	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+}
+
+func (c *Controller) setCookie(w http.ResponseWriter, name, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/login",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.secure(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// secure returns true if cookies should only be sent over HTTPS.
+func (c *Controller) secure() bool {
+	return strings.HasPrefix(c.Config.ExternalURL, "https://")
+}
+
+// isLocalPath returns true if the path is on this server, so that sign-in
+// can't be used to redirect elsewhere.
+func isLocalPath(path string) bool {
+	return strings.HasPrefix(path, "/") &&
+		!strings.HasPrefix(path, "//") &&
+		!strings.HasPrefix(path, "/\\")
+}
@@ -0,0 +1,41 @@
+package logout
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/vito/bass-loop/pkg/logs"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/session"
+	"go.uber.org/zap"
+)
+
+type Controller struct {
+	Log     *logs.Logger
+	DB      *models.Conn
+	Session *session.Session
+}
+
+// Create signs out and redirects home.
+//
+// The form must submit the session's CSRF token, so that other sites can't
+// sign the user out.
+//
+// POST /logout
+func (c *Controller) Create(w http.ResponseWriter, r *http.Request) {
+	if !c.Session.VerifyCSRF(r) {
+		c.Log.Warn("invalid csrf token")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintln(w, "invalid csrf token")
+		return
+	}
+
+	if err := c.Session.End(r.Context(), c.DB, w); err != nil {
+		c.Log.Error("failed to end session", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
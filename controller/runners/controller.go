@@ -1,11 +1,102 @@
 package runners
 
-import "github.com/vito/bass-loop/pkg/runnel"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/vito/bass-loop/pkg/access"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/present"
+	"github.com/vito/bass-loop/pkg/runnel"
+	"github.com/vito/bass-loop/pkg/runs"
+	"github.com/vito/bass-loop/pkg/session"
+)
 
 type Controller struct {
 	*runnel.Server
+
+	Active  *runs.Active
+	Access  *access.Checker
+	Session *session.Session
 }
 
-func (c *Controller) Index() string {
-	return "ok"
+type IndexProps struct {
+	Runtimes []*present.Runtime `json:"runtimes"`
+}
+
+// Index of connected runtimes that the viewer may see, i.e. their own and
+// those shared with them
+// GET /runners
+func (c *Controller) Index(ctx context.Context) (props *IndexProps, err error) {
+	props = &IndexProps{
+		Runtimes: []*present.Runtime{},
+	}
+
+	viewer := c.Session.User
+	if viewer == nil {
+		return props, nil
+	}
+
+	results, err := models.GetAllRuntimesResults(ctx, c.DB)
+	if err != nil {
+		return nil, fmt.Errorf("list runtimes: %w", err)
+	}
+
+	for _, r := range results {
+		model, err := models.RuntimeByUserIDName(ctx, c.DB, r.UserID, r.Name)
+		if err != nil {
+			return nil, fmt.Errorf("get runtime %s: %w", r.Name, err)
+		}
+
+		visible, err := c.Access.CanSeeRuntime(ctx, viewer, model)
+		if err != nil {
+			return nil, fmt.Errorf("check runtime %s: %w", r.Name, err)
+		}
+
+		if !visible {
+			continue
+		}
+
+		runIDs, err := c.visibleRunIDs(ctx, viewer, c.Active.Using(model.Name))
+		if err != nil {
+			return nil, err
+		}
+
+		runtime, err := present.NewRuntime(ctx, c.DB, model, runIDs)
+		if err != nil {
+			return nil, fmt.Errorf("present runtime: %w", err)
+		}
+
+		props.Runtimes = append(props.Runtimes, runtime)
+	}
+
+	return props, nil
+}
+
+// visibleRunIDs filters out the runs that the viewer may not see.
+func (c *Controller) visibleRunIDs(ctx context.Context, viewer *models.User, runIDs []string) ([]string, error) {
+	visible := []string{}
+	for _, id := range runIDs {
+		run, err := models.RunByID(ctx, c.DB, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+
+			return nil, fmt.Errorf("get run %s: %w", id, err)
+		}
+
+		ok, err := c.Access.CanView(ctx, viewer, run)
+		if err != nil {
+			return nil, fmt.Errorf("check run %s: %w", id, err)
+		}
+
+		if ok {
+			visible = append(visible, id)
+		}
+	}
+
+	return visible, nil
 }
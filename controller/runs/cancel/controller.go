@@ -0,0 +1,87 @@
+package cancel
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/vito/bass-loop/pkg/access"
+	"github.com/vito/bass-loop/pkg/logs"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/runs"
+	"github.com/vito/bass-loop/pkg/session"
+	"go.uber.org/zap"
+)
+
+type Controller struct {
+	Log     *logs.Logger
+	Conn    *models.Conn
+	Active  *runs.Active
+	Access  *access.Checker
+	Session *session.Session
+}
+
+// Create cancels an in-flight run and redirects back to it.
+//
+// Only the user who ran it or users who can push to its repo may cancel a
+// run; anyone else gets a 404, so as not to reveal that the run exists.
+//
+// POST /runs/:run_id/cancel
+func (c *Controller) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	runID := r.URL.Query().Get("run_id")
+
+	logger := c.Log.With(zap.String("run", runID))
+
+	run, err := models.RunByID(ctx, c.Conn, runID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			notFound(w)
+			return
+		}
+
+		logger.Error("failed to get run", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+
+	allowed, err := c.Access.CanCancel(ctx, c.Session.User, run)
+	if err != nil {
+		logger.Error("failed to check run", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+
+	if !allowed {
+		logger.Warn("viewer may not cancel run")
+		notFound(w)
+		return
+	}
+
+	if !c.Session.VerifyCSRF(r) {
+		logger.Warn("invalid csrf token")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintln(w, "invalid csrf token")
+		return
+	}
+
+	if !c.Active.Cancel(runID) {
+		logger.Warn("run not in flight")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "run is not in flight")
+		return
+	}
+
+	logger.Info("cancelled run", zap.String("by", c.Session.User.Login))
+
+	http.Redirect(w, r, "/runs/"+runID, http.StatusSeeOther)
+}
+
+func notFound(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprintln(w, "run not found")
+}
@@ -2,18 +2,23 @@ package run
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 
+	"github.com/vito/bass-loop/pkg/access"
 	"github.com/vito/bass-loop/pkg/blobs"
 	"github.com/vito/bass-loop/pkg/logs"
 	"github.com/vito/bass-loop/pkg/models"
 	"github.com/vito/bass-loop/pkg/present"
+	"github.com/vito/bass-loop/pkg/session"
 )
 
 type Controller struct {
-	Log   *logs.Logger
-	Conn  *models.Conn
-	Blobs *blobs.Bucket
+	Log     *logs.Logger
+	Conn    *models.Conn
+	Blobs   *blobs.Bucket
+	Access  *access.Checker
+	Session *session.Session
 }
 
 type IndexProps struct {
@@ -32,12 +37,23 @@ func (c *Controller) Index(ctx context.Context, path, value string) (props *Inde
 		Runs: []*present.Run{},
 	}
 
+	viewer := c.Session.User
+
 	for _, r := range runs {
 		model, err := models.RunByID(ctx, c.Conn, r.ID)
 		if err != nil {
 			return nil, fmt.Errorf("get run %s: %w", r.ID, err)
 		}
 
+		visible, err := c.Access.CanView(ctx, viewer, model)
+		if err != nil {
+			return nil, fmt.Errorf("check run %s: %w", r.ID, err)
+		}
+
+		if !visible {
+			continue
+		}
+
 		run, err := present.NewRun(ctx, c.Conn, model)
 		if err != nil {
 			return nil, fmt.Errorf("present run: %w", err)
@@ -52,6 +68,12 @@ func (c *Controller) Index(ctx context.Context, path, value string) (props *Inde
 type ShowProps struct {
 	Run      *present.Run      `json:"run"`
 	Vertexes []*present.Vertex `json:"vertexes"`
+
+	// CanCancel is true if the viewer may cancel the run while it's in flight.
+	CanCancel bool `json:"can_cancel"`
+
+	// CSRFToken is submitted by the cancel form.
+	CSRFToken string `json:"csrf_token,omitempty"`
 }
 
 // Show run
@@ -62,6 +84,16 @@ func (c *Controller) Show(ctx context.Context, id string) (props *ShowProps, err
 		return nil, fmt.Errorf("get run: %w", err)
 	}
 
+	visible, err := c.Access.CanView(ctx, c.Session.User, model)
+	if err != nil {
+		return nil, fmt.Errorf("check run: %w", err)
+	}
+
+	if !visible {
+		// don't reveal that the run exists
+		return nil, fmt.Errorf("get run: %w", sql.ErrNoRows)
+	}
+
 	run, err := present.NewRun(ctx, c.Conn, model)
 	if err != nil {
 		return nil, fmt.Errorf("present run: %w", err)
@@ -77,8 +109,21 @@ func (c *Controller) Show(ctx context.Context, id string) (props *ShowProps, err
 		return nil, fmt.Errorf("present vertexes: %w", err)
 	}
 
-	return &ShowProps{
+	props = &ShowProps{
 		Run:      run,
 		Vertexes: vertexes,
-	}, nil
+	}
+
+	if model.EndTime == nil {
+		props.CanCancel, err = c.Access.CanCancel(ctx, c.Session.User, model)
+		if err != nil {
+			return nil, fmt.Errorf("check cancel: %w", err)
+		}
+
+		if props.CanCancel {
+			props.CSRFToken = c.Session.CSRFToken()
+		}
+	}
+
+	return props, nil
 }
@@ -0,0 +1,138 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vito/bass-loop/pkg/access"
+	"github.com/vito/bass-loop/pkg/logs"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/present"
+	"github.com/vito/bass-loop/pkg/runs"
+	"github.com/vito/bass-loop/pkg/session"
+	"go.uber.org/zap"
+)
+
+type Controller struct {
+	Log     *logs.Logger
+	Conn    *models.Conn
+	Streams *runs.Streams
+	Access  *access.Checker
+	Session *session.Session
+}
+
+// how often to flush vertex updates to the client
+const flushInterval = 250 * time.Millisecond
+
+// Index streams the progress of an in-flight run as Server-Sent Events.
+//
+// Each changed vertex is sent as a "vertex" event; once the run has been
+// recorded a "done" event is sent and the stream ends.
+//
+// GET /runs/:run_id/events
+func (c *Controller) Index(w http.ResponseWriter, r *http.Request) {
+	runID := r.URL.Query().Get("run_id")
+
+	logger := c.Log.With(zap.String("run", runID))
+
+	run, err := models.RunByID(r.Context(), c.Conn, runID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	visible, err := c.Access.CanView(r.Context(), c.Session.User, run)
+	if err != nil {
+		logger.Error("failed to check run", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !visible {
+		// don't reveal that the run exists
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	stream, found := c.Streams.Get(runID)
+	if !found {
+		// run is either complete or unknown; 204 tells EventSource not to
+		// reconnect
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		fmt.Fprintln(w, "streaming not supported")
+		return
+	}
+
+	sub := stream.Subscribe()
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func() error {
+		updates, err := sub.Next()
+		if err != nil {
+			return err
+		}
+
+		for _, update := range updates {
+			if strings.Contains(update.Vertex.Name, "[hide]") {
+				continue
+			}
+
+			vertex := present.NewLiveVertex(update.Vertex, update.LogHTML, update.Num)
+			vertex.LogOffset = update.LogOffset
+
+			payload, err := json.Marshal(vertex)
+			if err != nil {
+				return err
+			}
+
+			if _, err := fmt.Fprintf(w, "event: vertex\ndata: %s\n\n", payload); err != nil {
+				return err
+			}
+		}
+
+		flusher.Flush()
+
+		return nil
+	}
+
+	for {
+		select {
+		case <-sub.Changed():
+			if err := send(); err != nil {
+				logger.Warn("failed to send updates", zap.Error(err))
+				return
+			}
+
+			// coalesce rapid updates, e.g. chatty logs
+			time.Sleep(flushInterval)
+
+		case <-stream.Done():
+			if err := send(); err != nil {
+				logger.Warn("failed to send updates", zap.Error(err))
+				return
+			}
+
+			fmt.Fprintf(w, "event: done\ndata: {}\n\n")
+			flusher.Flush()
+			return
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
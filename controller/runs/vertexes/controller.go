@@ -0,0 +1,138 @@
+package vertex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/vito/bass-loop/pkg/access"
+	"github.com/vito/bass-loop/pkg/blobs"
+	"github.com/vito/bass-loop/pkg/logs"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/present"
+	"github.com/vito/bass-loop/pkg/session"
+)
+
+type Controller struct {
+	Log     *logs.Logger
+	Conn    *models.Conn
+	Blobs   *blobs.Bucket
+	Access  *access.Checker
+	Session *session.Session
+}
+
+type ShowProps struct {
+	Run    *present.Run    `json:"run"`
+	Vertex *present.Vertex `json:"vertex"`
+
+	// vertexes in the same run that this vertex depends on
+	Inputs []*present.Vertex `json:"inputs"`
+
+	// vertexes in the same run that depend on this vertex
+	Outputs []*present.Vertex `json:"outputs"`
+}
+
+// Show vertex
+// GET /runs/:run_id/vertexes/:id
+func (c *Controller) Show(ctx context.Context, runID, id string) (props *ShowProps, err error) {
+	runModel, err := models.RunByID(ctx, c.Conn, runID)
+	if err != nil {
+		return nil, fmt.Errorf("get run: %w", err)
+	}
+
+	visible, err := c.Access.CanView(ctx, c.Session.User, runModel)
+	if err != nil {
+		return nil, fmt.Errorf("check run: %w", err)
+	}
+
+	if !visible {
+		// don't reveal that the run exists
+		return nil, fmt.Errorf("get run: %w", sql.ErrNoRows)
+	}
+
+	run, err := present.NewRun(ctx, c.Conn, runModel)
+	if err != nil {
+		return nil, fmt.Errorf("present run: %w", err)
+	}
+
+	model, err := models.VertexByRunIDDigest(ctx, c.Conn, runID, id)
+	if err != nil {
+		return nil, fmt.Errorf("get vertex: %w", err)
+	}
+
+	vertex, err := present.NewVertex(ctx, c.Blobs, model, 1)
+	if err != nil {
+		return nil, fmt.Errorf("present vertex: %w", err)
+	}
+
+	placement, err := models.VertexRuntimeByRunIDDigest(ctx, c.Conn, runID, id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("get vertex runtime: %w", err)
+	}
+
+	if placement != nil {
+		vertex.Runtime, err = present.NewVertexRuntime(ctx, c.Conn, placement)
+		if err != nil {
+			return nil, fmt.Errorf("present vertex runtime: %w", err)
+		}
+	}
+
+	props = &ShowProps{
+		Run:     run,
+		Vertex:  vertex,
+		Inputs:  []*present.Vertex{},
+		Outputs: []*present.Vertex{},
+	}
+
+	inputs, err := models.VertexEdgesByTargetDigest(ctx, c.Conn, model.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("get inputs: %w", err)
+	}
+
+	for _, edge := range inputs {
+		link, err := c.link(ctx, runID, edge.SourceDigest)
+		if err != nil {
+			return nil, fmt.Errorf("get input %s: %w", edge.SourceDigest, err)
+		}
+
+		if link != nil {
+			props.Inputs = append(props.Inputs, link)
+		}
+	}
+
+	outputs, err := models.VertexEdgesBySourceDigest(ctx, c.Conn, model.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("get outputs: %w", err)
+	}
+
+	for _, edge := range outputs {
+		link, err := c.link(ctx, runID, edge.TargetDigest)
+		if err != nil {
+			return nil, fmt.Errorf("get output %s: %w", edge.TargetDigest, err)
+		}
+
+		if link != nil {
+			props.Outputs = append(props.Outputs, link)
+		}
+	}
+
+	return props, nil
+}
+
+// link presents a vertex connected by an edge.
+//
+// Edges are recorded by digest alone, so they may refer to vertexes that were
+// never part of this run; those are skipped by returning nil.
+func (c *Controller) link(ctx context.Context, runID, digest string) (*present.Vertex, error) {
+	model, err := models.VertexByRunIDDigest(ctx, c.Conn, runID, digest)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return present.NewVertexLink(model), nil
+}
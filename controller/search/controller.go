@@ -0,0 +1,146 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vito/bass-loop/pkg/access"
+	"github.com/vito/bass-loop/pkg/logs"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/present"
+	"github.com/vito/bass-loop/pkg/session"
+)
+
+type Controller struct {
+	Log     *logs.Logger
+	Conn    *models.Conn
+	Access  *access.Checker
+	Session *session.Session
+}
+
+// how many matching vertex logs to show, best matches first
+const vertexLimit = 100
+
+// how many matching vertex logs to fetch at a time; matches which the viewer
+// can't see are skipped, so it may take a few pages to fill the results
+const pageSize = 100
+
+// how many matching vertex logs to look through at most, so that a phrase
+// which mostly matches runs the viewer can't see doesn't scan every log
+const searchLimit = 1000
+
+// how many matching lines to show for each vertex
+const lineLimit = 5
+
+type IndexProps struct {
+	Query   string                  `json:"query"`
+	Results []*present.SearchResult `json:"results"`
+}
+
+// Index searches the logs of every run for a phrase, e.g. "panic: nil map".
+// GET /search?q=...
+func (c *Controller) Index(ctx context.Context, q string) (props *IndexProps, err error) {
+	props = &IndexProps{
+		Query:   q,
+		Results: []*present.SearchResult{},
+	}
+
+	if strings.TrimSpace(q) == "" {
+		return props, nil
+	}
+
+	results := map[string]*present.SearchResult{}
+	hidden := map[string]bool{}
+	nums := map[string]map[string]int{}
+
+	var shown int
+	for offset := 0; shown < vertexLimit && offset < searchLimit; offset += pageSize {
+		matches, err := models.SearchVertexLogs(ctx, c.Conn, q, pageSize, offset)
+		if err != nil {
+			return nil, fmt.Errorf("search logs: %w", err)
+		}
+
+		for _, match := range matches {
+			if shown == vertexLimit {
+				break
+			}
+
+			if hidden[match.RunID] {
+				continue
+			}
+
+			result, found := results[match.RunID]
+			if !found {
+				model, err := models.RunByID(ctx, c.Conn, match.RunID)
+				if err != nil {
+					return nil, fmt.Errorf("get run %s: %w", match.RunID, err)
+				}
+
+				visible, err := c.Access.CanView(ctx, c.Session.User, model)
+				if err != nil {
+					return nil, fmt.Errorf("check run %s: %w", match.RunID, err)
+				}
+
+				if !visible {
+					hidden[match.RunID] = true
+					continue
+				}
+
+				run, err := present.NewRun(ctx, c.Conn, model)
+				if err != nil {
+					return nil, fmt.Errorf("present run: %w", err)
+				}
+
+				vertexes, err := models.VertexesByRunID(ctx, c.Conn, match.RunID)
+				if err != nil {
+					return nil, fmt.Errorf("get vertexes: %w", err)
+				}
+
+				nums[match.RunID] = present.VertexNums(vertexes)
+
+				result = &present.SearchResult{
+					Run:      run,
+					Vertexes: []*present.VertexSearch{},
+				}
+
+				results[match.RunID] = result
+				props.Results = append(props.Results, result)
+			}
+
+			vertex, err := models.VertexByRunIDDigest(ctx, c.Conn, match.RunID, match.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("get vertex: %w", err)
+			}
+
+			if strings.Contains(vertex.Name, "[hide]") {
+				// not shown on the run page, so there's nothing to link to
+				continue
+			}
+
+			num := nums[match.RunID][match.Digest]
+
+			result.Vertexes = append(result.Vertexes,
+				present.NewVertexSearch(vertex, num, match.Highlighted, lineLimit))
+
+			shown++
+		}
+
+		if len(matches) < pageSize {
+			// no more matches
+			break
+		}
+	}
+
+	// leave out runs which only matched in hidden vertexes
+	visible := props.Results[:0]
+	for _, result := range props.Results {
+		if len(result.Vertexes) > 0 {
+			visible = append(visible, result)
+		}
+	}
+
+	props.Results = visible
+
+	return props, nil
+}
@@ -0,0 +1,33 @@
+package session
+
+import (
+	"context"
+
+	"github.com/vito/bass-loop/pkg/present"
+	"github.com/vito/bass-loop/pkg/session"
+)
+
+type Controller struct {
+	Session *session.Session
+}
+
+type IndexProps struct {
+	// the signed-in user, or null if the viewer is anonymous
+	User *present.User `json:"user"`
+
+	// CSRFToken is submitted by the sign out form.
+	CSRFToken string `json:"csrf_token,omitempty"`
+}
+
+// Index shows who is signed in.
+// GET /session
+func (c *Controller) Index(ctx context.Context) (props *IndexProps, err error) {
+	props = &IndexProps{}
+
+	if c.Session.SignedIn() {
+		props.User = present.NewUser(c.Session.User)
+		props.CSRFToken = c.Session.CSRFToken()
+	}
+
+	return props, nil
+}
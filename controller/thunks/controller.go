@@ -2,19 +2,24 @@ package thunk
 
 import (
 	context "context"
+	"database/sql"
 	"fmt"
 	"sort"
 
+	"github.com/vito/bass-loop/pkg/access"
 	"github.com/vito/bass-loop/pkg/blobs"
 	"github.com/vito/bass-loop/pkg/logs"
 	"github.com/vito/bass-loop/pkg/models"
 	"github.com/vito/bass-loop/pkg/present"
+	"github.com/vito/bass-loop/pkg/session"
 )
 
 type Controller struct {
-	Log   *logs.Logger
-	Conn  *models.Conn
-	Blobs *blobs.Bucket
+	Log     *logs.Logger
+	Conn    *models.Conn
+	Blobs   *blobs.Bucket
+	Access  *access.Checker
+	Session *session.Session
 }
 
 type ShowProps struct {
@@ -33,14 +38,25 @@ func (c *Controller) Show(ctx context.Context, id string) (props *ShowProps, err
 		return nil, fmt.Errorf("get thunk %s: %w", id, err)
 	}
 
-	props.Thunk, err = present.NewThunk(ctx, c.Conn, model)
+	runModels, err := models.RunsByThunkDigest(ctx, c.Conn, id)
 	if err != nil {
-		return nil, fmt.Errorf("present thunk: %w", err)
+		return nil, fmt.Errorf("get runs: %w", err)
 	}
 
-	runModels, err := models.RunsByThunkDigest(ctx, c.Conn, id)
+	// the thunk is only as visible as its runs
+	runModels, err = c.Access.VisibleRuns(ctx, c.Session.User, runModels)
 	if err != nil {
-		return nil, fmt.Errorf("get runs: %w", err)
+		return nil, fmt.Errorf("check runs: %w", err)
+	}
+
+	if len(runModels) == 0 {
+		// don't reveal that the thunk exists
+		return nil, fmt.Errorf("get thunk %s: %w", id, sql.ErrNoRows)
+	}
+
+	props.Thunk, err = present.NewThunk(ctx, c.Conn, model)
+	if err != nil {
+		return nil, fmt.Errorf("present thunk: %w", err)
 	}
 
 	sort.Slice(runModels, func(i, j int) bool {
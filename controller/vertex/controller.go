@@ -1,16 +0,0 @@
-package vertex
-
-import (
-	"context"
-	"fmt"
-)
-
-type Controller struct {
-	// Dependencies...
-}
-
-// Index of runs
-// GET /run
-func (c *Controller) Show(ctx context.Context) error {
-	return fmt.Errorf("not implemented")
-}
@@ -7,6 +7,9 @@ pkgs.buildGo120Module rec {
 
   vendorSha256 = lib.fileContents ./nix/vendorSha256.txt;
 
+  # for ranked log search; see README
+  tags = [ "sqlite_fts5" ];
+
   # don't run tests here; they're too complicated
   doCheck = false;
 }
@@ -13,6 +13,7 @@ require (
 	github.com/gofrs/uuid v4.0.0+incompatible
 	github.com/golang-migrate/migrate/v4 v4.15.2
 	github.com/google/go-github/v43 v43.0.0
+	github.com/lib/pq v1.10.4
 	github.com/livebud/bud v0.2.9-0.20230321043811-0a5098e03201
 	github.com/mattn/go-colorable v0.1.12
 	github.com/mattn/go-sqlite3 v1.14.16
@@ -20,12 +21,14 @@ require (
 	github.com/spf13/pflag v1.0.5
 	github.com/vito/bass v0.12.1-0.20230525184837-765718ce4868
 	github.com/vito/invaders v0.0.2
+	github.com/vito/is v0.0.5
 	github.com/vito/progrock v0.4.1-0.20230526165706-b34527b3aabd
 	go.uber.org/zap v1.21.0
 	gocloud.dev v0.25.0
 	golang.org/x/crypto v0.2.0
 	golang.org/x/sync v0.1.0
 	google.golang.org/grpc v1.53.0
+	google.golang.org/protobuf v1.30.0
 )
 
 require (
@@ -131,7 +134,6 @@ require (
 	github.com/tonistiigi/units v0.0.0-20180711220420-6950e57a87ea // indirect
 	github.com/tonistiigi/vt100 v0.0.0-20210615222946-8066bb97264f // indirect
 	github.com/vektah/gqlparser/v2 v2.5.1 // indirect
-	github.com/vito/is v0.0.5 // indirect
 	github.com/vito/vt100 v0.1.1 // indirect
 	github.com/xlab/treeprint v1.1.0 // indirect
 	github.com/zeebo/xxh3 v1.0.2 // indirect
@@ -162,7 +164,6 @@ require (
 	google.golang.org/api v0.74.0 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/genproto v0.0.0-20230306155012-7f2fa6fef1f4 // indirect
-	google.golang.org/protobuf v1.30.0 // indirect
 	honnef.co/go/tools v0.3.3 // indirect
 	mvdan.cc/gofumpt v0.2.0 // indirect
 	rogchap.com/v8go v0.8.0 // indirect
@@ -0,0 +1,2 @@
+-- whether the run was cancelled before it could complete
+ALTER TABLE runs ADD COLUMN cancelled INTEGER NOT NULL DEFAULT 0;
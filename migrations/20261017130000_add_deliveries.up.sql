@@ -0,0 +1,36 @@
+-- webhook deliveries, stored so that they survive restarts and can be retried
+-- or redelivered
+CREATE TABLE deliveries (
+  -- the delivery ID assigned by the integration, e.g. X-GitHub-Delivery
+  id TEXT NOT NULL PRIMARY KEY,
+
+  -- the integration that sent the delivery, e.g. "github"
+  integration TEXT NOT NULL,
+
+  -- the event name, e.g. X-GitHub-Event
+  event TEXT NOT NULL,
+
+  -- the raw event payload
+  payload BLOB NOT NULL,
+
+  -- one of "pending", "running", "done", or "failed"
+  status TEXT NOT NULL,
+
+  -- how many times the delivery has been attempted
+  attempts INTEGER NOT NULL,
+
+  -- the error from the last attempt, if any
+  error TEXT NULL,
+
+  -- the run of the hook thunk, once it has been created
+  run_id TEXT NULL,
+
+  -- when the delivery was received
+  created_at TIMESTAMP NOT NULL,
+
+  -- when the delivery should next be attempted
+  attempt_at TIMESTAMP NOT NULL
+);
+
+-- the queue polls for pending deliveries
+CREATE INDEX idx_deliveries_status ON deliveries (status);
@@ -0,0 +1,5 @@
+DROP INDEX idx_services_node;
+DROP INDEX idx_runtimes_node;
+
+ALTER TABLE services DROP COLUMN node;
+ALTER TABLE runtimes DROP COLUMN node;
@@ -0,0 +1,11 @@
+-- the Loop node terminating the SSH session that registered the runtime or
+-- forwarded the service.
+--
+-- each node only cleans up its own rows on startup, since the rest may still
+-- be in use by sessions terminated by its peers.
+ALTER TABLE runtimes ADD COLUMN node TEXT NOT NULL DEFAULT '';
+ALTER TABLE services ADD COLUMN node TEXT NOT NULL DEFAULT '';
+
+-- need to find a node's runtimes and services when cleaning up
+CREATE INDEX idx_runtimes_node ON runtimes (node);
+CREATE INDEX idx_services_node ON services (node);
@@ -0,0 +1 @@
+ALTER TABLE deliveries DROP COLUMN check_run_id;
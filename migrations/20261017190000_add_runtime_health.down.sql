@@ -0,0 +1,3 @@
+ALTER TABLE runtimes DROP COLUMN checked_at;
+ALTER TABLE runtimes DROP COLUMN health_error;
+ALTER TABLE runtimes DROP COLUMN healthy;
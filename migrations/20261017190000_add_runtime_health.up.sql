@@ -0,0 +1,6 @@
+-- result of the last health probe of the runtime's forwarded service
+--
+-- unhealthy runtimes are left out of pools until a probe succeeds again.
+ALTER TABLE runtimes ADD COLUMN healthy INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE runtimes ADD COLUMN health_error TEXT NULL;
+ALTER TABLE runtimes ADD COLUMN checked_at TIMESTAMP NULL;
@@ -0,0 +1,5 @@
+-- when the runner's session registered the runtime
+ALTER TABLE runtimes ADD COLUMN connected_at TIMESTAMP NULL;
+
+-- when the runner last heartbeated
+ALTER TABLE runtimes ADD COLUMN heartbeat_at TIMESTAMP NULL;
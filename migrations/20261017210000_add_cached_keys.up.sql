@@ -0,0 +1,15 @@
+-- public keys fetched from the identity provider, cached so that SSH logins
+-- don't hit its API every time and still work while it's unavailable
+CREATE TABLE cached_keys (
+  -- the login the user authenticates as
+  login TEXT NOT NULL PRIMARY KEY,
+
+  -- the user's ID, as stored in users
+  user_id TEXT NOT NULL,
+
+  -- the user's keys in authorized_keys format, one per line
+  keys TEXT NOT NULL,
+
+  -- when the keys were fetched; they're refetched once the TTL elapses
+  fetched_at TIMESTAMP NOT NULL
+);
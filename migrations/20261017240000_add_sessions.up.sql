@@ -0,0 +1,18 @@
+-- web UI sessions of users who signed in with GitHub
+CREATE TABLE sessions (
+  -- the SHA-256 of the session's token, so that the tokens themselves are
+  -- never stored
+  id TEXT NOT NULL PRIMARY KEY,
+
+  -- the signed-in user
+  user_id TEXT NOT NULL,
+
+  created_at TIMESTAMP NOT NULL,
+
+  -- when the session stops working and must be signed in again
+  expires_at TIMESTAMP NOT NULL,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
@@ -0,0 +1,4 @@
+-- created on startup if SQLite has FTS5
+DROP TABLE IF EXISTS vertex_logs_fts;
+
+DROP TABLE vertex_logs;
@@ -0,0 +1,14 @@
+-- plain text of vertex logs for searching, with ANSI escape sequences stripped
+--
+-- if SQLite is built with FTS5 (-tags sqlite_fts5), Loop indexes this table in
+-- vertex_logs_fts on startup; otherwise it's searched with LIKE.
+CREATE TABLE vertex_logs (
+  -- the run and vertex that printed the logs
+  run_id TEXT NOT NULL,
+  digest TEXT NOT NULL,
+
+  -- the plain text of the logs, one line per terminal line
+  content TEXT NOT NULL,
+
+  PRIMARY KEY (run_id, digest)
+);
@@ -0,0 +1,17 @@
+-- flags configured with the SSH configure command, applied to every runtime
+-- the user forwards
+--
+-- runners like `bass --runner` don't pass flags to the forward command, so
+-- this is how their runtimes are labeled, prioritized, and shared.
+CREATE TABLE runner_settings (
+  -- the user who configured the flags
+  user_id TEXT NOT NULL PRIMARY KEY,
+
+  -- the forward command flags, as a JSON array of arguments
+  args TEXT NOT NULL,
+
+  -- when the flags were last configured
+  updated_at TIMESTAMP NOT NULL,
+
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
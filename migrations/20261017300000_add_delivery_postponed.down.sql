@@ -0,0 +1 @@
+ALTER TABLE deliveries DROP COLUMN postponed;
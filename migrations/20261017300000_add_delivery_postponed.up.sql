@@ -0,0 +1,5 @@
+-- whether the pending delivery was postponed, e.g. to wait for a runner, as
+-- opposed to backing off after a failure
+--
+-- postponed deliveries are woken up as soon as a runner connects.
+ALTER TABLE deliveries ADD COLUMN postponed INTEGER NOT NULL DEFAULT 0;
@@ -2,5 +2,12 @@ package migrations
 
 import "embed"
 
+// FS contains the SQLite migrations.
+//
 //go:embed *.sql
 var FS embed.FS
+
+// PostgresFS contains the PostgreSQL migrations, under postgres/.
+//
+//go:embed postgres/*.sql
+var PostgresFS embed.FS
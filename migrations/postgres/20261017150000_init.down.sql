@@ -0,0 +1,8 @@
+DROP TABLE deliveries;
+DROP TABLE services;
+DROP TABLE runtimes;
+DROP TABLE vertex_edges;
+DROP TABLE vertexes;
+DROP TABLE runs;
+DROP TABLE thunks;
+DROP TABLE users;
@@ -0,0 +1,199 @@
+-- the PostgreSQL schema, equivalent to the SQLite schema as of this migration.
+--
+-- migrations from here on must be added to both sets.
+
+-- GitHub users
+CREATE TABLE users (
+  id TEXT NOT NULL,
+  login TEXT NOT NULL,
+  PRIMARY KEY (id)
+);
+
+-- thunks, which are run by users
+CREATE TABLE thunks (
+  -- a content-addressable identifier for the thunk
+  digest TEXT NOT NULL PRIMARY KEY,
+
+  -- the thunk itself
+  json BYTEA NOT NULL
+);
+
+-- runs of thunks by users
+CREATE TABLE runs (
+  -- an arbitrary ID, i.e. a GUID
+  id TEXT NOT NULL PRIMARY KEY,
+
+  -- the user running the thunk
+  user_id TEXT NOT NULL,
+
+  -- the thunk being run
+  thunk_digest TEXT NOT NULL,
+
+  -- the time the thunk was run
+  start_time TIMESTAMP NOT NULL,
+
+  -- the time the thunk finished
+  end_time TIMESTAMP NULL,
+
+  -- whether the thunk completed successfully
+  succeeded INTEGER NULL,
+
+  -- arbitrary JSON metadata, e.g. the GitHub event that triggered the run
+  meta TEXT NULL,
+
+  -- whether the run was cancelled before it could complete
+  cancelled INTEGER NOT NULL DEFAULT 0,
+
+  FOREIGN KEY (thunk_digest) REFERENCES thunks (digest) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- it's reasonable to want to list runs of a thunk
+CREATE INDEX idx_thunk_runs_digest ON runs (thunk_digest);
+
+-- and runs by a user
+CREATE INDEX idx_thunk_runs_user_id ON runs (user_id);
+
+-- nodes in the DAG that have their own status and output
+--
+-- NB: vertex logs are stored in a blobstore rather than the database.
+CREATE TABLE vertexes (
+  -- the run the vertex belongs to
+  run_id TEXT NOT NULL,
+
+  -- the vertex's content addressed ID
+  digest TEXT NOT NULL,
+
+  -- the vertex's human-friendly name
+  name TEXT NOT NULL,
+
+  -- whether the vertex was a cache hit
+  cached INTEGER NOT NULL,
+
+  -- the vertex's start time, if any
+  start_time TIMESTAMP NULL,
+
+  -- the vertex's end time, if any
+  end_time TIMESTAMP NULL,
+
+  -- the vertex's error, if any
+  --
+  -- e.g. command exited nonzero, other error
+  error TEXT NULL,
+
+  PRIMARY KEY (run_id, digest),
+  FOREIGN KEY (run_id) REFERENCES runs (id) ON DELETE CASCADE
+);
+
+-- when viewing a run, you'll want to fetch all of its vertexes
+CREATE INDEX idx_vertexes_run_id ON vertexes (run_id);
+
+-- dependency relationships between vertexes
+CREATE TABLE vertex_edges (
+  source_digest TEXT NOT NULL,
+  target_digest TEXT NOT NULL,
+  PRIMARY KEY (source_digest, target_digest),
+  FOREIGN KEY (target_digest) REFERENCES thunks (digest) ON DELETE CASCADE
+);
+
+-- finding inputs/outputs of a vertex seems useful
+CREATE INDEX idx_vertex_edges_target_digest ON vertex_edges (target_digest);
+CREATE INDEX idx_vertex_edges_source_digest ON vertex_edges (source_digest);
+
+-- runtimes registered by a user
+CREATE TABLE runtimes (
+  -- the authenticated user registering the runtime
+  user_id TEXT NOT NULL,
+
+  -- a name used for tying the runtime to concurrently-forwarded services
+  name TEXT NOT NULL,
+
+  -- platform attributes used to select the runtime
+  os TEXT NOT NULL,
+  arch TEXT NOT NULL,
+
+  -- timestamp after which this row is no longer used and can be garbage
+  -- collected.
+  expires_at TIMESTAMP NOT NULL,
+
+  -- runtimes with a higher priority are preferred
+  priority INTEGER NOT NULL DEFAULT 0,
+
+  -- the Loop node terminating the runner's SSH session
+  node TEXT NOT NULL DEFAULT '',
+
+  PRIMARY KEY (user_id, name),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- need to find a user's runtimes when running their thunks
+CREATE INDEX idx_runtimes_user_id ON runtimes (user_id);
+
+-- need to find a node's runtimes when cleaning up
+CREATE INDEX idx_runtimes_node ON runtimes (node);
+
+-- services provided to runtimes
+CREATE TABLE services (
+  -- the authenticated user forwarding the service
+  user_id TEXT NOT NULL,
+
+  -- the runtime config this service is attached to
+  runtime_name TEXT NOT NULL,
+
+  -- service the address corresponds to, e.g. "runtime"
+  service TEXT NOT NULL,
+
+  -- address used to reach the forwarded server; either a node-local Unix
+  -- socket or a TCP/IP address reachable by peers
+  addr TEXT NOT NULL,
+
+  -- the Loop node terminating the runner's SSH session
+  node TEXT NOT NULL DEFAULT '',
+
+  PRIMARY KEY (runtime_name, service),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- need to be able to list services available to a runtime
+CREATE INDEX idx_services_runtime_name ON services (user_id, runtime_name);
+CREATE UNIQUE INDEX service_user_runtime_service_idx ON services (user_id, runtime_name, service);
+
+-- need to find a node's services when cleaning up
+CREATE INDEX idx_services_node ON services (node);
+
+-- webhook deliveries, stored so that they survive restarts and can be retried
+-- or redelivered
+CREATE TABLE deliveries (
+  -- the delivery ID assigned by the integration, e.g. X-GitHub-Delivery
+  id TEXT NOT NULL PRIMARY KEY,
+
+  -- the integration that sent the delivery, e.g. "github"
+  integration TEXT NOT NULL,
+
+  -- the event name, e.g. X-GitHub-Event
+  event TEXT NOT NULL,
+
+  -- the raw event payload
+  payload BYTEA NOT NULL,
+
+  -- one of "pending", "running", "done", or "failed"
+  status TEXT NOT NULL,
+
+  -- how many times the delivery has been attempted
+  attempts INTEGER NOT NULL,
+
+  -- the error from the last attempt, if any
+  error TEXT NULL,
+
+  -- the run of the hook thunk, once it has been created
+  run_id TEXT NULL,
+
+  -- when the delivery was received
+  created_at TIMESTAMP NOT NULL,
+
+  -- when the delivery should next be attempted
+  attempt_at TIMESTAMP NOT NULL
+);
+
+-- the queue polls for pending deliveries
+CREATE INDEX idx_deliveries_status ON deliveries (status);
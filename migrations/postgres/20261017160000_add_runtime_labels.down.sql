@@ -0,0 +1 @@
+ALTER TABLE runtimes DROP COLUMN labels;
@@ -0,0 +1,4 @@
+-- arbitrary labels registered by the runner, as a JSON object of strings
+--
+-- e.g. {"gpu":"false","region":"eu"}
+ALTER TABLE runtimes ADD COLUMN labels TEXT NOT NULL DEFAULT '{}';
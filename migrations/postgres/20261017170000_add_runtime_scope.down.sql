@@ -0,0 +1,3 @@
+DROP INDEX idx_runtimes_scope;
+
+ALTER TABLE runtimes DROP COLUMN scope;
@@ -0,0 +1,9 @@
+-- who the runtime is shared with, if anyone
+--
+-- empty for runtimes only used for the registering user's own runs;
+-- otherwise "org:<login>" or "repo:<owner>/<name>" for runtimes shared with an
+-- organization or repository.
+ALTER TABLE runtimes ADD COLUMN scope TEXT NOT NULL DEFAULT '';
+
+-- need to find an org's or repo's runtimes when dispatching
+CREATE INDEX idx_runtimes_scope ON runtimes (scope);
@@ -0,0 +1,3 @@
+-- a check run created for a delivery while it waits for a runtime, so that
+-- there's something to see on GitHub in the meantime
+ALTER TABLE deliveries ADD COLUMN check_run_id BIGINT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE runtimes DROP COLUMN heartbeat_at;
+ALTER TABLE runtimes DROP COLUMN connected_at;
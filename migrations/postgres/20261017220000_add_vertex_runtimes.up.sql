@@ -0,0 +1,26 @@
+-- the runtime each vertex of a run was executed on
+--
+-- runtimes are deleted when their runner disconnects, so the runtime's
+-- details are copied here rather than referenced.
+CREATE TABLE vertex_runtimes (
+  -- the run the vertex belongs to
+  run_id TEXT NOT NULL,
+
+  -- the vertex's content addressed ID
+  digest TEXT NOT NULL,
+
+  -- the user who forwarded the runtime
+  user_id TEXT NOT NULL,
+
+  -- the runtime's name, i.e. the runner's SSH session ID
+  runtime_name TEXT NOT NULL,
+
+  -- the runtime's platform
+  os TEXT NOT NULL,
+  arch TEXT NOT NULL,
+
+  PRIMARY KEY (run_id, digest),
+  FOREIGN KEY (run_id) REFERENCES runs (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_vertex_runtimes_run_id ON vertex_runtimes (run_id);
@@ -0,0 +1,2 @@
+-- who may view the run: public, collaborators (of the run's repo), or owner
+ALTER TABLE runs ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
@@ -0,0 +1,2 @@
+-- whether secrets were redacted from the run's logs
+ALTER TABLE runs ADD COLUMN redacted INTEGER NOT NULL DEFAULT 0;
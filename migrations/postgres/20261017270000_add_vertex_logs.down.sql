@@ -0,0 +1 @@
+DROP TABLE vertex_logs;
@@ -0,0 +1,15 @@
+-- full-text index of vertex logs, with ANSI escape sequences stripped
+CREATE TABLE vertex_logs (
+  -- the run and vertex that printed the logs
+  run_id TEXT NOT NULL,
+  digest TEXT NOT NULL,
+
+  -- the plain text of the logs, one line per terminal line
+  content TEXT NOT NULL,
+
+  PRIMARY KEY (run_id, digest),
+
+  FOREIGN KEY (run_id) REFERENCES runs (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_vertex_logs_content ON vertex_logs USING GIN (to_tsvector('simple', content));
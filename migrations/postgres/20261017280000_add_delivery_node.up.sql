@@ -0,0 +1,5 @@
+-- the Loop node dispatching the delivery while it's running
+--
+-- each node only recovers its own interrupted deliveries on startup, since the
+-- rest may still be running on its peers.
+ALTER TABLE deliveries ADD COLUMN node TEXT NOT NULL DEFAULT '';
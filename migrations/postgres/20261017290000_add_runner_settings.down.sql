@@ -0,0 +1 @@
+DROP TABLE runner_settings;
@@ -0,0 +1,282 @@
+// Package access decides who may view and cancel runs, who may see runtimes,
+// and who may administer Loop.
+package access
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation"
+	"github.com/google/go-github/v43/github"
+	"github.com/vito/bass-loop/pkg/cfg"
+	"github.com/vito/bass-loop/pkg/ghapp"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/pool"
+)
+
+// how long to remember whether a user is a collaborator on a repo, may push
+// to it, or is a member of an org
+const collaboratorTTL = time.Minute
+
+// Checker checks whether viewers may see and cancel runs.
+type Checker struct {
+	DB        *models.Conn
+	Transport *ghapp.Transport
+
+	// Admins are the logins of users who may manage deliveries.
+	Admins []string
+
+	collaborators  map[string]collaborator
+	collaboratorsL sync.Mutex
+}
+
+type collaborator struct {
+	is        bool
+	checkedAt time.Time
+}
+
+// repo permissions which allow pushing
+var pushPermissions = map[string]bool{
+	"admin": true,
+	"write": true,
+}
+
+func Load(config *cfg.Config, db *models.Conn, transport *ghapp.Transport) *Checker {
+	return &Checker{
+		DB:        db,
+		Transport: transport,
+		Admins:    config.Admins,
+
+		collaborators: map[string]collaborator{},
+	}
+}
+
+// CanView returns true if the viewer may see the run. The viewer is nil for
+// anonymous requests, which may only see public runs.
+func (checker *Checker) CanView(ctx context.Context, viewer *models.User, run *models.Run) (bool, error) {
+	switch run.Visibility {
+	case "", models.VisibilityPublic:
+		return true, nil
+	}
+
+	if viewer == nil {
+		return false, nil
+	}
+
+	if viewer.ID == run.UserID {
+		return true, nil
+	}
+
+	if run.Visibility != models.VisibilityCollaborators {
+		return false, nil
+	}
+
+	repo, ok := run.Repo()
+	if !ok || repo.Forge != "github" {
+		// only GitHub users can be viewers, so only GitHub collaborators are
+		// recognized
+		return false, nil
+	}
+
+	return checker.IsCollaborator(ctx, repo.FullName, viewer.Login)
+}
+
+// CanCancel returns true if the viewer may cancel the run, i.e. they ran it or
+// they can push to its repo. Anonymous viewers may not cancel anything.
+func (checker *Checker) CanCancel(ctx context.Context, viewer *models.User, run *models.Run) (bool, error) {
+	if viewer == nil {
+		return false, nil
+	}
+
+	if viewer.ID == run.UserID {
+		return true, nil
+	}
+
+	repo, ok := run.Repo()
+	if !ok || repo.Forge != "github" {
+		// only GitHub users can be viewers, so only GitHub permissions are
+		// recognized
+		return false, nil
+	}
+
+	return checker.canPush(ctx, repo.FullName, viewer.Login)
+}
+
+// CanSeeRuntime returns true if the viewer may see the runtime, i.e. it's
+// theirs or it's shared with an org they're a member of or a repo they're a
+// collaborator on. Anonymous viewers may not see any runtimes.
+func (checker *Checker) CanSeeRuntime(ctx context.Context, viewer *models.User, rt *models.Runtime) (bool, error) {
+	if viewer == nil {
+		return false, nil
+	}
+
+	if viewer.ID == rt.UserID {
+		return true, nil
+	}
+
+	if rt.Scope == "" {
+		return false, nil
+	}
+
+	kind, name, err := pool.ParseScope(rt.Scope)
+	if err != nil {
+		return false, err
+	}
+
+	switch kind {
+	case pool.OrgScopeKind:
+		return checker.IsOrgMember(ctx, name, viewer.Login)
+	case pool.RepoScopeKind:
+		return checker.IsCollaborator(ctx, name, viewer.Login)
+	default:
+		return false, nil
+	}
+}
+
+// IsAdmin returns true if the viewer is one of the configured admins.
+// Anonymous viewers are never admins.
+func (checker *Checker) IsAdmin(viewer *models.User) bool {
+	if viewer == nil {
+		return false
+	}
+
+	for _, admin := range checker.Admins {
+		if strings.EqualFold(admin, viewer.Login) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// VisibleRuns returns the runs that the viewer may see.
+func (checker *Checker) VisibleRuns(ctx context.Context, viewer *models.User, runs []*models.Run) ([]*models.Run, error) {
+	visible := []*models.Run{}
+	for _, run := range runs {
+		ok, err := checker.CanView(ctx, viewer, run)
+		if err != nil {
+			return nil, fmt.Errorf("check run %s: %w", run.ID, err)
+		}
+
+		if ok {
+			visible = append(visible, run)
+		}
+	}
+
+	return visible, nil
+}
+
+// IsCollaborator returns true if the user is a collaborator on the GitHub
+// repo. It returns false if the app isn't installed on the repo.
+func (checker *Checker) IsCollaborator(ctx context.Context, fullName, login string) (bool, error) {
+	return checker.cached(ctx, "collaborator", fullName, login, func(client *github.Client, owner, name string) (bool, error) {
+		is, _, err := client.Repositories.IsCollaborator(ctx, owner, name, login)
+		if err != nil {
+			return false, fmt.Errorf("check collaborator: %w", err)
+		}
+
+		return is, nil
+	})
+}
+
+func (checker *Checker) canPush(ctx context.Context, fullName, login string) (bool, error) {
+	return checker.cached(ctx, "push", fullName, login, func(client *github.Client, owner, name string) (bool, error) {
+		level, resp, err := client.Repositories.GetPermissionLevel(ctx, owner, name, login)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				// not a GitHub user anymore
+				return false, nil
+			}
+
+			return false, fmt.Errorf("get permission level: %w", err)
+		}
+
+		return pushPermissions[level.GetPermission()], nil
+	})
+}
+
+// IsOrgMember returns true if the user is a member of the GitHub org. It
+// returns false if the app isn't installed on the org.
+func (checker *Checker) IsOrgMember(ctx context.Context, org, login string) (bool, error) {
+	return checker.remember("member:"+org+":"+login, func() (bool, error) {
+		inst, resp, err := checker.appClient().Apps.FindOrganizationInstallation(ctx, org)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				// app is no longer installed; nobody can be checked
+				return false, nil
+			}
+
+			return false, fmt.Errorf("find installation: %w", err)
+		}
+
+		is, _, err := checker.installationClient(inst).Organizations.IsMember(ctx, org, login)
+		if err != nil {
+			return false, fmt.Errorf("check membership: %w", err)
+		}
+
+		return is, nil
+	})
+}
+
+// cached runs a check against the repo as the app's installation,
+// remembering the result for a bit.
+func (checker *Checker) cached(ctx context.Context, kind, fullName, login string, check func(*github.Client, string, string) (bool, error)) (bool, error) {
+	return checker.remember(kind+":"+fullName+":"+login, func() (bool, error) {
+		owner, name, _ := strings.Cut(fullName, "/")
+
+		inst, resp, err := checker.appClient().Apps.FindRepositoryInstallation(ctx, owner, name)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				// app is no longer installed; nobody can be checked
+				return false, nil
+			}
+
+			return false, fmt.Errorf("find installation: %w", err)
+		}
+
+		return check(checker.installationClient(inst), owner, name)
+	})
+}
+
+// remember runs the check, remembering its result for a bit.
+func (checker *Checker) remember(key string, check func() (bool, error)) (bool, error) {
+	key = strings.ToLower(key)
+
+	checker.collaboratorsL.Lock()
+	cached, found := checker.collaborators[key]
+	checker.collaboratorsL.Unlock()
+
+	if found && time.Since(cached.checkedAt) < collaboratorTTL {
+		return cached.is, nil
+	}
+
+	is, err := check()
+	if err != nil {
+		return false, err
+	}
+
+	checker.collaboratorsL.Lock()
+	checker.collaborators[key] = collaborator{
+		is:        is,
+		checkedAt: time.Now(),
+	}
+	checker.collaboratorsL.Unlock()
+
+	return is, nil
+}
+
+func (checker *Checker) appClient() *github.Client {
+	return github.NewClient(&http.Client{
+		Transport: checker.Transport,
+	})
+}
+
+func (checker *Checker) installationClient(inst *github.Installation) *github.Client {
+	return github.NewClient(&http.Client{
+		Transport: ghinstallation.NewFromAppsTransport(checker.Transport, inst.GetID()),
+	})
+}
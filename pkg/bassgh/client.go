@@ -3,9 +3,13 @@ package bassgh
 import (
 	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v43/github"
@@ -13,6 +17,8 @@ import (
 	"github.com/opencontainers/go-digest"
 	"github.com/vito/bass-loop/pkg/blobs"
 	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/pool"
+	"github.com/vito/bass-loop/pkg/queue"
 	"github.com/vito/bass-loop/pkg/runs"
 	"github.com/vito/bass/pkg/bass"
 	"github.com/vito/bass/pkg/cli"
@@ -26,12 +32,63 @@ type Client struct {
 	ExternalURL *url.URL
 	DB          models.DB
 	Blobs       *blobs.Bucket
+	Streams     *runs.Streams
+	Active      *runs.Active
+	Redactor    *runs.Redactor
 	GH          *github.Client
 	Sender      *github.User
 	Repo        *github.Repository
 	Meta        models.Meta
+
+	// holds checks which are waiting for a runtime, so that they're resumed
+	// after a restart
+	Queue *queue.Queue
+
+	// the installation and runtime pools the event was dispatched with, saved
+	// with held checks so that they can be resumed
+	InstallationID int64
+	Runners        []string
+
+	// loads the runtime pool for checks that are waiting for a runtime
+	LoadPool func(context.Context) (*pool.Pool, error)
+
+	// how long a check waits for a runtime before it times out
+	RunnerTimeout time.Duration
 }
 
+// DefaultRunnerTimeout is how long a check waits for a runtime by default.
+const DefaultRunnerTimeout = 24 * time.Hour
+
+// how often a queued check looks for a runtime to run on
+const awaitInterval = 10 * time.Second
+
+// HeldCheckIntegration is the integration of deliveries which hold checks
+// waiting for a runtime.
+const HeldCheckIntegration = "github-check"
+
+// HeldCheckEvent is the event of deliveries which hold checks waiting for a
+// runtime.
+const HeldCheckEvent = "check"
+
+// ErrNoRuntime is returned when a check gives up waiting for a runtime.
+var ErrNoRuntime = errors.New("no runtime available")
+
+// HeldCheck is the payload of a delivery which holds a check waiting for a
+// runtime. The check run's ID is saved on the delivery.
+type HeldCheck struct {
+	RunID          string             `json:"run_id"`
+	CheckName      string             `json:"check_name"`
+	InstallationID int64              `json:"installation_id"`
+	Repo           *github.Repository `json:"repo"`
+	Sender         *github.User       `json:"sender"`
+	Runners        []string           `json:"runners"`
+	Meta           models.Meta        `json:"meta"`
+}
+
+// CancelActionIdentifier identifies the check run action for cancelling a
+// run.
+const CancelActionIdentifier = "cancel"
+
 func (client *Client) Module() *bass.Scope {
 	ghscope := bass.NewEmptyScope()
 	ghscope.Set("start-check",
@@ -40,7 +97,26 @@ func (client *Client) Module() *bass.Scope {
 	return ghscope
 }
 
-func (client *Client) StartCheck(ctx context.Context, thunk bass.Thunk, checkName, sha string) (bass.Combiner, error) {
+// StartCheck starts running the thunk and creates a check run for it,
+// returning a combiner which waits for the thunk to finish and concludes the
+// check run.
+//
+// If no runtime can run the thunk yet, the check is created as queued and
+// waits for one, held in the delivery queue so that it's resumed after a
+// restart. The combiner waits for it to run just the same.
+func (client *Client) StartCheck(ctx context.Context, thunk bass.Thunk, checkName, sha string) (_ bass.Combiner, err error) {
+	logger := zapctx.FromContext(ctx)
+
+	required, err := pool.RequiredLabels(thunk)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, runtimePool, err := pool.WithRequired(ctx, required)
+	if err != nil {
+		return nil, err
+	}
+
 	run, err := models.CreateThunkRun(ctx, client.DB, client.Sender, thunk, models.Meta{
 		"github": client.Meta,
 		"check": models.Meta{
@@ -51,6 +127,376 @@ func (client *Client) StartCheck(ctx context.Context, thunk bass.Thunk, checkNam
 		return nil, fmt.Errorf("create thunk run: %w", err)
 	}
 
+	client.Redactor.Register(run.ID, thunk)
+	defer func() {
+		if err != nil {
+			// the run will never be recorded
+			client.Redactor.Forget(run.ID)
+		}
+	}()
+
+	output, err := client.checkOutput(thunk, run)
+	if err != nil {
+		return nil, err
+	}
+
+	runURL, err := client.ExternalURL.Parse("/runs/" + run.ID)
+	if err != nil {
+		return nil, fmt.Errorf("create thunk run: %w", err)
+	}
+
+	status := "in_progress"
+	canRun := runtimePool.CanRun(thunk)
+	if !canRun {
+		status = "queued"
+	}
+
+	opts := github.CreateCheckRunOptions{
+		Name:       checkName,
+		HeadSHA:    sha,
+		Status:     github.String(status),
+		ExternalID: github.String(run.ID),
+		DetailsURL: github.String(runURL.String()),
+		Output:     output,
+		Actions: []*github.CheckRunAction{
+			{
+				Label:       "Cancel",
+				Description: "Cancel this run.",
+				Identifier:  CancelActionIdentifier,
+			},
+		},
+	}
+
+	if canRun {
+		opts.StartedAt = &github.Timestamp{Time: time.Now()}
+	}
+
+	checkRun, _, err := client.GH.Checks.CreateCheckRun(ctx, client.Repo.GetOwner().GetLogin(), client.Repo.GetName(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("create check run: %w", err)
+	}
+
+	if canRun {
+		return client.runCheck(ctx, run, thunk, checkName, checkRun.GetID(), output)
+	}
+
+	logger.Info("no runtime available; queueing check",
+		zap.String("check", checkName),
+		zap.Stringer("labels", required))
+
+	delivery, err := client.hold(ctx, run, checkName, checkRun.GetID())
+	if err != nil {
+		return nil, err
+	}
+
+	return client.await(ctx, delivery, run, thunk, checkName, output), nil
+}
+
+// hold stores a queued check as a delivery held by this node, so that it's
+// resumed by ResumeCheck if the process stops before the check runs.
+func (client *Client) hold(ctx context.Context, run *models.Run, checkName string, checkRunID int64) (*models.Delivery, error) {
+	payload, err := json.Marshal(HeldCheck{
+		RunID:          run.ID,
+		CheckName:      checkName,
+		InstallationID: client.InstallationID,
+		Repo:           client.Repo,
+		Sender:         client.Sender,
+		Runners:        client.Runners,
+		Meta:           client.Meta,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal held check: %w", err)
+	}
+
+	delivery := &models.Delivery{
+		ID:          "check:" + run.ID,
+		Integration: HeldCheckIntegration,
+		Event:       HeldCheckEvent,
+		Payload:     payload,
+		CheckRunID:  sql.NullInt64{Int64: checkRunID, Valid: true},
+	}
+
+	if err := client.Queue.Hold(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("hold check: %w", err)
+	}
+
+	return delivery, nil
+}
+
+// await waits for a runtime and then runs the queued check, returning a
+// combiner which waits for the check's result.
+//
+// The wait is tracked along with the hook's other runs, so the hook doesn't
+// finish until the check does, and fails if the check fails or never runs.
+func (client *Client) await(ctx context.Context, delivery *models.Delivery, run *models.Run, thunk bass.Thunk, checkName string, output *github.CheckRunOutput) bass.Combiner {
+	ctx, stop := context.WithCancel(ctx)
+
+	ctx = bass.ForkTrace(ctx) // each goroutine must have its own trace
+
+	logger := zapctx.FromContext(ctx).With(
+		zap.String("run", run.ID),
+		zap.String("check", checkName))
+
+	var waitErr error
+
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	bass.RunsFromContext(ctx).Go(stop, func() error {
+		defer wg.Done()
+
+		waitErr = client.waitAndRun(ctx, delivery, run, thunk, checkName, output)
+		if waitErr != nil {
+			logger.Error("queued check failed", zap.Error(waitErr))
+
+			// the run may have never been recorded
+			client.Redactor.Forget(run.ID)
+		}
+
+		if err := client.Queue.Finish(delivery, waitErr); err != nil {
+			logger.Error("failed to conclude held check", zap.Error(err))
+		}
+
+		return waitErr
+	})
+
+	return bass.Func(thunk.String(), "[]", func() (bass.Value, error) {
+		wg.Wait()
+		return bass.Null{}, waitErr
+	})
+}
+
+func (client *Client) waitAndRun(ctx context.Context, delivery *models.Delivery, run *models.Run, thunk bass.Thunk, checkName string, output *github.CheckRunOutput) error {
+	logger := zapctx.FromContext(ctx)
+
+	required, err := pool.RequiredLabels(thunk)
+	if err != nil {
+		return err
+	}
+
+	checkRunID := delivery.CheckRunID.Int64
+
+	expiresAt := delivery.CreatedAt.Time().Add(client.runnerTimeout())
+
+	// allow the check to be cancelled while it waits
+	waitCtx, untrack := client.Active.Track(ctx, run.ID)
+	defer untrack()
+
+	ticker := time.NewTicker(awaitInterval)
+	defer ticker.Stop()
+
+	var runtimePool *pool.Pool
+	for {
+		runtimePool, err = client.loadRuntimes(ctx, thunk, required)
+		if err != nil {
+			logger.Warn("failed to load runtimes", zap.Error(err))
+		} else if runtimePool != nil {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+			if time.Now().After(expiresAt) {
+				logger.Warn("timed out waiting for a runtime")
+
+				if err := client.concludeQueued(ctx, run, checkName, checkRunID, output, "timed_out", "no runner available"); err != nil {
+					return err
+				}
+
+				return fmt.Errorf("check %s: %w", checkName, ErrNoRuntime)
+			}
+		case <-waitCtx.Done():
+			logger.Info("cancelled while waiting for a runtime")
+
+			// the hook itself may have been cancelled
+			ctx = detach(ctx)
+
+			if err := client.concludeQueued(ctx, run, checkName, checkRunID, output, "cancelled", "cancelled while waiting for a runner"); err != nil {
+				return err
+			}
+
+			return fmt.Errorf("check %s: cancelled while waiting for a runtime", checkName)
+		}
+	}
+	defer runtimePool.Close()
+
+	untrack()
+
+	logger.Info("runtime available; starting queued check")
+
+	return client.startQueued(ctx, delivery, run, thunk, checkName, output, runtimePool.Filter(required))
+}
+
+// ResumeCheck resumes a check which was waiting for a runtime when the process
+// stopped, running it if a runtime is available.
+//
+// Until then the delivery is postponed, and once the runner timeout elapses
+// the check is concluded as timed out and the delivery is abandoned.
+func (client *Client) ResumeCheck(ctx context.Context, delivery *models.Delivery, held HeldCheck) error {
+	logger := zapctx.FromContext(ctx).With(
+		zap.String("run", held.RunID),
+		zap.String("check", held.CheckName))
+
+	run, err := models.RunByID(ctx, client.DB, held.RunID)
+	if err != nil {
+		return fmt.Errorf("get run: %w", err)
+	}
+
+	if run.EndTime != nil {
+		logger.Info("check already concluded")
+		return nil
+	}
+
+	dbThunk, err := run.Thunk(ctx, client.DB)
+	if err != nil {
+		return fmt.Errorf("get thunk: %w", err)
+	}
+
+	var thunk bass.Thunk
+	if err := bass.UnmarshalJSON(dbThunk.JSON, &thunk); err != nil {
+		return fmt.Errorf("unmarshal thunk: %w", err)
+	}
+
+	required, err := pool.RequiredLabels(thunk)
+	if err != nil {
+		return err
+	}
+
+	output, err := client.checkOutput(thunk, run)
+	if err != nil {
+		return err
+	}
+
+	if time.Since(delivery.CreatedAt.Time()) > client.runnerTimeout() {
+		logger.Warn("timed out waiting for a runtime")
+
+		if err := client.concludeQueued(ctx, run, held.CheckName, delivery.CheckRunID.Int64, output, "timed_out", "no runner available"); err != nil {
+			return err
+		}
+
+		return queue.Abandon(ErrNoRuntime)
+	}
+
+	runtimePool, err := client.loadRuntimes(ctx, thunk, required)
+	if err != nil {
+		return fmt.Errorf("load runtimes: %w", err)
+	}
+
+	if runtimePool == nil {
+		logger.Info("no runtime available; postponing check")
+		return queue.Postpone(ErrNoRuntime)
+	}
+
+	defer runtimePool.Close()
+
+	logger.Info("runtime available; starting resumed check")
+
+	client.Redactor.Register(run.ID, thunk)
+
+	err = client.startQueued(ctx, delivery, run, thunk, held.CheckName, output, runtimePool.Filter(required))
+	if err != nil {
+		// the run may have never been recorded
+		client.Redactor.Forget(run.ID)
+	}
+
+	return err
+}
+
+// loadRuntimes loads the runtime pool, returning nil if none of its runtimes
+// can run the thunk.
+func (client *Client) loadRuntimes(ctx context.Context, thunk bass.Thunk, required models.Labels) (*pool.Pool, error) {
+	runtimePool, err := client.LoadPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !runtimePool.Filter(required).CanRun(thunk) {
+		runtimePool.Close()
+		return nil, nil
+	}
+
+	return runtimePool, nil
+}
+
+// startQueued runs a queued check now that a runtime is available, waiting for
+// it to finish.
+func (client *Client) startQueued(ctx context.Context, delivery *models.Delivery, run *models.Run, thunk bass.Thunk, checkName string, output *github.CheckRunOutput, runtimePool bass.RuntimePool) error {
+	// save the run right away so that the check isn't run again if the process
+	// stops partway through it
+	delivery.RunID = sql.NullString{String: run.ID, Valid: true}
+	if err := delivery.Update(ctx, client.DB); err != nil {
+		return fmt.Errorf("update delivery: %w", err)
+	}
+
+	_, _, err := client.GH.Checks.UpdateCheckRun(
+		ctx,
+		client.Repo.GetOwner().GetLogin(),
+		client.Repo.GetName(),
+		delivery.CheckRunID.Int64,
+		github.UpdateCheckRunOptions{
+			Name:   checkName,
+			Status: github.String("in_progress"),
+			Output: output,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("update check run: %w", err)
+	}
+
+	ctx = bass.WithRuntimePool(ctx, runtimePool)
+
+	// the check is waited on below rather than along with the hook's runs
+	ctx, _ = bass.TrackRuns(ctx)
+
+	comb, err := client.runCheck(ctx, run, thunk, checkName, delivery.CheckRunID.Int64, output)
+	if err != nil {
+		return err
+	}
+
+	_, err = bass.Trampoline(ctx, comb.Call(ctx, bass.Empty{}, bass.NewEmptyScope(), bass.Identity))
+	return err
+}
+
+func (client *Client) runnerTimeout() time.Duration {
+	if client.RunnerTimeout == 0 {
+		return DefaultRunnerTimeout
+	}
+
+	return client.RunnerTimeout
+}
+
+// concludeQueued completes a check that never got to run.
+func (client *Client) concludeQueued(ctx context.Context, run *models.Run, checkName string, checkRunID int64, output *github.CheckRunOutput, conclusion, reason string) error {
+	if conclusion == "cancelled" {
+		run.Cancelled = 1
+	}
+
+	if err := runs.Record(ctx, client.DB, client.Blobs, client.Redactor, run, progrock.NewTape(), false); err != nil {
+		return fmt.Errorf("failed to complete: %w", err)
+	}
+
+	output.Text = github.String(reason)
+
+	_, _, err := client.GH.Checks.UpdateCheckRun(
+		ctx,
+		client.Repo.GetOwner().GetLogin(),
+		client.Repo.GetName(),
+		checkRunID,
+		github.UpdateCheckRunOptions{
+			Name:        checkName,
+			Status:      github.String("completed"),
+			Conclusion:  github.String(conclusion),
+			CompletedAt: &github.Timestamp{Time: run.EndTime.Time()},
+			Output:      output,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("update check run: %w", err)
+	}
+
+	return nil
+}
+
+func (client *Client) checkOutput(thunk bass.Thunk, run *models.Run) (*github.CheckRunOutput, error) {
 	thunkURL, err := client.ExternalURL.Parse("/thunks/" + thunk.Name())
 	if err != nil {
 		return nil, fmt.Errorf("create thunk run: %w", err)
@@ -61,7 +507,7 @@ func (client *Client) StartCheck(ctx context.Context, thunk bass.Thunk, checkNam
 		return nil, fmt.Errorf("create thunk run: %w", err)
 	}
 
-	output := &github.CheckRunOutput{
+	return &github.CheckRunOutput{
 		Title: github.String(thunk.Cmdline()),
 		Summary: github.String(strings.Join([]string{
 			`* **thunk** [` + thunk.Name() + `](` + thunkURL.String() + `)`,
@@ -72,31 +518,27 @@ func (client *Client) StartCheck(ctx context.Context, thunk bass.Thunk, checkNam
 			thunk.Cmdline(),
 			"```",
 		}, "\n")),
-	}
-
-	checkRun, _, err := client.GH.Checks.CreateCheckRun(ctx, client.Repo.GetOwner().GetLogin(), client.Repo.GetName(), github.CreateCheckRunOptions{
-		Name:       checkName,
-		HeadSHA:    sha,
-		Status:     github.String("in_progress"),
-		StartedAt:  &github.Timestamp{Time: time.Now()},
-		ExternalID: github.String(run.ID),
-		DetailsURL: github.String(runURL.String()),
-		Output:     output,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("create check run: %w", err)
-	}
+	}, nil
+}
 
+// runCheck starts the thunk and returns a combiner which waits for it to
+// finish and concludes the check run with its result.
+func (client *Client) runCheck(ctx context.Context, run *models.Run, thunk bass.Thunk, checkName string, checkRunID int64, output *github.CheckRunOutput) (bass.Combiner, error) {
 	tape := progrock.NewTape()
-	recorder := progrock.NewRecorder(tape)
-	thunkCtx := progrock.RecorderToContext(ctx, recorder)
+	redaction := client.Redactor.Redaction(run.ID)
+	stream := client.Streams.Start(run.ID, redaction)
+	recorder := progrock.NewRecorder(progrock.MultiWriter{tape, stream})
+	thunkCtx, untrack := client.Active.Track(ctx, run.ID)
+	thunkCtx = progrock.RecorderToContext(thunkCtx, recorder)
 
 	metaVtx := recorder.Vertex(digest.Digest("check:"+checkName), "[check] "+checkName)
 	stderr := metaVtx.Stderr()
 	thunkCtx = ioctx.StderrToContext(thunkCtx, stderr)
 	thunkCtx = zapctx.ToContext(thunkCtx, bass.LoggerTo(stderr, zap.DebugLevel))
 
-	return thunk.Start(thunkCtx, bass.Func("handler", "[err]", func(ctx context.Context, merr bass.Value) error {
+	comb, err := thunk.Start(thunkCtx, bass.Func("handler", "[err]", func(ctx context.Context, merr bass.Value) error {
+		defer untrack()
+
 		var errv bass.Error
 		if err := merr.Decode(&errv); err == nil {
 			cli.WriteError(thunkCtx, errv.Err)
@@ -105,19 +547,26 @@ func (client *Client) StartCheck(ctx context.Context, thunk bass.Thunk, checkNam
 		metaVtx.Done(errv.Err)
 
 		ok := errv.Err == nil
+		cancelled := !ok && thunkCtx.Err() != nil
+		if cancelled {
+			run.Cancelled = 1
+		}
 
-		if err := runs.Record(ctx, client.DB, client.Blobs, run, tape, ok); err != nil {
+		defer stream.Close()
+
+		if err := runs.Record(ctx, client.DB, client.Blobs, client.Redactor, run, tape, ok); err != nil {
 			return fmt.Errorf("failed to complete: %w", err)
 		}
 
 		outBuf := new(bytes.Buffer)
 		tape.Render(colorable.NewNonColorable(outBuf), cli.ProgressUI)
-		output.Text = github.String("```\n" + outBuf.String() + "\n```")
+		text, _ := redaction.Redact(outBuf.Bytes())
+		output.Text = github.String("```\n" + string(text) + "\n```")
 
 		var conclusion string
 		if ok {
 			conclusion = "success"
-		} else if thunkCtx.Err() != nil {
+		} else if cancelled {
 			conclusion = "cancelled"
 		} else {
 			conclusion = "failure"
@@ -127,7 +576,7 @@ func (client *Client) StartCheck(ctx context.Context, thunk bass.Thunk, checkNam
 			ctx,
 			client.Repo.GetOwner().GetLogin(),
 			client.Repo.GetName(),
-			checkRun.GetID(),
+			checkRunID,
 			github.UpdateCheckRunOptions{
 				Name:        checkName,
 				Status:      github.String("completed"),
@@ -150,4 +599,20 @@ func (client *Client) StartCheck(ctx context.Context, thunk bass.Thunk, checkNam
 		// too much logging
 		return fmt.Errorf("check %s: %s failed: %w", checkName, thunk, errv.Err)
 	}))
+	if err != nil {
+		// the handler will never be called
+		untrack()
+		stream.Close()
+		return nil, err
+	}
+
+	return comb, nil
+}
+
+// detach returns a context for work which must finish even if the hook that
+// started it was cancelled, keeping its logger.
+func detach(ctx context.Context) context.Context {
+	// each concurrent Bass must have its own trace
+	detached := bass.WithTrace(context.Background(), &bass.Trace{})
+	return zapctx.ToContext(detached, zapctx.FromContext(ctx))
 }
@@ -0,0 +1,267 @@
+// Package bassgitea runs checks for repos hosted on Gitea, reporting them
+// through Gitea's commit status API.
+package bassgitea
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrNotFound is returned when the API responds with 404 Not Found.
+var ErrNotFound = errors.New("not found")
+
+// API is a minimal client for Gitea's REST API.
+type API struct {
+	// URL is the Gitea server's URL, e.g. https://gitea.example.com.
+	URL *url.URL
+
+	// Token is an access token for the API.
+	Token string
+
+	HTTP *http.Client
+}
+
+// User is a Gitea user.
+type User struct {
+	ID       int64  `json:"id"`
+	Login    string `json:"login"`
+	Username string `json:"username"`
+	HTMLURL  string `json:"html_url"`
+}
+
+// GetLogin returns the user's login.
+func (user *User) GetLogin() string {
+	if user == nil {
+		return ""
+	}
+
+	if user.Login != "" {
+		return user.Login
+	}
+
+	return user.Username
+}
+
+// Repository is a Gitea repository.
+type Repository struct {
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	FullName      string `json:"full_name"`
+	Owner         *User  `json:"owner"`
+	HTMLURL       string `json:"html_url"`
+	CloneURL      string `json:"clone_url"`
+	DefaultBranch string `json:"default_branch"`
+	Private       bool   `json:"private"`
+}
+
+// CommitStatus states.
+const (
+	StatusPending = "pending"
+	StatusSuccess = "success"
+	StatusError   = "error"
+	StatusFailure = "failure"
+)
+
+// CommitStatus is the status of a commit for a given context, i.e. a check.
+type CommitStatus struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description,omitempty"`
+	Context     string `json:"context"`
+}
+
+// CreateStatus sets the status of a commit for the status's context.
+func (api *API) CreateStatus(ctx context.Context, repo *Repository, sha string, status CommitStatus) error {
+	return api.do(ctx, http.MethodPost, repoPath(repo, "statuses", sha), nil, status, nil)
+}
+
+// GetBranch returns the sha of the branch's head commit.
+func (api *API) GetBranch(ctx context.Context, repo *Repository, branch string) (string, error) {
+	var res struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+
+	if err := api.do(ctx, http.MethodGet, repoPath(repo, "branches", branch), nil, nil, &res); err != nil {
+		return "", err
+	}
+
+	return res.Commit.ID, nil
+}
+
+// GetRepo returns the repository with the given owner and name.
+func (api *API) GetRepo(ctx context.Context, owner, name string) (*Repository, error) {
+	var repo *Repository
+	path := "repos/" + url.PathEscape(owner) + "/" + url.PathEscape(name)
+	if err := api.do(ctx, http.MethodGet, path, nil, nil, &repo); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// GetCommitSHA returns the sha of the commit the ref points to, which may be
+// a branch, a tag, or a sha.
+func (api *API) GetCommitSHA(ctx context.Context, repo *Repository, ref string) (string, error) {
+	var commits []struct {
+		SHA string `json:"sha"`
+	}
+
+	query := url.Values{
+		"sha":   {ref},
+		"limit": {"1"},
+	}
+
+	if err := api.do(ctx, http.MethodGet, repoPath(repo, "commits"), query, nil, &commits); err != nil {
+		return "", err
+	}
+
+	if len(commits) == 0 {
+		return "", fmt.Errorf("get commit %s: %w", ref, ErrNotFound)
+	}
+
+	return commits[0].SHA, nil
+}
+
+// Content is a file or directory in a repository.
+type Content struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Size    int64  `json:"size"`
+	Content string `json:"content"`
+}
+
+// GetContents returns the contents of the file at the path, or of each
+// entry in the directory at the path.
+func (api *API) GetContents(ctx context.Context, repo *Repository, path, ref string) (*Content, []*Content, error) {
+	var raw json.RawMessage
+	err := api.do(ctx, http.MethodGet, repoPath(repo, "contents", path), url.Values{"ref": {ref}}, nil, &raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		var dir []*Content
+		if err := json.Unmarshal(raw, &dir); err != nil {
+			return nil, nil, fmt.Errorf("unmarshal directory: %w", err)
+		}
+
+		return nil, dir, nil
+	}
+
+	var file *Content
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal file: %w", err)
+	}
+
+	return file, nil, nil
+}
+
+// GetRaw returns the raw content of the file at the path.
+func (api *API) GetRaw(ctx context.Context, repo *Repository, path, ref string) ([]byte, error) {
+	var content []byte
+	err := api.do(ctx, http.MethodGet, repoPath(repo, "raw", path), url.Values{"ref": {ref}}, nil, &content)
+	if err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
+
+func repoPath(repo *Repository, segments ...string) string {
+	escaped := []string{
+		"repos",
+		url.PathEscape(repo.Owner.GetLogin()),
+		url.PathEscape(repo.Name),
+	}
+
+	for _, seg := range segments {
+		for _, part := range strings.Split(seg, "/") {
+			escaped = append(escaped, url.PathEscape(part))
+		}
+	}
+
+	return strings.Join(escaped, "/")
+}
+
+// do sends a request to the API, encoding the body as JSON and decoding the
+// response into dest.
+//
+// If dest is a *[]byte the response body is returned as-is.
+func (api *API) do(ctx context.Context, method, path string, query url.Values, body, dest any) error {
+	endpoint := api.URL.JoinPath("api", "v1", path)
+	endpoint.RawQuery = query.Encode()
+
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal request: %w", err)
+		}
+
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), reqBody)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if api.Token != "" {
+		req.Header.Set("Authorization", "token "+api.Token)
+	}
+
+	client := api.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s %s: %w", method, path, ErrNotFound)
+	}
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, res.Status, strings.TrimSpace(string(resBody)))
+	}
+
+	switch x := dest.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*x = resBody
+		return nil
+	default:
+		if err := json.Unmarshal(resBody, dest); err != nil {
+			return fmt.Errorf("unmarshal response: %w", err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+package bassgitea
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAPI(t *testing.T) {
+	ctx := context.Background()
+
+	repo := &Repository{
+		Name:  "bass",
+		Owner: &User{Login: "vito"},
+	}
+
+	var statuses []CommitStatus
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/repos/vito/bass/statuses/abc123", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if auth := r.Header.Get("Authorization"); auth != "token mytoken" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var status CommitStatus
+		if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		statuses = append(statuses, status)
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/api/v1/repos/vito/bass/raw/bass/loop.json", func(w http.ResponseWriter, r *http.Request) {
+		if ref := r.URL.Query().Get("ref"); ref != "main" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(`{"runners":["sender"]}`))
+	})
+	mux.HandleFunc("/api/v1/repos/vito/bass/branches/main", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"commit":{"id":"abc123"}}`))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	srvURL, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := &API{
+		URL:   srvURL,
+		Token: "mytoken",
+	}
+
+	t.Run("CreateStatus", func(t *testing.T) {
+		status := CommitStatus{
+			State:       StatusSuccess,
+			TargetURL:   "https://loop.example.com/runs/some-run",
+			Description: "Succeeded",
+			Context:     "test",
+		}
+
+		if err := api.CreateStatus(ctx, repo, "abc123", status); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(statuses) != 1 || statuses[0] != status {
+			t.Errorf("expected status %+v to be created, got %+v", status, statuses)
+		}
+	})
+
+	t.Run("CreateStatus unauthorized", func(t *testing.T) {
+		unauthorized := &API{URL: srvURL}
+
+		err := unauthorized.CreateStatus(ctx, repo, "abc123", CommitStatus{State: StatusPending})
+		if err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("GetRaw", func(t *testing.T) {
+		content, err := api.GetRaw(ctx, repo, "bass/loop.json", "main")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(content) != `{"runners":["sender"]}` {
+			t.Errorf("unexpected content: %q", string(content))
+		}
+	})
+
+	t.Run("GetRaw not found", func(t *testing.T) {
+		_, err := api.GetRaw(ctx, repo, "bass/loop.json", "other")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected %q, got %v", ErrNotFound, err)
+		}
+	})
+
+	t.Run("GetBranch", func(t *testing.T) {
+		sha, err := api.GetBranch(ctx, repo, "main")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if sha != "abc123" {
+			t.Errorf("expected sha %q, got %q", "abc123", sha)
+		}
+	})
+}
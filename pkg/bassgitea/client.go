@@ -0,0 +1,507 @@
+package bassgitea
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v43/github"
+	"github.com/opencontainers/go-digest"
+	"github.com/vito/bass-loop/pkg/blobs"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/pool"
+	"github.com/vito/bass-loop/pkg/queue"
+	"github.com/vito/bass-loop/pkg/runs"
+	"github.com/vito/bass/pkg/bass"
+	"github.com/vito/bass/pkg/cli"
+	"github.com/vito/bass/pkg/ioctx"
+	"github.com/vito/bass/pkg/zapctx"
+	"github.com/vito/progrock"
+	"go.uber.org/zap"
+)
+
+// Client runs checks for a Gitea repo, reporting them as commit statuses.
+type Client struct {
+	ExternalURL *url.URL
+	DB          models.DB
+	Blobs       *blobs.Bucket
+	Streams     *runs.Streams
+	Active      *runs.Active
+	Redactor    *runs.Redactor
+	API         *API
+	Sender      *github.User
+	Repo        *Repository
+	Meta        models.Meta
+
+	// holds checks which are waiting for a runtime, so that they're resumed
+	// after a restart
+	Queue *queue.Queue
+
+	// the runtime pools the event was dispatched with, saved with held checks
+	// so that they can be resumed
+	Runners []string
+
+	// loads the runtime pool for checks that are waiting for a runtime
+	LoadPool func(context.Context) (*pool.Pool, error)
+
+	// how long a check waits for a runtime before it times out
+	RunnerTimeout time.Duration
+}
+
+// DefaultRunnerTimeout is how long a check waits for a runtime by default.
+const DefaultRunnerTimeout = 24 * time.Hour
+
+// how often a waiting check looks for a runtime to run on
+const awaitInterval = 10 * time.Second
+
+// HeldCheckIntegration is the integration of deliveries which hold checks
+// waiting for a runtime.
+const HeldCheckIntegration = "gitea-check"
+
+// HeldCheckEvent is the event of deliveries which hold checks waiting for a
+// runtime.
+const HeldCheckEvent = "check"
+
+// ErrNoRuntime is returned when a check gives up waiting for a runtime.
+var ErrNoRuntime = errors.New("no runtime available")
+
+// HeldCheck is the payload of a delivery which holds a check waiting for a
+// runtime.
+type HeldCheck struct {
+	RunID     string       `json:"run_id"`
+	CheckName string       `json:"check_name"`
+	SHA       string       `json:"sha"`
+	Repo      *Repository  `json:"repo"`
+	Sender    *github.User `json:"sender"`
+	Runners   []string     `json:"runners"`
+	Meta      models.Meta  `json:"meta"`
+}
+
+func (client *Client) Module() *bass.Scope {
+	scope := bass.NewEmptyScope()
+	scope.Set("start-check",
+		bass.Func("start-check", "[thunk name sha]", client.StartCheck))
+
+	return scope
+}
+
+// StartCheck starts running the thunk and sets a pending status on the
+// commit, returning a combiner which waits for the thunk to finish and sets
+// the final status.
+//
+// If no runtime can run the thunk yet, the check waits for one, held in the
+// delivery queue so that it's resumed after a restart. The combiner waits for
+// it to run just the same.
+func (client *Client) StartCheck(ctx context.Context, thunk bass.Thunk, checkName, sha string) (_ bass.Combiner, err error) {
+	logger := zapctx.FromContext(ctx)
+
+	required, err := pool.RequiredLabels(thunk)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, runtimePool, err := pool.WithRequired(ctx, required)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := models.CreateThunkRun(ctx, client.DB, client.Sender, thunk, models.Meta{
+		"gitea": client.Meta,
+		"check": models.Meta{
+			"name": checkName,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create thunk run: %w", err)
+	}
+
+	client.Redactor.Register(run.ID, thunk)
+	defer func() {
+		if err != nil {
+			// the run will never be recorded
+			client.Redactor.Forget(run.ID)
+		}
+	}()
+
+	if runtimePool.CanRun(thunk) {
+		return client.runCheck(ctx, run, thunk, checkName, sha)
+	}
+
+	logger.Info("no runtime available; waiting",
+		zap.String("check", checkName),
+		zap.Stringer("labels", required))
+
+	if err := client.setStatus(ctx, run, checkName, sha, StatusPending, "Waiting for a runner"); err != nil {
+		return nil, err
+	}
+
+	delivery, err := client.hold(ctx, run, checkName, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.await(ctx, delivery, run, thunk, checkName, sha), nil
+}
+
+// hold stores a waiting check as a delivery held by this node, so that it's
+// resumed by ResumeCheck if the process stops before the check runs.
+func (client *Client) hold(ctx context.Context, run *models.Run, checkName, sha string) (*models.Delivery, error) {
+	payload, err := json.Marshal(HeldCheck{
+		RunID:     run.ID,
+		CheckName: checkName,
+		SHA:       sha,
+		Repo:      client.Repo,
+		Sender:    client.Sender,
+		Runners:   client.Runners,
+		Meta:      client.Meta,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal held check: %w", err)
+	}
+
+	delivery := &models.Delivery{
+		ID:          "check:" + run.ID,
+		Integration: HeldCheckIntegration,
+		Event:       HeldCheckEvent,
+		Payload:     payload,
+	}
+
+	if err := client.Queue.Hold(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("hold check: %w", err)
+	}
+
+	return delivery, nil
+}
+
+// await waits for a runtime and then runs the waiting check, returning a
+// combiner which waits for the check's result.
+//
+// The wait is tracked along with the hook's other runs, so the hook doesn't
+// finish until the check does, and fails if the check fails or never runs.
+func (client *Client) await(ctx context.Context, delivery *models.Delivery, run *models.Run, thunk bass.Thunk, checkName, sha string) bass.Combiner {
+	ctx, stop := context.WithCancel(ctx)
+
+	ctx = bass.ForkTrace(ctx) // each goroutine must have its own trace
+
+	logger := zapctx.FromContext(ctx).With(
+		zap.String("run", run.ID),
+		zap.String("check", checkName))
+
+	var waitErr error
+
+	wg := new(sync.WaitGroup)
+	wg.Add(1)
+	bass.RunsFromContext(ctx).Go(stop, func() error {
+		defer wg.Done()
+
+		waitErr = client.waitAndRun(ctx, delivery, run, thunk, checkName, sha)
+		if waitErr != nil {
+			logger.Error("waiting check failed", zap.Error(waitErr))
+
+			// the run may have never been recorded
+			client.Redactor.Forget(run.ID)
+		}
+
+		if err := client.Queue.Finish(delivery, waitErr); err != nil {
+			logger.Error("failed to conclude held check", zap.Error(err))
+		}
+
+		return waitErr
+	})
+
+	return bass.Func(thunk.String(), "[]", func() (bass.Value, error) {
+		wg.Wait()
+		return bass.Null{}, waitErr
+	})
+}
+
+func (client *Client) waitAndRun(ctx context.Context, delivery *models.Delivery, run *models.Run, thunk bass.Thunk, checkName, sha string) error {
+	logger := zapctx.FromContext(ctx)
+
+	required, err := pool.RequiredLabels(thunk)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := delivery.CreatedAt.Time().Add(client.runnerTimeout())
+
+	// allow the check to be cancelled while it waits
+	waitCtx, untrack := client.Active.Track(ctx, run.ID)
+	defer untrack()
+
+	ticker := time.NewTicker(awaitInterval)
+	defer ticker.Stop()
+
+	var runtimePool *pool.Pool
+	for {
+		runtimePool, err = client.loadRuntimes(ctx, thunk, required)
+		if err != nil {
+			logger.Warn("failed to load runtimes", zap.Error(err))
+		} else if runtimePool != nil {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+			if time.Now().After(expiresAt) {
+				logger.Warn("timed out waiting for a runtime")
+
+				if err := client.abandon(ctx, run, checkName, sha, false, "No runner available"); err != nil {
+					return err
+				}
+
+				return fmt.Errorf("check %s: %w", checkName, ErrNoRuntime)
+			}
+		case <-waitCtx.Done():
+			logger.Info("cancelled while waiting for a runtime")
+
+			// the hook itself may have been cancelled
+			ctx = detach(ctx)
+
+			if err := client.abandon(ctx, run, checkName, sha, true, "Cancelled while waiting for a runner"); err != nil {
+				return err
+			}
+
+			return fmt.Errorf("check %s: cancelled while waiting for a runtime", checkName)
+		}
+	}
+	defer runtimePool.Close()
+
+	untrack()
+
+	logger.Info("runtime available; starting waiting check")
+
+	return client.startWaiting(ctx, delivery, run, thunk, checkName, sha, runtimePool.Filter(required))
+}
+
+// ResumeCheck resumes a check which was waiting for a runtime when the process
+// stopped, running it if a runtime is available.
+//
+// Until then the delivery is postponed, and once the runner timeout elapses
+// the check is given up on and the delivery is abandoned.
+func (client *Client) ResumeCheck(ctx context.Context, delivery *models.Delivery, held HeldCheck) error {
+	logger := zapctx.FromContext(ctx).With(
+		zap.String("run", held.RunID),
+		zap.String("check", held.CheckName))
+
+	run, err := models.RunByID(ctx, client.DB, held.RunID)
+	if err != nil {
+		return fmt.Errorf("get run: %w", err)
+	}
+
+	if run.EndTime != nil {
+		logger.Info("check already concluded")
+		return nil
+	}
+
+	dbThunk, err := run.Thunk(ctx, client.DB)
+	if err != nil {
+		return fmt.Errorf("get thunk: %w", err)
+	}
+
+	var thunk bass.Thunk
+	if err := bass.UnmarshalJSON(dbThunk.JSON, &thunk); err != nil {
+		return fmt.Errorf("unmarshal thunk: %w", err)
+	}
+
+	required, err := pool.RequiredLabels(thunk)
+	if err != nil {
+		return err
+	}
+
+	if time.Since(delivery.CreatedAt.Time()) > client.runnerTimeout() {
+		logger.Warn("timed out waiting for a runtime")
+
+		if err := client.abandon(ctx, run, held.CheckName, held.SHA, false, "No runner available"); err != nil {
+			return err
+		}
+
+		return queue.Abandon(ErrNoRuntime)
+	}
+
+	runtimePool, err := client.loadRuntimes(ctx, thunk, required)
+	if err != nil {
+		return fmt.Errorf("load runtimes: %w", err)
+	}
+
+	if runtimePool == nil {
+		logger.Info("no runtime available; postponing check")
+		return queue.Postpone(ErrNoRuntime)
+	}
+
+	defer runtimePool.Close()
+
+	logger.Info("runtime available; starting resumed check")
+
+	client.Redactor.Register(run.ID, thunk)
+
+	err = client.startWaiting(ctx, delivery, run, thunk, held.CheckName, held.SHA, runtimePool.Filter(required))
+	if err != nil {
+		// the run may have never been recorded
+		client.Redactor.Forget(run.ID)
+	}
+
+	return err
+}
+
+// loadRuntimes loads the runtime pool, returning nil if none of its runtimes
+// can run the thunk.
+func (client *Client) loadRuntimes(ctx context.Context, thunk bass.Thunk, required models.Labels) (*pool.Pool, error) {
+	runtimePool, err := client.LoadPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !runtimePool.Filter(required).CanRun(thunk) {
+		runtimePool.Close()
+		return nil, nil
+	}
+
+	return runtimePool, nil
+}
+
+// startWaiting runs a waiting check now that a runtime is available, waiting
+// for it to finish.
+func (client *Client) startWaiting(ctx context.Context, delivery *models.Delivery, run *models.Run, thunk bass.Thunk, checkName, sha string, runtimePool bass.RuntimePool) error {
+	// save the run right away so that the check isn't run again if the process
+	// stops partway through it
+	delivery.RunID = sql.NullString{String: run.ID, Valid: true}
+	if err := delivery.Update(ctx, client.DB); err != nil {
+		return fmt.Errorf("update delivery: %w", err)
+	}
+
+	ctx = bass.WithRuntimePool(ctx, runtimePool)
+
+	// the check is waited on below rather than along with the hook's runs
+	ctx, _ = bass.TrackRuns(ctx)
+
+	comb, err := client.runCheck(ctx, run, thunk, checkName, sha)
+	if err != nil {
+		return err
+	}
+
+	_, err = bass.Trampoline(ctx, comb.Call(ctx, bass.Empty{}, bass.NewEmptyScope(), bass.Identity))
+	return err
+}
+
+func (client *Client) runnerTimeout() time.Duration {
+	if client.RunnerTimeout == 0 {
+		return DefaultRunnerTimeout
+	}
+
+	return client.RunnerTimeout
+}
+
+// abandon completes a check that never got to run.
+func (client *Client) abandon(ctx context.Context, run *models.Run, checkName, sha string, cancelled bool, reason string) error {
+	if cancelled {
+		run.Cancelled = 1
+	}
+
+	if err := runs.Record(ctx, client.DB, client.Blobs, client.Redactor, run, progrock.NewTape(), false); err != nil {
+		return fmt.Errorf("failed to complete: %w", err)
+	}
+
+	return client.setStatus(ctx, run, checkName, sha, StatusError, reason)
+}
+
+// runCheck starts the thunk and returns a combiner which waits for it to
+// finish and sets the commit status with its result.
+func (client *Client) runCheck(ctx context.Context, run *models.Run, thunk bass.Thunk, checkName, sha string) (bass.Combiner, error) {
+	if err := client.setStatus(ctx, run, checkName, sha, StatusPending, "Running "+thunk.Cmdline()); err != nil {
+		return nil, err
+	}
+
+	tape := progrock.NewTape()
+	redaction := client.Redactor.Redaction(run.ID)
+	stream := client.Streams.Start(run.ID, redaction)
+	recorder := progrock.NewRecorder(progrock.MultiWriter{tape, stream})
+	thunkCtx, untrack := client.Active.Track(ctx, run.ID)
+	thunkCtx = progrock.RecorderToContext(thunkCtx, recorder)
+
+	metaVtx := recorder.Vertex(digest.Digest("check:"+checkName), "[check] "+checkName)
+	stderr := metaVtx.Stderr()
+	thunkCtx = ioctx.StderrToContext(thunkCtx, stderr)
+	thunkCtx = zapctx.ToContext(thunkCtx, bass.LoggerTo(stderr, zap.DebugLevel))
+
+	comb, err := thunk.Start(thunkCtx, bass.Func("handler", "[err]", func(ctx context.Context, merr bass.Value) error {
+		defer untrack()
+
+		var errv bass.Error
+		if err := merr.Decode(&errv); err == nil {
+			cli.WriteError(thunkCtx, errv.Err)
+		}
+
+		metaVtx.Done(errv.Err)
+
+		ok := errv.Err == nil
+		cancelled := !ok && thunkCtx.Err() != nil
+		if cancelled {
+			run.Cancelled = 1
+		}
+
+		defer stream.Close()
+
+		if err := runs.Record(ctx, client.DB, client.Blobs, client.Redactor, run, tape, ok); err != nil {
+			return fmt.Errorf("failed to complete: %w", err)
+		}
+
+		state, description := StatusSuccess, "Succeeded"
+		if cancelled {
+			state, description = StatusError, "Cancelled"
+		} else if !ok {
+			state, description = StatusFailure, "Failed"
+		}
+
+		if err := client.setStatus(ctx, run, checkName, sha, state, description); err != nil {
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+
+		// bubble up an error so it gets logged
+		return fmt.Errorf("check %s: %s failed: %w", checkName, thunk, errv.Err)
+	}))
+	if err != nil {
+		// the handler will never be called
+		untrack()
+		stream.Close()
+		return nil, err
+	}
+
+	return comb, nil
+}
+
+func (client *Client) setStatus(ctx context.Context, run *models.Run, checkName, sha, state, description string) error {
+	runURL, err := client.ExternalURL.Parse("/runs/" + run.ID)
+	if err != nil {
+		return err
+	}
+
+	err = client.API.CreateStatus(ctx, client.Repo, sha, CommitStatus{
+		State:       state,
+		TargetURL:   runURL.String(),
+		Description: description,
+		Context:     checkName,
+	})
+	if err != nil {
+		return fmt.Errorf("create status: %w", err)
+	}
+
+	return nil
+}
+
+// detach returns a context for work which must finish even if the hook that
+// started it was cancelled, keeping its logger.
+func detach(ctx context.Context) context.Context {
+	// each concurrent Bass must have its own trace
+	detached := bass.WithTrace(context.Background(), &bass.Trace{})
+	return zapctx.ToContext(detached, zapctx.FromContext(ctx))
+}
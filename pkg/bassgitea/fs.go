@@ -0,0 +1,133 @@
+package bassgitea
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/vito/bass/pkg/zapctx"
+	"go.uber.org/zap"
+)
+
+// FS is a filesystem that reads from a Gitea repo at a given commit.
+type FS struct {
+	Ctx  context.Context
+	API  *API
+	Repo *Repository
+	Ref  string
+
+	cache  map[string][]byte
+	cacheL *sync.Mutex
+}
+
+func NewFS(ctx context.Context, api *API, repo *Repository, ref string) fs.FS {
+	return &FS{
+		Ctx:  ctx,
+		API:  api,
+		Repo: repo,
+		Ref:  ref,
+
+		cache:  map[string][]byte{},
+		cacheL: new(sync.Mutex),
+	}
+}
+
+func (gfs *FS) Open(name string) (fs.File, error) {
+	logger := zapctx.FromContext(gfs.Ctx).With(
+		zap.String("repo", gfs.Repo.FullName),
+		zap.String("path", name),
+		zap.String("sha", gfs.Ref),
+	)
+
+	gfs.cacheL.Lock()
+	defer gfs.cacheL.Unlock()
+
+	content, cached := gfs.cache[name]
+	if cached {
+		logger.Debug("cache hit")
+	} else {
+		logger.Info("fetching content")
+
+		var err error
+		content, err = gfs.API.GetRaw(gfs.Ctx, gfs.Repo, name, gfs.Ref)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+			}
+
+			return nil, fmt.Errorf("get %s: %w", name, err)
+		}
+
+		gfs.cache[name] = content
+	}
+
+	return &giteaFile{bytes.NewReader(content), gfs, name}, nil
+}
+
+type giteaFile struct {
+	io.Reader
+
+	fs   *FS
+	name string
+}
+
+func (f *giteaFile) Close() error {
+	return nil
+}
+
+func (f *giteaFile) Stat() (fs.FileInfo, error) {
+	parent := path.Dir(f.name)
+	filename := path.Base(f.name)
+
+	_, dirContents, err := f.fs.API.GetContents(f.fs.Ctx, f.fs.Repo, parent, f.fs.Ref)
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", parent, err)
+	}
+
+	for _, contents := range dirContents {
+		if contents.Name == filename {
+			return giteaInfo{contents}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("file %s not found", f.name)
+}
+
+type giteaInfo struct {
+	*Content
+}
+
+func (i giteaInfo) Name() string {
+	return i.Content.Name
+}
+
+func (i giteaInfo) IsDir() bool {
+	return i.Type == "dir"
+}
+
+func (i giteaInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (i giteaInfo) Mode() fs.FileMode {
+	// made up
+	if i.IsDir() {
+		return fs.FileMode(0755)
+	} else {
+		return fs.FileMode(0644)
+	}
+}
+
+func (i giteaInfo) Size() int64 {
+	return i.Content.Size
+}
+
+func (i giteaInfo) Sys() interface{} {
+	return nil
+}
@@ -0,0 +1,122 @@
+package ghapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v43/github"
+)
+
+// GitHub's OAuth endpoints.
+const (
+	AuthorizeURL   = "https://github.com/login/oauth/authorize"
+	AccessTokenURL = "https://github.com/login/oauth/access_token"
+)
+
+// OAuth identifies users with the app's user-to-server OAuth flow.
+type OAuth struct {
+	ClientID     string
+	ClientSecret string
+
+	HTTP *http.Client
+}
+
+// AuthorizeURL returns the URL to send the user to in order to sign in.
+//
+// GitHub redirects back to the app's callback URL with the state and a code
+// to pass to Exchange.
+func (oauth *OAuth) AuthorizeURL(state string) string {
+	return AuthorizeURL + "?" + url.Values{
+		"client_id": {oauth.ClientID},
+		"state":     {state},
+	}.Encode()
+}
+
+// Exchange exchanges the code from the callback for an access token.
+func (oauth *OAuth) Exchange(ctx context.Context, code string) (string, error) {
+	form := url.Values{
+		"client_id":     {oauth.ClientID},
+		"client_secret": {oauth.ClientSecret},
+		"code":          {code},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, AccessTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := oauth.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("exchange code: %s", res.Status)
+	}
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("decode token: %w", err)
+	}
+
+	if token.Error != "" {
+		return "", fmt.Errorf("exchange code: %s: %s", token.Error, token.ErrorDescription)
+	}
+
+	return token.AccessToken, nil
+}
+
+// User returns the user that the access token belongs to.
+func (oauth *OAuth) User(ctx context.Context, token string) (*github.User, error) {
+	client := github.NewClient(&http.Client{
+		Transport: &tokenTransport{
+			token: token,
+			base:  oauth.client().Transport,
+		},
+	})
+
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	return user, nil
+}
+
+func (oauth *OAuth) client() *http.Client {
+	if oauth.HTTP != nil {
+		return oauth.HTTP
+	}
+
+	return http.DefaultClient
+}
+
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return base.RoundTrip(req)
+}
@@ -4,17 +4,40 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io/fs"
+	"net/url"
+	"strings"
 
 	"github.com/adrg/xdg"
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/vito/bass-loop/migrations"
 	"github.com/vito/bass-loop/pkg/cfg"
 )
 
-type Conn = sql.DB
+// Dialect identifies the database backend.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite3"
+	Postgres Dialect = "postgres"
+)
+
+// Conn is a connection to the database.
+type Conn struct {
+	*sql.DB
+
+	Dialect Dialect
+
+	// FTS5 is true if SQLite was built with FTS5, in which case vertex logs are
+	// indexed for full-text search.
+	FTS5 bool
+}
 
 func Open(config *cfg.Config) (*Conn, error) {
 	db, err := open(config)
@@ -24,17 +47,37 @@ func Open(config *cfg.Config) (*Conn, error) {
 	return db, nil
 }
 
-func open(config *cfg.Config) (*sql.DB, error) {
-	if config.SQLitePath == "" {
+func open(config *cfg.Config) (*Conn, error) {
+	if config.DatabaseURL == "" {
+		return openSQLite(config.SQLitePath)
+	}
+
+	dbURL, err := url.Parse(config.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+
+	switch dbURL.Scheme {
+	case "sqlite", "sqlite3":
+		return openSQLite(strings.TrimPrefix(config.DatabaseURL, dbURL.Scheme+"://"))
+	case "postgres", "postgresql":
+		return openPostgres(config.DatabaseURL)
+	default:
+		return nil, fmt.Errorf("unsupported database: %s", dbURL.Scheme)
+	}
+}
+
+func openSQLite(path string) (*Conn, error) {
+	if path == "" {
 		defaultPath, err := xdg.DataFile("bass-loop/loop.db")
 		if err != nil {
 			return nil, fmt.Errorf("xdg: %w", err)
 		}
 
-		config.SQLitePath = defaultPath
+		path = defaultPath
 	}
 
-	db, err := sql.Open("sqlite3", config.SQLitePath+"?cache=shared&mode=rwc&_busy_timeout=10000&_journal_mode=WAL&_synchronous=NORMAL&_foreign_keys")
+	db, err := sql.Open("sqlite3", path+"?cache=shared&mode=rwc&_busy_timeout=10000&_journal_mode=WAL&_synchronous=NORMAL&_foreign_keys")
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite3: %w", err)
 	}
@@ -44,19 +87,50 @@ func open(config *cfg.Config) (*sql.DB, error) {
 		return nil, fmt.Errorf("sqlite3 instance: %w", err)
 	}
 
-	migrationsSrc, err := iofs.New(migrations.FS, ".")
+	if err := migrateUp(migrations.FS, ".", "sqlite3", instance); err != nil {
+		return nil, err
+	}
+
+	fts5, err := setupVertexLogsFTS(db)
 	if err != nil {
-		return nil, fmt.Errorf("migrations fs: %w", err)
+		return nil, fmt.Errorf("setup log search: %w", err)
 	}
 
-	m, err := migrate.NewWithInstance("fs", migrationsSrc, "sqlite3", instance)
+	return &Conn{DB: db, Dialect: SQLite, FTS5: fts5}, nil
+}
+
+func openPostgres(dsn string) (*Conn, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres: %w", err)
+	}
+
+	instance, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("postgres instance: %w", err)
+	}
+
+	if err := migrateUp(migrations.PostgresFS, "postgres", "postgres", instance); err != nil {
+		return nil, err
+	}
+
+	return &Conn{DB: db, Dialect: Postgres}, nil
+}
+
+func migrateUp(fsys fs.FS, dir string, dbName string, instance database.Driver) error {
+	migrationsSrc, err := iofs.New(fsys, dir)
 	if err != nil {
-		return nil, fmt.Errorf("setup migrate: %w", err)
+		return fmt.Errorf("migrations fs: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("fs", migrationsSrc, dbName, instance)
+	if err != nil {
+		return fmt.Errorf("setup migrate: %w", err)
 	}
 
 	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		return nil, fmt.Errorf("migrate: %w", err)
+		return fmt.Errorf("migrate: %w", err)
 	}
 
-	return db, nil
+	return nil
 }
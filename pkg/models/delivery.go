@@ -0,0 +1,50 @@
+package models
+
+import (
+	"context"
+)
+
+// Claim marks the pending delivery as running on the node, counting an
+// attempt. It returns false if the delivery is no longer pending, e.g. because
+// another node claimed it first.
+//
+// The delivery is only claimed if it's still pending in the database, so that
+// only one node can claim it.
+func (d *Delivery) Claim(ctx context.Context, db DB, node string) (bool, error) {
+	const sqlstr = `UPDATE deliveries SET status = 'running', attempts = attempts + 1, node = $1 WHERE id = $2 AND status = 'pending'`
+	logf(sqlstr, node, d.ID)
+	res, err := db.ExecContext(ctx, sqlstr, node, d.ID)
+	if err != nil {
+		return false, logerror(err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, logerror(err)
+	}
+
+	if affected == 0 {
+		return false, nil
+	}
+
+	d.Status = "running"
+	d.Attempts++
+	d.Node = node
+
+	return true, nil
+}
+
+// WakeDeliveries schedules postponed deliveries to be attempted at the given
+// time.
+//
+// Only the attempt time is updated so that deliveries claimed in the meantime
+// are left alone.
+func WakeDeliveries(ctx context.Context, db DB, attemptAt Time) error {
+	const sqlstr = `UPDATE deliveries SET attempt_at = $1 WHERE status = 'pending' AND postponed = 1`
+	logf(sqlstr, attemptAt)
+	if _, err := db.ExecContext(ctx, sqlstr, attemptAt); err != nil {
+		return logerror(err)
+	}
+
+	return nil
+}
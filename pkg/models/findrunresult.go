@@ -0,0 +1,63 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// FindRunResult represents a run matching a metadata search.
+type FindRunResult struct {
+	ID string `json:"id"` // id
+}
+
+// FindRunResultsByPathValue finds runs whose metadata has the given value at
+// the given path, e.g. $.repo.full_name.
+//
+// This is written by hand rather than generated because each dialect has its
+// own JSON operators.
+func FindRunResultsByPathValue(ctx context.Context, db *Conn, path string, value any) ([]*FindRunResult, error) {
+	var sqlstr string
+	var pathArg any
+	switch db.Dialect {
+	case Postgres:
+		sqlstr = `SELECT id FROM runs WHERE meta::jsonb #>> $1 = $2 ORDER BY start_time DESC LIMIT 50`
+		pathArg = pgJSONPath(path)
+	default:
+		sqlstr = `SELECT id FROM runs WHERE json_extract(meta, $1) = $2 ORDER BY start_time DESC LIMIT 50`
+		pathArg = path
+	}
+	// run
+	logf(sqlstr, pathArg, value)
+	rows, err := db.QueryContext(ctx, sqlstr, pathArg, value)
+	if err != nil {
+		return nil, logerror(err)
+	}
+	defer rows.Close()
+	// load results
+	var res []*FindRunResult
+	for rows.Next() {
+		var frr FindRunResult
+		// scan
+		if err := rows.Scan(&frr.ID); err != nil {
+			return nil, logerror(err)
+		}
+		res = append(res, &frr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logerror(err)
+	}
+	return res, nil
+}
+
+// pgJSONPath converts a SQLite JSON path like $.repo.full_name to a Postgres
+// text array like {repo,full_name}.
+func pgJSONPath(path string) string {
+	path = strings.TrimPrefix(path, "$")
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return "{}"
+	}
+
+	return fmt.Sprintf("{%s}", strings.ReplaceAll(path, ".", ","))
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Heartbeat extends the runtime's expiry without touching its health, which
+// is recorded separately by whichever node last probed it.
+func (r *Runtime) Heartbeat(ctx context.Context, db DB, expiresAt time.Time) error {
+	now := NewTime(time.Now().UTC())
+
+	r.ExpiresAt = NewTime(expiresAt.UTC())
+	r.HeartbeatAt = &now
+
+	const sqlstr = `UPDATE runtimes SET expires_at = $1, heartbeat_at = $2 WHERE user_id = $3 AND name = $4`
+	logf(sqlstr, r.ExpiresAt, r.HeartbeatAt, r.UserID, r.Name)
+	if _, err := db.ExecContext(ctx, sqlstr, r.ExpiresAt, r.HeartbeatAt, r.UserID, r.Name); err != nil {
+		return logerror(err)
+	}
+
+	return nil
+}
+
+// RecordHealth records the result of probing the runtime.
+func (r *Runtime) RecordHealth(ctx context.Context, db DB, probeErr error) error {
+	now := NewTime(time.Now().UTC())
+
+	r.CheckedAt = &now
+	if probeErr != nil {
+		r.Healthy = 0
+		r.HealthError = sql.NullString{String: probeErr.Error(), Valid: true}
+	} else {
+		r.Healthy = 1
+		r.HealthError = sql.NullString{}
+	}
+
+	const sqlstr = `UPDATE runtimes SET healthy = $1, health_error = $2, checked_at = $3 WHERE user_id = $4 AND name = $5`
+	logf(sqlstr, r.Healthy, r.HealthError, r.CheckedAt, r.UserID, r.Name)
+	if _, err := db.ExecContext(ctx, sqlstr, r.Healthy, r.HealthError, r.CheckedAt, r.UserID, r.Name); err != nil {
+		return logerror(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Labels are arbitrary key-value pairs registered by a runner, used for
+// selecting its runtime.
+type Labels map[string]string
+
+// LabelSet returns the labels registered for the runtime.
+func (r *Runtime) LabelSet() (Labels, error) {
+	labels := Labels{}
+	if r.Labels == "" {
+		return labels, nil
+	}
+
+	if err := json.Unmarshal([]byte(r.Labels), &labels); err != nil {
+		return nil, fmt.Errorf("unmarshal runtime labels: %w", err)
+	}
+
+	return labels, nil
+}
+
+// SetLabels sets the labels registered for the runtime.
+func (r *Runtime) SetLabels(labels Labels) error {
+	if labels == nil {
+		labels = Labels{}
+	}
+
+	payload, err := json.Marshal(labels)
+	if err != nil {
+		return fmt.Errorf("marshal runtime labels: %w", err)
+	}
+
+	r.Labels = string(payload)
+
+	return nil
+}
+
+// Satisfies returns true if every required label is set to the same value.
+func (labels Labels) Satisfies(required Labels) bool {
+	for k, v := range required {
+		if labels[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the labels in key=value form, sorted by key.
+func (labels Labels) String() string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
@@ -64,8 +64,9 @@ func CreateThunkRun(ctx context.Context, db DB, user *github.User, thunk bass.Th
 		StartTime:   startTime,
 	}
 
+	var metaJSON []byte
 	if meta != nil {
-		metaJSON, err := json.Marshal(meta)
+		metaJSON, err = json.Marshal(meta)
 		if err != nil {
 			return nil, err
 		}
@@ -76,6 +77,8 @@ func CreateThunkRun(ctx context.Context, db DB, user *github.User, thunk bass.Th
 		}
 	}
 
+	thunkRun.Visibility = DefaultVisibility(payload, metaJSON)
+
 	err = thunkRun.Save(ctx, db)
 	if err != nil {
 		return nil, fmt.Errorf("save thunk run: %w", err)
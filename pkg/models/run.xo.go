@@ -16,6 +16,9 @@ type Run struct {
 	EndTime     *Time          `json:"end_time"`     // end_time
 	Succeeded   sql.NullInt64  `json:"succeeded"`    // succeeded
 	Meta        sql.NullString `json:"meta"`         // meta
+	Cancelled   int            `json:"cancelled"`    // cancelled
+	Visibility  string         `json:"visibility"`   // visibility
+	Redacted    int            `json:"redacted"`     // redacted
 	// xo fields
 	_exists, _deleted bool
 }
@@ -41,13 +44,13 @@ func (r *Run) Insert(ctx context.Context, db DB) error {
 	}
 	// insert (manual)
 	const sqlstr = `INSERT INTO runs (` +
-		`id, user_id, thunk_digest, start_time, end_time, succeeded, meta` +
+		`id, user_id, thunk_digest, start_time, end_time, succeeded, meta, cancelled, visibility, redacted` +
 		`) VALUES (` +
-		`$1, $2, $3, $4, $5, $6, $7` +
+		`$1, $2, $3, $4, $5, $6, $7, $8, $9, $10` +
 		`)`
 	// run
-	logf(sqlstr, r.ID, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta)
-	if _, err := db.ExecContext(ctx, sqlstr, r.ID, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta); err != nil {
+	logf(sqlstr, r.ID, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta, r.Cancelled, r.Visibility, r.Redacted)
+	if _, err := db.ExecContext(ctx, sqlstr, r.ID, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta, r.Cancelled, r.Visibility, r.Redacted); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -65,11 +68,11 @@ func (r *Run) Update(ctx context.Context, db DB) error {
 	}
 	// update with primary key
 	const sqlstr = `UPDATE runs SET ` +
-		`user_id = $1, thunk_digest = $2, start_time = $3, end_time = $4, succeeded = $5, meta = $6 ` +
-		`WHERE id = $7`
+		`user_id = $1, thunk_digest = $2, start_time = $3, end_time = $4, succeeded = $5, meta = $6, cancelled = $7, visibility = $8, redacted = $9 ` +
+		`WHERE id = $10`
 	// run
-	logf(sqlstr, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta, r.ID)
-	if _, err := db.ExecContext(ctx, sqlstr, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta, r.ID); err != nil {
+	logf(sqlstr, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta, r.Cancelled, r.Visibility, r.Redacted, r.ID)
+	if _, err := db.ExecContext(ctx, sqlstr, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta, r.Cancelled, r.Visibility, r.Redacted, r.ID); err != nil {
 		return logerror(err)
 	}
 	return nil
@@ -91,16 +94,16 @@ func (r *Run) Upsert(ctx context.Context, db DB) error {
 	}
 	// upsert
 	const sqlstr = `INSERT INTO runs (` +
-		`id, user_id, thunk_digest, start_time, end_time, succeeded, meta` +
+		`id, user_id, thunk_digest, start_time, end_time, succeeded, meta, cancelled, visibility, redacted` +
 		`) VALUES (` +
-		`$1, $2, $3, $4, $5, $6, $7` +
+		`$1, $2, $3, $4, $5, $6, $7, $8, $9, $10` +
 		`)` +
 		` ON CONFLICT (id) DO ` +
 		`UPDATE SET ` +
-		`user_id = EXCLUDED.user_id, thunk_digest = EXCLUDED.thunk_digest, start_time = EXCLUDED.start_time, end_time = EXCLUDED.end_time, succeeded = EXCLUDED.succeeded, meta = EXCLUDED.meta `
+		`user_id = EXCLUDED.user_id, thunk_digest = EXCLUDED.thunk_digest, start_time = EXCLUDED.start_time, end_time = EXCLUDED.end_time, succeeded = EXCLUDED.succeeded, meta = EXCLUDED.meta, cancelled = EXCLUDED.cancelled, visibility = EXCLUDED.visibility, redacted = EXCLUDED.redacted `
 	// run
-	logf(sqlstr, r.ID, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta)
-	if _, err := db.ExecContext(ctx, sqlstr, r.ID, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta); err != nil {
+	logf(sqlstr, r.ID, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta, r.Cancelled, r.Visibility, r.Redacted)
+	if _, err := db.ExecContext(ctx, sqlstr, r.ID, r.UserID, r.ThunkDigest, r.StartTime, r.EndTime, r.Succeeded, r.Meta, r.Cancelled, r.Visibility, r.Redacted); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -135,7 +138,7 @@ func (r *Run) Delete(ctx context.Context, db DB) error {
 func RunsByThunkDigest(ctx context.Context, db DB, thunkDigest string) ([]*Run, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`id, user_id, thunk_digest, start_time, end_time, succeeded, meta ` +
+		`id, user_id, thunk_digest, start_time, end_time, succeeded, meta, cancelled, visibility, redacted ` +
 		`FROM runs ` +
 		`WHERE thunk_digest = $1`
 	// run
@@ -152,7 +155,7 @@ func RunsByThunkDigest(ctx context.Context, db DB, thunkDigest string) ([]*Run,
 			_exists: true,
 		}
 		// scan
-		if err := rows.Scan(&r.ID, &r.UserID, &r.ThunkDigest, &r.StartTime, &r.EndTime, &r.Succeeded, &r.Meta); err != nil {
+		if err := rows.Scan(&r.ID, &r.UserID, &r.ThunkDigest, &r.StartTime, &r.EndTime, &r.Succeeded, &r.Meta, &r.Cancelled, &r.Visibility, &r.Redacted); err != nil {
 			return nil, logerror(err)
 		}
 		res = append(res, &r)
@@ -169,7 +172,7 @@ func RunsByThunkDigest(ctx context.Context, db DB, thunkDigest string) ([]*Run,
 func RunsByUserID(ctx context.Context, db DB, userID string) ([]*Run, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`id, user_id, thunk_digest, start_time, end_time, succeeded, meta ` +
+		`id, user_id, thunk_digest, start_time, end_time, succeeded, meta, cancelled, visibility, redacted ` +
 		`FROM runs ` +
 		`WHERE user_id = $1`
 	// run
@@ -186,7 +189,7 @@ func RunsByUserID(ctx context.Context, db DB, userID string) ([]*Run, error) {
 			_exists: true,
 		}
 		// scan
-		if err := rows.Scan(&r.ID, &r.UserID, &r.ThunkDigest, &r.StartTime, &r.EndTime, &r.Succeeded, &r.Meta); err != nil {
+		if err := rows.Scan(&r.ID, &r.UserID, &r.ThunkDigest, &r.StartTime, &r.EndTime, &r.Succeeded, &r.Meta, &r.Cancelled, &r.Visibility, &r.Redacted); err != nil {
 			return nil, logerror(err)
 		}
 		res = append(res, &r)
@@ -203,7 +206,7 @@ func RunsByUserID(ctx context.Context, db DB, userID string) ([]*Run, error) {
 func RunByID(ctx context.Context, db DB, id string) (*Run, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`id, user_id, thunk_digest, start_time, end_time, succeeded, meta ` +
+		`id, user_id, thunk_digest, start_time, end_time, succeeded, meta, cancelled, visibility, redacted ` +
 		`FROM runs ` +
 		`WHERE id = $1`
 	// run
@@ -211,7 +214,7 @@ func RunByID(ctx context.Context, db DB, id string) (*Run, error) {
 	r := Run{
 		_exists: true,
 	}
-	if err := db.QueryRowContext(ctx, sqlstr, id).Scan(&r.ID, &r.UserID, &r.ThunkDigest, &r.StartTime, &r.EndTime, &r.Succeeded, &r.Meta); err != nil {
+	if err := db.QueryRowContext(ctx, sqlstr, id).Scan(&r.ID, &r.UserID, &r.ThunkDigest, &r.StartTime, &r.EndTime, &r.Succeeded, &r.Meta, &r.Cancelled, &r.Visibility, &r.Redacted); err != nil {
 		return nil, logerror(err)
 	}
 	return &r, nil
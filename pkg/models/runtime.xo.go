@@ -4,16 +4,25 @@ package models
 
 import (
 	"context"
+	"database/sql"
 )
 
 // Runtime represents a row from 'runtimes'.
 type Runtime struct {
-	UserID    string `json:"user_id"`    // user_id
-	Name      string `json:"name"`       // name
-	Os        string `json:"os"`         // os
-	Arch      string `json:"arch"`       // arch
-	ExpiresAt Time   `json:"expires_at"` // expires_at
-	Priority  int    `json:"priority"`   // priority
+	UserID      string         `json:"user_id"`      // user_id
+	Name        string         `json:"name"`         // name
+	Os          string         `json:"os"`           // os
+	Arch        string         `json:"arch"`         // arch
+	ExpiresAt   Time           `json:"expires_at"`   // expires_at
+	Priority    int            `json:"priority"`     // priority
+	Node        string         `json:"node"`         // node
+	Labels      string         `json:"labels"`       // labels
+	Scope       string         `json:"scope"`        // scope
+	Healthy     int            `json:"healthy"`      // healthy
+	HealthError sql.NullString `json:"health_error"` // health_error
+	CheckedAt   *Time          `json:"checked_at"`   // checked_at
+	ConnectedAt *Time          `json:"connected_at"` // connected_at
+	HeartbeatAt *Time          `json:"heartbeat_at"` // heartbeat_at
 	// xo fields
 	_exists, _deleted bool
 }
@@ -39,13 +48,13 @@ func (r *Runtime) Insert(ctx context.Context, db DB) error {
 	}
 	// insert (manual)
 	const sqlstr = `INSERT INTO runtimes (` +
-		`user_id, name, os, arch, expires_at, priority` +
+		`user_id, name, os, arch, expires_at, priority, node, labels, scope, healthy, health_error, checked_at, connected_at, heartbeat_at` +
 		`) VALUES (` +
-		`$1, $2, $3, $4, $5, $6` +
+		`$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14` +
 		`)`
 	// run
-	logf(sqlstr, r.UserID, r.Name, r.Os, r.Arch, r.ExpiresAt, r.Priority)
-	if _, err := db.ExecContext(ctx, sqlstr, r.UserID, r.Name, r.Os, r.Arch, r.ExpiresAt, r.Priority); err != nil {
+	logf(sqlstr, r.UserID, r.Name, r.Os, r.Arch, r.ExpiresAt, r.Priority, r.Node, r.Labels, r.Scope, r.Healthy, r.HealthError, r.CheckedAt, r.ConnectedAt, r.HeartbeatAt)
+	if _, err := db.ExecContext(ctx, sqlstr, r.UserID, r.Name, r.Os, r.Arch, r.ExpiresAt, r.Priority, r.Node, r.Labels, r.Scope, r.Healthy, r.HealthError, r.CheckedAt, r.ConnectedAt, r.HeartbeatAt); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -63,11 +72,11 @@ func (r *Runtime) Update(ctx context.Context, db DB) error {
 	}
 	// update with primary key
 	const sqlstr = `UPDATE runtimes SET ` +
-		`os = $1, arch = $2, expires_at = $3, priority = $4 ` +
-		`WHERE user_id = $5 AND name = $6`
+		`os = $1, arch = $2, expires_at = $3, priority = $4, node = $5, labels = $6, scope = $7, healthy = $8, health_error = $9, checked_at = $10, connected_at = $11, heartbeat_at = $12 ` +
+		`WHERE user_id = $13 AND name = $14`
 	// run
-	logf(sqlstr, r.Os, r.Arch, r.ExpiresAt, r.Priority, r.UserID, r.Name)
-	if _, err := db.ExecContext(ctx, sqlstr, r.Os, r.Arch, r.ExpiresAt, r.Priority, r.UserID, r.Name); err != nil {
+	logf(sqlstr, r.Os, r.Arch, r.ExpiresAt, r.Priority, r.Node, r.Labels, r.Scope, r.Healthy, r.HealthError, r.CheckedAt, r.ConnectedAt, r.HeartbeatAt, r.UserID, r.Name)
+	if _, err := db.ExecContext(ctx, sqlstr, r.Os, r.Arch, r.ExpiresAt, r.Priority, r.Node, r.Labels, r.Scope, r.Healthy, r.HealthError, r.CheckedAt, r.ConnectedAt, r.HeartbeatAt, r.UserID, r.Name); err != nil {
 		return logerror(err)
 	}
 	return nil
@@ -89,16 +98,16 @@ func (r *Runtime) Upsert(ctx context.Context, db DB) error {
 	}
 	// upsert
 	const sqlstr = `INSERT INTO runtimes (` +
-		`user_id, name, os, arch, expires_at, priority` +
+		`user_id, name, os, arch, expires_at, priority, node, labels, scope, healthy, health_error, checked_at, connected_at, heartbeat_at` +
 		`) VALUES (` +
-		`$1, $2, $3, $4, $5, $6` +
+		`$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14` +
 		`)` +
 		` ON CONFLICT (user_id, name) DO ` +
 		`UPDATE SET ` +
-		`os = EXCLUDED.os, arch = EXCLUDED.arch, expires_at = EXCLUDED.expires_at, priority = EXCLUDED.priority `
+		`os = EXCLUDED.os, arch = EXCLUDED.arch, expires_at = EXCLUDED.expires_at, priority = EXCLUDED.priority, node = EXCLUDED.node, labels = EXCLUDED.labels, scope = EXCLUDED.scope, healthy = EXCLUDED.healthy, health_error = EXCLUDED.health_error, checked_at = EXCLUDED.checked_at, connected_at = EXCLUDED.connected_at, heartbeat_at = EXCLUDED.heartbeat_at `
 	// run
-	logf(sqlstr, r.UserID, r.Name, r.Os, r.Arch, r.ExpiresAt, r.Priority)
-	if _, err := db.ExecContext(ctx, sqlstr, r.UserID, r.Name, r.Os, r.Arch, r.ExpiresAt, r.Priority); err != nil {
+	logf(sqlstr, r.UserID, r.Name, r.Os, r.Arch, r.ExpiresAt, r.Priority, r.Node, r.Labels, r.Scope, r.Healthy, r.HealthError, r.CheckedAt, r.ConnectedAt, r.HeartbeatAt)
+	if _, err := db.ExecContext(ctx, sqlstr, r.UserID, r.Name, r.Os, r.Arch, r.ExpiresAt, r.Priority, r.Node, r.Labels, r.Scope, r.Healthy, r.HealthError, r.CheckedAt, r.ConnectedAt, r.HeartbeatAt); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -127,13 +136,81 @@ func (r *Runtime) Delete(ctx context.Context, db DB) error {
 	return nil
 }
 
+// RuntimesByNode retrieves a row from 'runtimes' as a Runtime.
+//
+// Generated from index 'idx_runtimes_node'.
+func RuntimesByNode(ctx context.Context, db DB, node string) ([]*Runtime, error) {
+	// query
+	const sqlstr = `SELECT ` +
+		`user_id, name, os, arch, expires_at, priority, node, labels, scope, healthy, health_error, checked_at, connected_at, heartbeat_at ` +
+		`FROM runtimes ` +
+		`WHERE node = $1`
+	// run
+	logf(sqlstr, node)
+	rows, err := db.QueryContext(ctx, sqlstr, node)
+	if err != nil {
+		return nil, logerror(err)
+	}
+	defer rows.Close()
+	// process
+	var res []*Runtime
+	for rows.Next() {
+		r := Runtime{
+			_exists: true,
+		}
+		// scan
+		if err := rows.Scan(&r.UserID, &r.Name, &r.Os, &r.Arch, &r.ExpiresAt, &r.Priority, &r.Node, &r.Labels, &r.Scope, &r.Healthy, &r.HealthError, &r.CheckedAt, &r.ConnectedAt, &r.HeartbeatAt); err != nil {
+			return nil, logerror(err)
+		}
+		res = append(res, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logerror(err)
+	}
+	return res, nil
+}
+
+// RuntimesByScope retrieves a row from 'runtimes' as a Runtime.
+//
+// Generated from index 'idx_runtimes_scope'.
+func RuntimesByScope(ctx context.Context, db DB, scope string) ([]*Runtime, error) {
+	// query
+	const sqlstr = `SELECT ` +
+		`user_id, name, os, arch, expires_at, priority, node, labels, scope, healthy, health_error, checked_at, connected_at, heartbeat_at ` +
+		`FROM runtimes ` +
+		`WHERE scope = $1`
+	// run
+	logf(sqlstr, scope)
+	rows, err := db.QueryContext(ctx, sqlstr, scope)
+	if err != nil {
+		return nil, logerror(err)
+	}
+	defer rows.Close()
+	// process
+	var res []*Runtime
+	for rows.Next() {
+		r := Runtime{
+			_exists: true,
+		}
+		// scan
+		if err := rows.Scan(&r.UserID, &r.Name, &r.Os, &r.Arch, &r.ExpiresAt, &r.Priority, &r.Node, &r.Labels, &r.Scope, &r.Healthy, &r.HealthError, &r.CheckedAt, &r.ConnectedAt, &r.HeartbeatAt); err != nil {
+			return nil, logerror(err)
+		}
+		res = append(res, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logerror(err)
+	}
+	return res, nil
+}
+
 // RuntimesByUserID retrieves a row from 'runtimes' as a Runtime.
 //
 // Generated from index 'idx_runtimes_user_id'.
 func RuntimesByUserID(ctx context.Context, db DB, userID string) ([]*Runtime, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`user_id, name, os, arch, expires_at, priority ` +
+		`user_id, name, os, arch, expires_at, priority, node, labels, scope, healthy, health_error, checked_at, connected_at, heartbeat_at ` +
 		`FROM runtimes ` +
 		`WHERE user_id = $1`
 	// run
@@ -150,7 +227,7 @@ func RuntimesByUserID(ctx context.Context, db DB, userID string) ([]*Runtime, er
 			_exists: true,
 		}
 		// scan
-		if err := rows.Scan(&r.UserID, &r.Name, &r.Os, &r.Arch, &r.ExpiresAt, &r.Priority); err != nil {
+		if err := rows.Scan(&r.UserID, &r.Name, &r.Os, &r.Arch, &r.ExpiresAt, &r.Priority, &r.Node, &r.Labels, &r.Scope, &r.Healthy, &r.HealthError, &r.CheckedAt, &r.ConnectedAt, &r.HeartbeatAt); err != nil {
 			return nil, logerror(err)
 		}
 		res = append(res, &r)
@@ -167,7 +244,7 @@ func RuntimesByUserID(ctx context.Context, db DB, userID string) ([]*Runtime, er
 func RuntimeByUserIDName(ctx context.Context, db DB, userID, name string) (*Runtime, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`user_id, name, os, arch, expires_at, priority ` +
+		`user_id, name, os, arch, expires_at, priority, node, labels, scope, healthy, health_error, checked_at, connected_at, heartbeat_at ` +
 		`FROM runtimes ` +
 		`WHERE user_id = $1 AND name = $2`
 	// run
@@ -175,7 +252,7 @@ func RuntimeByUserIDName(ctx context.Context, db DB, userID, name string) (*Runt
 	r := Runtime{
 		_exists: true,
 	}
-	if err := db.QueryRowContext(ctx, sqlstr, userID, name).Scan(&r.UserID, &r.Name, &r.Os, &r.Arch, &r.ExpiresAt, &r.Priority); err != nil {
+	if err := db.QueryRowContext(ctx, sqlstr, userID, name).Scan(&r.UserID, &r.Name, &r.Os, &r.Arch, &r.ExpiresAt, &r.Priority, &r.Node, &r.Labels, &r.Scope, &r.Healthy, &r.HealthError, &r.CheckedAt, &r.ConnectedAt, &r.HeartbeatAt); err != nil {
 		return nil, logerror(err)
 	}
 	return &r, nil
@@ -12,6 +12,7 @@ type Service struct {
 	RuntimeName string `json:"runtime_name"` // runtime_name
 	Service     string `json:"service"`      // service
 	Addr        string `json:"addr"`         // addr
+	Node        string `json:"node"`         // node
 	// xo fields
 	_exists, _deleted bool
 }
@@ -37,13 +38,13 @@ func (s *Service) Insert(ctx context.Context, db DB) error {
 	}
 	// insert (manual)
 	const sqlstr = `INSERT INTO services (` +
-		`user_id, runtime_name, service, addr` +
+		`user_id, runtime_name, service, addr, node` +
 		`) VALUES (` +
-		`$1, $2, $3, $4` +
+		`$1, $2, $3, $4, $5` +
 		`)`
 	// run
-	logf(sqlstr, s.UserID, s.RuntimeName, s.Service, s.Addr)
-	if _, err := db.ExecContext(ctx, sqlstr, s.UserID, s.RuntimeName, s.Service, s.Addr); err != nil {
+	logf(sqlstr, s.UserID, s.RuntimeName, s.Service, s.Addr, s.Node)
+	if _, err := db.ExecContext(ctx, sqlstr, s.UserID, s.RuntimeName, s.Service, s.Addr, s.Node); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -61,11 +62,11 @@ func (s *Service) Update(ctx context.Context, db DB) error {
 	}
 	// update with primary key
 	const sqlstr = `UPDATE services SET ` +
-		`user_id = $1, addr = $2 ` +
-		`WHERE runtime_name = $3 AND service = $4`
+		`user_id = $1, addr = $2, node = $3 ` +
+		`WHERE runtime_name = $4 AND service = $5`
 	// run
-	logf(sqlstr, s.UserID, s.Addr, s.RuntimeName, s.Service)
-	if _, err := db.ExecContext(ctx, sqlstr, s.UserID, s.Addr, s.RuntimeName, s.Service); err != nil {
+	logf(sqlstr, s.UserID, s.Addr, s.Node, s.RuntimeName, s.Service)
+	if _, err := db.ExecContext(ctx, sqlstr, s.UserID, s.Addr, s.Node, s.RuntimeName, s.Service); err != nil {
 		return logerror(err)
 	}
 	return nil
@@ -87,16 +88,16 @@ func (s *Service) Upsert(ctx context.Context, db DB) error {
 	}
 	// upsert
 	const sqlstr = `INSERT INTO services (` +
-		`user_id, runtime_name, service, addr` +
+		`user_id, runtime_name, service, addr, node` +
 		`) VALUES (` +
-		`$1, $2, $3, $4` +
+		`$1, $2, $3, $4, $5` +
 		`)` +
 		` ON CONFLICT (runtime_name, service) DO ` +
 		`UPDATE SET ` +
-		`user_id = EXCLUDED.user_id, addr = EXCLUDED.addr `
+		`user_id = EXCLUDED.user_id, addr = EXCLUDED.addr, node = EXCLUDED.node `
 	// run
-	logf(sqlstr, s.UserID, s.RuntimeName, s.Service, s.Addr)
-	if _, err := db.ExecContext(ctx, sqlstr, s.UserID, s.RuntimeName, s.Service, s.Addr); err != nil {
+	logf(sqlstr, s.UserID, s.RuntimeName, s.Service, s.Addr, s.Node)
+	if _, err := db.ExecContext(ctx, sqlstr, s.UserID, s.RuntimeName, s.Service, s.Addr, s.Node); err != nil {
 		return logerror(err)
 	}
 	// set exists
@@ -125,13 +126,47 @@ func (s *Service) Delete(ctx context.Context, db DB) error {
 	return nil
 }
 
+// ServicesByNode retrieves a row from 'services' as a Service.
+//
+// Generated from index 'idx_services_node'.
+func ServicesByNode(ctx context.Context, db DB, node string) ([]*Service, error) {
+	// query
+	const sqlstr = `SELECT ` +
+		`user_id, runtime_name, service, addr, node ` +
+		`FROM services ` +
+		`WHERE node = $1`
+	// run
+	logf(sqlstr, node)
+	rows, err := db.QueryContext(ctx, sqlstr, node)
+	if err != nil {
+		return nil, logerror(err)
+	}
+	defer rows.Close()
+	// process
+	var res []*Service
+	for rows.Next() {
+		s := Service{
+			_exists: true,
+		}
+		// scan
+		if err := rows.Scan(&s.UserID, &s.RuntimeName, &s.Service, &s.Addr, &s.Node); err != nil {
+			return nil, logerror(err)
+		}
+		res = append(res, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logerror(err)
+	}
+	return res, nil
+}
+
 // ServicesByUserIDRuntimeName retrieves a row from 'services' as a Service.
 //
 // Generated from index 'idx_services_runtime_name'.
 func ServicesByUserIDRuntimeName(ctx context.Context, db DB, userID, runtimeName string) ([]*Service, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`user_id, runtime_name, service, addr ` +
+		`user_id, runtime_name, service, addr, node ` +
 		`FROM services ` +
 		`WHERE user_id = $1 AND runtime_name = $2`
 	// run
@@ -148,7 +183,7 @@ func ServicesByUserIDRuntimeName(ctx context.Context, db DB, userID, runtimeName
 			_exists: true,
 		}
 		// scan
-		if err := rows.Scan(&s.UserID, &s.RuntimeName, &s.Service, &s.Addr); err != nil {
+		if err := rows.Scan(&s.UserID, &s.RuntimeName, &s.Service, &s.Addr, &s.Node); err != nil {
 			return nil, logerror(err)
 		}
 		res = append(res, &s)
@@ -165,7 +200,7 @@ func ServicesByUserIDRuntimeName(ctx context.Context, db DB, userID, runtimeName
 func ServiceByUserIDRuntimeNameService(ctx context.Context, db DB, userID, runtimeName, service string) (*Service, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`user_id, runtime_name, service, addr ` +
+		`user_id, runtime_name, service, addr, node ` +
 		`FROM services ` +
 		`WHERE user_id = $1 AND runtime_name = $2 AND service = $3`
 	// run
@@ -173,7 +208,7 @@ func ServiceByUserIDRuntimeNameService(ctx context.Context, db DB, userID, runti
 	s := Service{
 		_exists: true,
 	}
-	if err := db.QueryRowContext(ctx, sqlstr, userID, runtimeName, service).Scan(&s.UserID, &s.RuntimeName, &s.Service, &s.Addr); err != nil {
+	if err := db.QueryRowContext(ctx, sqlstr, userID, runtimeName, service).Scan(&s.UserID, &s.RuntimeName, &s.Service, &s.Addr, &s.Node); err != nil {
 		return nil, logerror(err)
 	}
 	return &s, nil
@@ -185,7 +220,7 @@ func ServiceByUserIDRuntimeNameService(ctx context.Context, db DB, userID, runti
 func ServiceByRuntimeNameService(ctx context.Context, db DB, runtimeName, service string) (*Service, error) {
 	// query
 	const sqlstr = `SELECT ` +
-		`user_id, runtime_name, service, addr ` +
+		`user_id, runtime_name, service, addr, node ` +
 		`FROM services ` +
 		`WHERE runtime_name = $1 AND service = $2`
 	// run
@@ -193,7 +228,7 @@ func ServiceByRuntimeNameService(ctx context.Context, db DB, runtimeName, servic
 	s := Service{
 		_exists: true,
 	}
-	if err := db.QueryRowContext(ctx, sqlstr, runtimeName, service).Scan(&s.UserID, &s.RuntimeName, &s.Service, &s.Addr); err != nil {
+	if err := db.QueryRowContext(ctx, sqlstr, runtimeName, service).Scan(&s.UserID, &s.RuntimeName, &s.Service, &s.Addr, &s.Node); err != nil {
 		return nil, logerror(err)
 	}
 	return &s, nil
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"context"
+)
+
+// RecentUserRuns returns the user's most recent runs, optionally only those
+// for the repo with the given full name, e.g. acme/widgets.
+//
+// This is written by hand rather than generated because each dialect has its
+// own JSON operators.
+func RecentUserRuns(ctx context.Context, db *Conn, userID, repo string, limit int) ([]*Run, error) {
+	var sqlstr string
+	switch db.Dialect {
+	case Postgres:
+		sqlstr = `SELECT ` +
+			`id, user_id, thunk_digest, start_time, end_time, succeeded, meta, cancelled, visibility, redacted ` +
+			`FROM runs ` +
+			`WHERE user_id = $1 AND ($2 = '' OR meta::jsonb #>> '{repo,full_name}' = $2) ` +
+			`ORDER BY start_time DESC ` +
+			`LIMIT $3`
+	default:
+		sqlstr = `SELECT ` +
+			`id, user_id, thunk_digest, start_time, end_time, succeeded, meta, cancelled, visibility, redacted ` +
+			`FROM runs ` +
+			`WHERE user_id = $1 AND ($2 = '' OR json_extract(meta, '$.repo.full_name') = $2) ` +
+			`ORDER BY start_time DESC ` +
+			`LIMIT $3`
+	}
+	// run
+	logf(sqlstr, userID, repo, limit)
+	rows, err := db.QueryContext(ctx, sqlstr, userID, repo, limit)
+	if err != nil {
+		return nil, logerror(err)
+	}
+	defer rows.Close()
+	// process
+	var res []*Run
+	for rows.Next() {
+		r := Run{
+			_exists: true,
+		}
+		// scan
+		if err := rows.Scan(&r.ID, &r.UserID, &r.ThunkDigest, &r.StartTime, &r.EndTime, &r.Succeeded, &r.Meta, &r.Cancelled, &r.Visibility, &r.Redacted); err != nil {
+			return nil, logerror(err)
+		}
+		res = append(res, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logerror(err)
+	}
+	return res, nil
+}
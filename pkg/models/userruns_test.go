@@ -0,0 +1,73 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vito/bass-loop/pkg/cfg"
+	"github.com/vito/is"
+)
+
+func TestRecentUserRuns(t *testing.T) {
+	is := is.New(t)
+
+	ctx := context.Background()
+
+	db, err := Open(&cfg.Config{
+		SQLitePath: filepath.Join(t.TempDir(), "loop.db"),
+	})
+	is.NoErr(err)
+	defer db.Close()
+
+	for _, user := range []*User{
+		{ID: "alice", Login: "alice"},
+		{ID: "bob", Login: "bob"},
+	} {
+		is.NoErr(user.Insert(ctx, db))
+	}
+
+	thunk := &Thunk{Digest: "digest", JSON: []byte(`{}`)}
+	is.NoErr(thunk.Insert(ctx, db))
+
+	now := time.Now().UTC()
+
+	for i, run := range []*Run{
+		{ID: "bass-1", UserID: "alice", Meta: sql.NullString{String: `{"repo":{"full_name":"vito/bass"}}`, Valid: true}},
+		{ID: "loop", UserID: "alice", Meta: sql.NullString{String: `{"repo":{"full_name":"vito/bass-loop"}}`, Valid: true}},
+		{ID: "no-meta", UserID: "alice"},
+		{ID: "bass-2", UserID: "alice", Meta: sql.NullString{String: `{"repo":{"full_name":"vito/bass"}}`, Valid: true}},
+		{ID: "bob", UserID: "bob", Meta: sql.NullString{String: `{"repo":{"full_name":"vito/bass"}}`, Valid: true}},
+	} {
+		run.ThunkDigest = thunk.Digest
+		run.StartTime = NewTime(now.Add(time.Duration(i) * time.Second))
+		run.Visibility = VisibilityPublic
+		is.NoErr(run.Insert(ctx, db))
+	}
+
+	ids := func(runs []*Run) []string {
+		ids := []string{}
+		for _, run := range runs {
+			ids = append(ids, run.ID)
+		}
+		return ids
+	}
+
+	runs, err := RecentUserRuns(ctx, db, "alice", "", 10)
+	is.NoErr(err)
+	is.Equal(ids(runs), []string{"bass-2", "no-meta", "loop", "bass-1"}) // latest first
+
+	runs, err = RecentUserRuns(ctx, db, "alice", "", 2)
+	is.NoErr(err)
+	is.Equal(ids(runs), []string{"bass-2", "no-meta"})
+
+	runs, err = RecentUserRuns(ctx, db, "alice", "vito/bass", 10)
+	is.NoErr(err)
+	is.Equal(ids(runs), []string{"bass-2", "bass-1"})
+
+	runs, err = RecentUserRuns(ctx, db, "alice", "vito/bass", 1)
+	is.NoErr(err)
+	is.Equal(ids(runs), []string{"bass-2"}) // limited after filtering
+}
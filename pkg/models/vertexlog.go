@@ -0,0 +1,258 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Markers surrounding each match in VertexLogResult.Highlighted.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// IndexVertexLog stores the plain text of a vertex's logs for searching,
+// replacing any previously stored logs.
+//
+// With SQLite, triggers keep the FTS5 index up to date, if there is one; see
+// setupVertexLogsFTS.
+func IndexVertexLog(ctx context.Context, db DB, runID, digest, content string) error {
+	// delete
+	const delstr = `DELETE FROM vertex_logs WHERE run_id = $1 AND digest = $2`
+	logf(delstr, runID, digest)
+	if _, err := db.ExecContext(ctx, delstr, runID, digest); err != nil {
+		return logerror(err)
+	}
+	// insert
+	const sqlstr = `INSERT INTO vertex_logs (run_id, digest, content) VALUES ($1, $2, $3)`
+	logf(sqlstr, runID, digest, content)
+	if _, err := db.ExecContext(ctx, sqlstr, runID, digest, content); err != nil {
+		return logerror(err)
+	}
+	return nil
+}
+
+// VertexLogResult represents vertex logs matching a search.
+type VertexLogResult struct {
+	RunID  string `json:"run_id"` // run_id
+	Digest string `json:"digest"` // digest
+	// the full logs, with each match surrounded by HighlightStart and
+	// HighlightEnd
+	Highlighted string `json:"highlighted"`
+}
+
+// SearchVertexLogs finds the vertex logs containing the phrase, best matches
+// first, skipping the first offset matches.
+//
+// If SQLite doesn't have FTS5, the logs are searched for the phrase as-is
+// instead.
+//
+// This is written by hand rather than generated because each dialect has its
+// own full-text search.
+func SearchVertexLogs(ctx context.Context, db *Conn, phrase string, limit, offset int) ([]*VertexLogResult, error) {
+	var sqlstr string
+	var args []any
+	switch db.Dialect {
+	case Postgres:
+		sqlstr = `SELECT run_id, digest, ts_headline('simple', content, phraseto_tsquery('simple', $1), $2) ` +
+			`FROM vertex_logs ` +
+			`WHERE to_tsvector('simple', content) @@ phraseto_tsquery('simple', $1) ` +
+			`ORDER BY ts_rank(to_tsvector('simple', content), phraseto_tsquery('simple', $1)) DESC, run_id, digest ` +
+			`LIMIT $3 OFFSET $4`
+		args = []any{
+			phrase,
+			"HighlightAll=true, StartSel=" + HighlightStart + ", StopSel=" + HighlightEnd,
+			limit,
+			offset,
+		}
+	case SQLite:
+		if !db.FTS5 {
+			return searchVertexLogsLike(ctx, db, phrase, limit, offset)
+		}
+
+		sqlstr = `SELECT l.run_id, l.digest, highlight(vertex_logs_fts, 0, $1, $2) ` +
+			`FROM vertex_logs_fts ` +
+			`JOIN vertex_logs l ON l.rowid = vertex_logs_fts.rowid ` +
+			`WHERE vertex_logs_fts MATCH $3 ` +
+			`ORDER BY rank, l.run_id, l.digest ` +
+			`LIMIT $4 OFFSET $5`
+		args = []any{HighlightStart, HighlightEnd, ftsPhrase(phrase), limit, offset}
+	default:
+		return nil, fmt.Errorf("unknown dialect: %s", db.Dialect)
+	}
+	// run
+	logf(sqlstr, args...)
+	rows, err := db.QueryContext(ctx, sqlstr, args...)
+	if err != nil {
+		return nil, logerror(err)
+	}
+	defer rows.Close()
+	// load results
+	var res []*VertexLogResult
+	for rows.Next() {
+		var vlr VertexLogResult
+		// scan
+		if err := rows.Scan(&vlr.RunID, &vlr.Digest, &vlr.Highlighted); err != nil {
+			return nil, logerror(err)
+		}
+		res = append(res, &vlr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logerror(err)
+	}
+	return res, nil
+}
+
+// ftsPhrase quotes the phrase for an FTS5 query so that its punctuation isn't
+// interpreted as query syntax, e.g. the colon in "panic: nil map".
+func ftsPhrase(phrase string) string {
+	return `"` + strings.ReplaceAll(phrase, `"`, `""`) + `"`
+}
+
+// searchVertexLogsLike finds the vertex logs containing the phrase, ignoring
+// ASCII case, for when SQLite doesn't have FTS5.
+//
+// Matches are scanned for rather than ranked, so they're ordered by run.
+func searchVertexLogsLike(ctx context.Context, db DB, phrase string, limit, offset int) ([]*VertexLogResult, error) {
+	// query
+	const sqlstr = `SELECT run_id, digest, content ` +
+		`FROM vertex_logs ` +
+		`WHERE content LIKE $1 ESCAPE '\' ` +
+		`ORDER BY run_id, digest ` +
+		`LIMIT $2 OFFSET $3`
+	pattern := "%" + likeEscaper.Replace(phrase) + "%"
+	// run
+	logf(sqlstr, pattern, limit, offset)
+	rows, err := db.QueryContext(ctx, sqlstr, pattern, limit, offset)
+	if err != nil {
+		return nil, logerror(err)
+	}
+	defer rows.Close()
+	// load results
+	var res []*VertexLogResult
+	for rows.Next() {
+		var vlr VertexLogResult
+		var content string
+		// scan
+		if err := rows.Scan(&vlr.RunID, &vlr.Digest, &content); err != nil {
+			return nil, logerror(err)
+		}
+		vlr.Highlighted = highlight(content, phrase)
+		res = append(res, &vlr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logerror(err)
+	}
+	return res, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// highlight surrounds each occurrence of the phrase in the content with
+// HighlightStart and HighlightEnd, ignoring ASCII case like LIKE does.
+func highlight(content, phrase string) string {
+	if phrase == "" {
+		return content
+	}
+
+	lowerContent := lowerASCII(content)
+	lowerPhrase := lowerASCII(phrase)
+
+	var out strings.Builder
+	for {
+		i := strings.Index(lowerContent, lowerPhrase)
+		if i == -1 {
+			break
+		}
+
+		end := i + len(phrase)
+		out.WriteString(content[:i])
+		out.WriteString(HighlightStart)
+		out.WriteString(content[i:end])
+		out.WriteString(HighlightEnd)
+
+		content, lowerContent = content[end:], lowerContent[end:]
+	}
+
+	out.WriteString(content)
+
+	return out.String()
+}
+
+// lowerASCII lowercases only ASCII letters, so that the result lines up with
+// the original byte for byte.
+func lowerASCII(str string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+
+		return r
+	}, str)
+}
+
+// setupVertexLogsFTS indexes vertex_logs in an FTS5 table if SQLite has FTS5,
+// returning whether it does.
+//
+// The index is kept up to date by triggers. Without FTS5 the triggers are
+// dropped, since they'd fail, so if they're missing the index may have missed
+// some logs and is rebuilt.
+func setupVertexLogsFTS(db *sql.DB) (bool, error) {
+	var fts5 bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5); err != nil {
+		return false, fmt.Errorf("check for fts5: %w", err)
+	}
+
+	if !fts5 {
+		for _, trigger := range []string{"vertex_logs_ai", "vertex_logs_ad", "vertex_logs_au"} {
+			if _, err := db.Exec(`DROP TRIGGER IF EXISTS ` + trigger); err != nil {
+				return false, fmt.Errorf("drop trigger %s: %w", trigger, err)
+			}
+		}
+
+		return false, nil
+	}
+
+	var triggers int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND tbl_name = 'vertex_logs'`).Scan(&triggers); err != nil {
+		return false, fmt.Errorf("check for triggers: %w", err)
+	}
+
+	if triggers > 0 {
+		return true, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS vertex_logs_fts USING fts5(content, content='vertex_logs', content_rowid='rowid')`,
+		`CREATE TRIGGER vertex_logs_ai AFTER INSERT ON vertex_logs BEGIN ` +
+			`INSERT INTO vertex_logs_fts (rowid, content) VALUES (new.rowid, new.content); ` +
+			`END`,
+		`CREATE TRIGGER vertex_logs_ad AFTER DELETE ON vertex_logs BEGIN ` +
+			`INSERT INTO vertex_logs_fts (vertex_logs_fts, rowid, content) VALUES ('delete', old.rowid, old.content); ` +
+			`END`,
+		`CREATE TRIGGER vertex_logs_au AFTER UPDATE ON vertex_logs BEGIN ` +
+			`INSERT INTO vertex_logs_fts (vertex_logs_fts, rowid, content) VALUES ('delete', old.rowid, old.content); ` +
+			`INSERT INTO vertex_logs_fts (rowid, content) VALUES (new.rowid, new.content); ` +
+			`END`,
+		`INSERT INTO vertex_logs_fts (vertex_logs_fts) VALUES ('rebuild')`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return false, fmt.Errorf("index vertex logs: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
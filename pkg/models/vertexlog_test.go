@@ -0,0 +1,56 @@
+package models
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/vito/bass-loop/pkg/cfg"
+	"github.com/vito/is"
+)
+
+func TestSearchVertexLogs(t *testing.T) {
+	is := is.New(t)
+
+	ctx := context.Background()
+
+	// searched with FTS5 if built with -tags sqlite_fts5, LIKE otherwise
+	db, err := Open(&cfg.Config{
+		SQLitePath: filepath.Join(t.TempDir(), "loop.db"),
+	})
+	is.NoErr(err)
+	defer db.Close()
+
+	is.NoErr(IndexVertexLog(ctx, db, "bass", "vertex", "fetching deps\nbuilding bass\n"))
+	is.NoErr(IndexVertexLog(ctx, db, "loop", "vertex", "building loop\n"))
+	is.NoErr(IndexVertexLog(ctx, db, "loop", "vertex", "panic: nil map\n")) // replaces the old logs
+
+	results, err := SearchVertexLogs(ctx, db, "building bass", 10, 0)
+	is.NoErr(err)
+	is.Equal(len(results), 1)
+	is.Equal(results[0].RunID, "bass")
+	is.Equal(results[0].Digest, "vertex")
+	is.True(results[0].Highlighted != "fetching deps\nbuilding bass\n") // highlighted
+
+	results, err = SearchVertexLogs(ctx, db, "building loop", 10, 0)
+	is.NoErr(err)
+	is.Equal(len(results), 0) // replaced
+
+	results, err = SearchVertexLogs(ctx, db, "panic: nil map", 10, 0)
+	is.NoErr(err)
+	is.Equal(len(results), 1) // punctuation isn't query syntax
+	is.Equal(results[0].RunID, "loop")
+
+	results, err = SearchVertexLogs(ctx, db, "building", 10, 1)
+	is.NoErr(err)
+	is.Equal(len(results), 0) // past the only match
+}
+
+func TestHighlight(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(highlight("no match", "panic"), "no match")
+	is.Equal(highlight("panic: PANIC", "panic"), HighlightStart+"panic"+HighlightEnd+": "+HighlightStart+"PANIC"+HighlightEnd)
+	is.Equal(highlight("100% done", "100%"), HighlightStart+"100%"+HighlightEnd+" done")
+	is.Equal(highlight("naïve Naïve", "naïve"), HighlightStart+"naïve"+HighlightEnd+" "+HighlightStart+"Naïve"+HighlightEnd)
+}
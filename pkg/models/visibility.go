@@ -0,0 +1,149 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// Run visibility levels.
+const (
+	// VisibilityPublic runs may be viewed by anyone.
+	VisibilityPublic = "public"
+
+	// VisibilityCollaborators runs may be viewed by the user who ran them and
+	// by collaborators on the run's repo.
+	VisibilityCollaborators = "collaborators"
+
+	// VisibilityOwner runs may only be viewed by the user who ran them.
+	VisibilityOwner = "owner"
+)
+
+// integrations whose meta may describe the run's repo, by the forge they
+// default to
+var repoMetaKeys = map[string]string{
+	"github": "github",
+	"gitea":  "gitea",
+	"http":   "",
+}
+
+// RunRepo describes the repo a run belongs to.
+type RunRepo struct {
+	// Forge hosting the repo, e.g. github.
+	Forge string
+
+	// FullName of the repo, e.g. vito/bass.
+	FullName string
+
+	// Private is true if the repo is private.
+	Private bool
+}
+
+// Repo returns the repo the run belongs to, if any.
+func (r *Run) Repo() (RunRepo, bool) {
+	if !r.Meta.Valid {
+		return RunRepo{}, false
+	}
+
+	var meta map[string]any
+	if err := json.Unmarshal([]byte(r.Meta.String), &meta); err != nil {
+		return RunRepo{}, false
+	}
+
+	return metaRepo(meta)
+}
+
+// DefaultVisibility returns the visibility of a new run of the thunk.
+//
+// Runs are private if the thunk has secrets or the run's repo is private.
+// Private runs of a repo are visible to the repo's collaborators; otherwise
+// they are only visible to the user who ran them.
+func DefaultVisibility(thunkJSON []byte, metaJSON []byte) string {
+	var meta map[string]any
+	if len(metaJSON) > 0 {
+		// meta is always an object; ignore it if not
+		_ = json.Unmarshal(metaJSON, &meta)
+	}
+
+	repo, hasRepo := metaRepo(meta)
+
+	if !repo.Private && !HasSecrets(thunkJSON) {
+		return VisibilityPublic
+	}
+
+	if hasRepo {
+		return VisibilityCollaborators
+	}
+
+	return VisibilityOwner
+}
+
+// HasSecrets returns true if the thunk JSON contains any secret values.
+//
+// Secret values are never encoded, but their presence is, as
+// {"secret":{"name":"..."}}.
+func HasSecrets(thunkJSON []byte) bool {
+	var val any
+	if err := json.Unmarshal(thunkJSON, &val); err != nil {
+		// be safe
+		return true
+	}
+
+	return hasSecrets(val)
+}
+
+func hasSecrets(val any) bool {
+	switch x := val.(type) {
+	case map[string]any:
+		if secret, ok := x["secret"].(map[string]any); ok {
+			if _, named := secret["name"]; named {
+				return true
+			}
+		}
+
+		for _, v := range x {
+			if hasSecrets(v) {
+				return true
+			}
+		}
+	case []any:
+		for _, v := range x {
+			if hasSecrets(v) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func metaRepo(meta map[string]any) (RunRepo, bool) {
+	for key, forge := range repoMetaKeys {
+		integration, ok := meta[key].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		repo, ok := integration["repo"].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		fullName, _ := repo["full_name"].(string)
+		if fullName == "" {
+			continue
+		}
+
+		if repoForge, ok := repo["forge"].(string); ok {
+			forge = repoForge
+		}
+
+		private, _ := repo["private"].(bool)
+
+		return RunRepo{
+			Forge:    forge,
+			FullName: fullName,
+			Private:  private,
+		}, true
+	}
+
+	return RunRepo{}, false
+}
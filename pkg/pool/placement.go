@@ -0,0 +1,80 @@
+package pool
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass/pkg/zapctx"
+	"github.com/vito/progrock"
+	"go.uber.org/zap"
+)
+
+// placementWriter notes the runtime that ran each vertex of a run as the
+// vertex is reported, passing the status along to the run's recorder.
+//
+// The placements are buffered so that reporting progress never waits on the
+// database, and written together by flush once the runtime is done.
+type placementWriter struct {
+	ctx      context.Context
+	runID    string
+	runtime  Runtime
+	recorder *progrock.Recorder
+
+	placed  map[string]bool
+	pending []*models.VertexRuntime
+	l       sync.Mutex
+}
+
+func (w *placementWriter) WriteStatus(status *progrock.StatusUpdate) error {
+	w.l.Lock()
+
+	if w.placed == nil {
+		w.placed = map[string]bool{}
+	}
+
+	for _, vtx := range status.Vertexes {
+		if w.placed[vtx.Id] {
+			continue
+		}
+
+		w.placed[vtx.Id] = true
+
+		w.pending = append(w.pending, &models.VertexRuntime{
+			RunID:       w.runID,
+			Digest:      vtx.Id,
+			UserID:      w.runtime.UserID,
+			RuntimeName: w.runtime.Name,
+			Os:          w.runtime.Platform.OS,
+			Arch:        w.runtime.Platform.Architecture,
+		})
+	}
+
+	w.l.Unlock()
+
+	return w.recorder.Record(status)
+}
+
+// flush records the placements buffered since the last flush.
+func (w *placementWriter) flush() {
+	w.l.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.l.Unlock()
+
+	logger := zapctx.FromContext(w.ctx)
+
+	for _, placement := range pending {
+		// the run may have been canceled, but where it ran is still worth
+		// knowing
+		if err := placement.Upsert(context.Background(), w.runtime.DB); err != nil {
+			logger.Warn("failed to record vertex runtime",
+				zap.String("vertex", placement.Digest),
+				zap.Error(err))
+		}
+	}
+}
+
+func (w *placementWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package pool
+
+import (
+	"fmt"
+)
+
+// Policy decides which runtime to use when several can run a thunk.
+type Policy string
+
+const (
+	// LeastLoadedPolicy selects the runtime used by the fewest active runs,
+	// taking turns between runtimes that are equally loaded.
+	LeastLoadedPolicy Policy = "least-loaded"
+
+	// RoundRobinPolicy takes turns between runtimes.
+	RoundRobinPolicy Policy = "round-robin"
+
+	// FirstPolicy always selects the first runtime that was registered.
+	FirstPolicy Policy = "first"
+)
+
+// DefaultPolicy is the policy used when none is configured.
+const DefaultPolicy = LeastLoadedPolicy
+
+// ParsePolicy parses a policy name, returning the default policy if it's
+// empty.
+func ParsePolicy(name string) (Policy, error) {
+	switch policy := Policy(name); policy {
+	case "":
+		return DefaultPolicy, nil
+	case LeastLoadedPolicy, RoundRobinPolicy, FirstPolicy:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown runtime policy %q; expected %s, %s, or %s", name, LeastLoadedPolicy, RoundRobinPolicy, FirstPolicy)
+	}
+}
+
+// choose selects one of the candidates, given the number of selections made
+// before.
+func (policy Policy) choose(candidates []Runtime, turn uint64) Runtime {
+	offset := int(turn % uint64(len(candidates)))
+
+	switch policy {
+	case FirstPolicy:
+		return candidates[0]
+	case RoundRobinPolicy:
+		return candidates[offset]
+	default:
+		var chosen Runtime
+		least := -1
+		for i := range candidates {
+			rt := candidates[(offset+i)%len(candidates)]
+
+			var load int
+			if rt.Active != nil {
+				load = len(rt.Active.Using(rt.Name))
+			}
+
+			if least == -1 || load < least {
+				chosen = rt
+				least = load
+			}
+		}
+
+		return chosen
+	}
+}
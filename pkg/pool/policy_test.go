@@ -0,0 +1,132 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/vito/bass-loop/pkg/runs"
+)
+
+func TestParsePolicy(t *testing.T) {
+	for _, example := range []struct {
+		Name   string
+		Policy Policy
+		Err    bool
+	}{
+		{Name: "", Policy: DefaultPolicy},
+		{Name: "least-loaded", Policy: LeastLoadedPolicy},
+		{Name: "round-robin", Policy: RoundRobinPolicy},
+		{Name: "first", Policy: FirstPolicy},
+		{Name: "random", Err: true},
+		{Name: "First", Err: true},
+	} {
+		example := example
+		t.Run(fmt.Sprintf("%q", example.Name), func(t *testing.T) {
+			policy, err := ParsePolicy(example.Name)
+			if example.Err {
+				if err == nil {
+					t.Fatalf("expected error, got policy %q", policy)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if policy != example.Policy {
+				t.Errorf("expected %q, got %q", example.Policy, policy)
+			}
+		})
+	}
+}
+
+func TestPolicyChoose(t *testing.T) {
+	for _, example := range []struct {
+		Name   string
+		Policy Policy
+		Turn   uint64
+
+		// runtime name => number of runs using it
+		Load map[string]int
+
+		Chosen string
+	}{
+		{
+			Name:   "first ignores turns",
+			Policy: FirstPolicy,
+			Turn:   2,
+			Chosen: "a",
+		},
+		{
+			Name:   "first ignores load",
+			Policy: FirstPolicy,
+			Load:   map[string]int{"a": 3},
+			Chosen: "a",
+		},
+		{
+			Name:   "round-robin takes turns",
+			Policy: RoundRobinPolicy,
+			Turn:   1,
+			Chosen: "b",
+		},
+		{
+			Name:   "round-robin wraps around",
+			Policy: RoundRobinPolicy,
+			Turn:   4,
+			Chosen: "b",
+		},
+		{
+			Name:   "round-robin ignores load",
+			Policy: RoundRobinPolicy,
+			Load:   map[string]int{"a": 3},
+			Chosen: "a",
+		},
+		{
+			Name:   "least-loaded picks the idlest",
+			Policy: LeastLoadedPolicy,
+			Load:   map[string]int{"a": 2, "b": 1, "c": 3},
+			Chosen: "b",
+		},
+		{
+			Name:   "least-loaded takes turns between equals",
+			Policy: LeastLoadedPolicy,
+			Turn:   2,
+			Load:   map[string]int{"b": 1},
+			Chosen: "c",
+		},
+		{
+			Name:   "least-loaded wraps around between equals",
+			Policy: LeastLoadedPolicy,
+			Turn:   2,
+			Load:   map[string]int{"c": 1},
+			Chosen: "a",
+		},
+	} {
+		example := example
+		t.Run(example.Name, func(t *testing.T) {
+			active := runs.NewActive()
+
+			for name, load := range example.Load {
+				for i := 0; i < load; i++ {
+					ctx, untrack := active.Track(context.Background(), fmt.Sprintf("%s-run-%d", name, i))
+					defer untrack()
+					defer active.Use(ctx, name)()
+				}
+			}
+
+			candidates := []Runtime{
+				{Name: "a", Active: active},
+				{Name: "b", Active: active},
+				{Name: "c", Active: active},
+			}
+
+			chosen := example.Policy.choose(candidates, example.Turn)
+			if chosen.Name != example.Chosen {
+				t.Errorf("expected %s, got %s", example.Chosen, chosen.Name)
+			}
+		})
+	}
+}
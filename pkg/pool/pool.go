@@ -0,0 +1,287 @@
+// Package pool implements the runtime pool for running a user's thunks on
+// their forwarded runtimes.
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/runs"
+	"github.com/vito/bass/pkg/bass"
+	"github.com/vito/bass/pkg/runtimes"
+	"github.com/vito/progrock"
+)
+
+// Pool is a bass.RuntimePool of forwarded runtimes.
+type Pool struct {
+	Runtimes []Runtime
+
+	// Policy decides between runtimes which can run the same platform.
+	Policy Policy
+
+	// counter for round-robin selection
+	next atomic.Uint64
+}
+
+var _ bass.RuntimePool = (*Pool)(nil)
+
+// Runtime is a forwarded runtime.
+type Runtime struct {
+	// UserID is the ID of the user who forwarded the runtime.
+	UserID string
+
+	// Name is the name of the runtime, i.e. the runner's SSH session ID.
+	Name string
+
+	// Priority is the priority the runtime was registered with. Runtimes with
+	// a higher priority are preferred.
+	Priority int
+
+	// Platform is the platform the runtime was registered with.
+	Platform bass.Platform
+
+	// Labels are the labels the runtime was registered with.
+	Labels models.Labels
+
+	// Active, if set, records the runs using the runtime.
+	Active *runs.Active
+
+	// DB, if set, records which runtime ran each vertex of a run.
+	DB models.DB
+
+	bass.Runtime
+}
+
+// Run runs the thunk, recording that the context's run is using the runtime
+// while it runs.
+func (rt Runtime) Run(ctx context.Context, thunk bass.Thunk) error {
+	ctx, done := rt.use(ctx)
+	defer done()
+
+	return rt.Runtime.Run(ctx, thunk)
+}
+
+// Read runs the thunk and writes its output, recording that the context's
+// run is using the runtime while it runs.
+func (rt Runtime) Read(ctx context.Context, w io.Writer, thunk bass.Thunk) error {
+	ctx, done := rt.use(ctx)
+	defer done()
+
+	return rt.Runtime.Read(ctx, w, thunk)
+}
+
+// Export exports the thunk, recording that the context's run is using the
+// runtime while it runs.
+func (rt Runtime) Export(ctx context.Context, w io.Writer, thunk bass.Thunk) error {
+	ctx, done := rt.use(ctx)
+	defer done()
+
+	return rt.Runtime.Export(ctx, w, thunk)
+}
+
+// ExportPath exports the thunk path, recording that the context's run is
+// using the runtime while it runs.
+func (rt Runtime) ExportPath(ctx context.Context, w io.Writer, path bass.ThunkPath) error {
+	ctx, done := rt.use(ctx)
+	defer done()
+
+	return rt.Runtime.ExportPath(ctx, w, path)
+}
+
+// Publish publishes the thunk, recording that the context's run is using the
+// runtime while it runs.
+func (rt Runtime) Publish(ctx context.Context, ref bass.ImageRef, thunk bass.Thunk) (bass.ImageRef, error) {
+	ctx, done := rt.use(ctx)
+	defer done()
+
+	return rt.Runtime.Publish(ctx, ref, thunk)
+}
+
+// use records that the context's run is using the runtime and which of its
+// vertices the runtime runs.
+func (rt Runtime) use(ctx context.Context) (context.Context, func()) {
+	done := func() {}
+	if rt.Active != nil {
+		done = rt.Active.Use(ctx, rt.Name)
+	}
+
+	if rt.DB != nil {
+		if runID, ok := runs.RunIDFromContext(ctx); ok {
+			placements := &placementWriter{
+				ctx:      ctx,
+				runID:    runID,
+				runtime:  rt,
+				recorder: progrock.RecorderFromContext(ctx),
+			}
+
+			ctx = progrock.RecorderToContext(ctx, progrock.NewRecorder(placements))
+
+			release := done
+			done = func() {
+				placements.flush()
+				release()
+			}
+		}
+	}
+
+	return ctx, done
+}
+
+// Select returns a runtime matching the platform.
+//
+// The runtimes with the highest priority are preferred, and the pool's
+// policy decides between them.
+func (pool *Pool) Select(platform bass.Platform) (bass.Runtime, error) {
+	var candidates []Runtime
+	for _, rt := range pool.Runtimes {
+		if !platform.CanSelect(rt.Platform) {
+			continue
+		}
+
+		if len(candidates) > 0 && rt.Priority < candidates[0].Priority {
+			continue
+		}
+
+		if len(candidates) > 0 && rt.Priority > candidates[0].Priority {
+			candidates = nil
+		}
+
+		candidates = append(candidates, rt)
+	}
+
+	if len(candidates) == 0 {
+		return nil, runtimes.NoRuntimeError{
+			Platform:    platform,
+			AllRuntimes: pool.assocs(),
+		}
+	}
+
+	return pool.Policy.choose(candidates, pool.next.Add(1)-1), nil
+}
+
+// All returns all runtimes in the pool.
+func (pool *Pool) All() ([]bass.Runtime, error) {
+	var all []bass.Runtime
+	for _, rt := range pool.Runtimes {
+		all = append(all, rt)
+	}
+
+	return all, nil
+}
+
+// CanRun returns true if the pool has a runtime for the thunk's platform.
+func (pool *Pool) CanRun(thunk bass.Thunk) bool {
+	platform := thunk.Platform()
+	if platform == nil {
+		return len(pool.Runtimes) > 0
+	}
+
+	_, err := pool.Select(*platform)
+	return err == nil
+}
+
+// Filter returns a pool containing only the runtimes with the required
+// labels.
+//
+// The returned pool shares runtimes with the original pool, so only the
+// original pool should be closed.
+func (pool *Pool) Filter(required models.Labels) *Pool {
+	filtered := &Pool{Policy: pool.Policy}
+	for _, rt := range pool.Runtimes {
+		if rt.Labels.Satisfies(required) {
+			filtered.Runtimes = append(filtered.Runtimes, rt)
+		}
+	}
+
+	return filtered
+}
+
+// WithRequired narrows the context's runtime pool to the runtimes with the
+// required labels.
+func WithRequired(ctx context.Context, required models.Labels) (context.Context, *Pool, error) {
+	ctxPool, err := bass.RuntimePoolFromContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userPool, ok := ctxPool.(*Pool)
+	if !ok {
+		return nil, nil, fmt.Errorf("cannot select runtimes by label from %T", ctxPool)
+	}
+
+	if len(required) == 0 {
+		return ctx, userPool, nil
+	}
+
+	filtered := userPool.Filter(required)
+
+	return bass.WithRuntimePool(ctx, filtered), filtered, nil
+}
+
+// Close closes all runtimes in the pool.
+func (pool *Pool) Close() error {
+	var errs []error
+	for _, rt := range pool.Runtimes {
+		if err := rt.Runtime.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (pool *Pool) assocs() []runtimes.Assoc {
+	var assocs []runtimes.Assoc
+	for _, rt := range pool.Runtimes {
+		assocs = append(assocs, runtimes.Assoc{
+			Platform: rt.Platform,
+			Runtime:  rt.Runtime,
+		})
+	}
+
+	return assocs
+}
+
+// RunsOnLabel is the thunk label specifying the runtime labels required to
+// run it, e.g.:
+//
+//	(with-label thunk :runs-on {:trusted true :region "eu"})
+const RunsOnLabel = "runs-on"
+
+// RequiredLabels returns the runtime labels required by the thunk, if any.
+func RequiredLabels(thunk bass.Thunk) (models.Labels, error) {
+	required := models.Labels{}
+	if thunk.Labels == nil {
+		return required, nil
+	}
+
+	val, found := thunk.Labels.Get(bass.Symbol(RunsOnLabel))
+	if !found {
+		return required, nil
+	}
+
+	var scope *bass.Scope
+	if err := val.Decode(&scope); err != nil {
+		return nil, fmt.Errorf("%s label: %w", RunsOnLabel, err)
+	}
+
+	err := scope.Each(func(sym bass.Symbol, val bass.Value) error {
+		var str string
+		if err := val.Decode(&str); err == nil {
+			required[sym.String()] = str
+		} else {
+			required[sym.String()] = val.String()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return required, nil
+}
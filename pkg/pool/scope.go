@@ -0,0 +1,51 @@
+package pool
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scope kinds for sharing a runtime with others.
+const (
+	// OrgScopeKind shares a runtime with members of a GitHub organization.
+	OrgScopeKind = "org"
+
+	// RepoScopeKind shares a runtime with a GitHub repository.
+	RepoScopeKind = "repo"
+)
+
+// OrgScope returns the scope for runtimes shared with an organization.
+func OrgScope(org string) string {
+	return OrgScopeKind + ":" + strings.ToLower(org)
+}
+
+// RepoScope returns the scope for runtimes shared with a repository, given its
+// full name (owner/name).
+func RepoScope(fullName string) string {
+	return RepoScopeKind + ":" + strings.ToLower(fullName)
+}
+
+// ParseScope parses a scope like org:acme or repo:acme/widgets into its kind
+// and name.
+func ParseScope(scope string) (string, string, error) {
+	kind, name, ok := strings.Cut(scope, ":")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("malformed scope %q; expected org:<org> or repo:<owner>/<repo>", scope)
+	}
+
+	switch kind {
+	case OrgScopeKind:
+		if strings.Contains(name, "/") {
+			return "", "", fmt.Errorf("malformed org scope: %q", scope)
+		}
+	case RepoScopeKind:
+		owner, repo, ok := strings.Cut(name, "/")
+		if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return "", "", fmt.Errorf("malformed repo scope: %q", scope)
+		}
+	default:
+		return "", "", fmt.Errorf("unknown scope kind %q; expected %s or %s", kind, OrgScopeKind, RepoScopeKind)
+	}
+
+	return kind, strings.ToLower(name), nil
+}
@@ -0,0 +1,33 @@
+package present
+
+import (
+	"time"
+
+	"github.com/vito/bass-loop/pkg/models"
+)
+
+type Delivery struct {
+	ID          string `json:"id"`
+	Integration string `json:"integration"`
+	Event       string `json:"event"`
+	Status      string `json:"status"`
+	Attempts    int    `json:"attempts"`
+	Error       string `json:"error,omitempty"`
+	RunID       string `json:"run_id,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	AttemptAt   string `json:"attempt_at"`
+}
+
+func NewDelivery(model *models.Delivery) *Delivery {
+	return &Delivery{
+		ID:          model.ID,
+		Integration: model.Integration,
+		Event:       model.Event,
+		Status:      model.Status,
+		Attempts:    model.Attempts,
+		Error:       model.Error.String,
+		RunID:       model.RunID.String,
+		CreatedAt:   model.CreatedAt.Time().Format(time.RFC3339),
+		AttemptAt:   model.AttemptAt.Time().Format(time.RFC3339),
+	}
+}
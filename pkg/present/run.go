@@ -16,6 +16,9 @@ type Run struct {
 	CompletedAt string `json:"completed_at,omitempty"`
 	Duration    string `json:"duration"`
 	Succeeded   bool   `json:"succeeded"`
+	Cancelled   bool   `json:"cancelled"`
+	Visibility  string `json:"visibility"`
+	Redacted    bool   `json:"redacted"`
 
 	User  *User  `json:"user"`
 	Thunk *Thunk `json:"thunk"`
@@ -44,6 +47,10 @@ func NewRun(ctx context.Context, db models.DB, model *models.Run) (*Run, error)
 
 		StartedAt: model.StartTime.Time().Format(time.RFC3339),
 		Succeeded: model.Succeeded.Int64 == 1,
+		Cancelled: model.Cancelled == 1,
+
+		Visibility: model.Visibility,
+		Redacted:   model.Redacted == 1,
 
 		User:  NewUser(userModel),
 		Thunk: thunk,
@@ -0,0 +1,80 @@
+package present
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vito/bass-loop/pkg/models"
+)
+
+type Runtime struct {
+	Name        string        `json:"name"`
+	User        *User         `json:"user"`
+	Platform    string        `json:"platform"`
+	Priority    int           `json:"priority"`
+	Labels      models.Labels `json:"labels"`
+	Scope       string        `json:"scope,omitempty"`
+	Node        string        `json:"node"`
+	Services    []string      `json:"services"`
+	Healthy     bool          `json:"healthy"`
+	HealthError string        `json:"health_error,omitempty"`
+	CheckedAt   string        `json:"checked_at,omitempty"`
+	ConnectedAt string        `json:"connected_at,omitempty"`
+	HeartbeatAt string        `json:"heartbeat_at,omitempty"`
+	ExpiresAt   string        `json:"expires_at"`
+	Runs        []string      `json:"runs"`
+}
+
+// NewRuntime presents a runtime along with the IDs of the runs using it.
+func NewRuntime(ctx context.Context, db models.DB, model *models.Runtime, runIDs []string) (*Runtime, error) {
+	user, err := model.User(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	labels, err := model.LabelSet()
+	if err != nil {
+		return nil, err
+	}
+
+	svcs, err := models.ServicesByUserIDRuntimeName(ctx, db, model.UserID, model.Name)
+	if err != nil {
+		return nil, fmt.Errorf("get services: %w", err)
+	}
+
+	services := []string{}
+	for _, svc := range svcs {
+		services = append(services, svc.Service)
+	}
+
+	if runIDs == nil {
+		runIDs = []string{}
+	}
+
+	return &Runtime{
+		Name:        model.Name,
+		User:        NewUser(user),
+		Platform:    model.Os + "/" + model.Arch,
+		Priority:    model.Priority,
+		Labels:      labels,
+		Scope:       model.Scope,
+		Node:        model.Node,
+		Services:    services,
+		Healthy:     model.Healthy == 1,
+		HealthError: model.HealthError.String,
+		CheckedAt:   formatTime(model.CheckedAt),
+		ConnectedAt: formatTime(model.ConnectedAt),
+		HeartbeatAt: formatTime(model.HeartbeatAt),
+		ExpiresAt:   model.ExpiresAt.Time().Format(time.RFC3339),
+		Runs:        runIDs,
+	}, nil
+}
+
+func formatTime(t *models.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Time().Format(time.RFC3339)
+}
@@ -0,0 +1,88 @@
+package present
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/vito/bass-loop/pkg/models"
+)
+
+// SearchResult is a run whose logs matched a search.
+type SearchResult struct {
+	Run      *Run            `json:"run"`
+	Vertexes []*VertexSearch `json:"vertexes"`
+}
+
+// VertexSearch is a vertex whose logs matched a search.
+type VertexSearch struct {
+	Digest  string       `json:"digest"`
+	Name    string       `json:"name"`
+	Matches []*LineMatch `json:"matches"`
+}
+
+// LineMatch is a line of logs matching a search.
+type LineMatch struct {
+	// Line is the line number, starting from 1.
+	Line int `json:"line"`
+
+	// HTML is the line with each match wrapped in <mark>.
+	HTML string `json:"html"`
+
+	// URL links to the line on the run page.
+	URL string `json:"url"`
+}
+
+// NewVertexSearch presents the lines of a vertex's highlighted logs that
+// contain a match, up to max lines.
+func NewVertexSearch(model *models.Vertex, num int, highlighted string, max int) *VertexSearch {
+	search := &VertexSearch{
+		Digest:  model.Digest,
+		Name:    model.Name,
+		Matches: []*LineMatch{},
+	}
+
+	// whether a match spans from the previous line
+	var open bool
+
+	for i, line := range strings.Split(highlighted, "\n") {
+		if len(search.Matches) >= max {
+			break
+		}
+
+		matched := open || strings.Contains(line, models.HighlightStart)
+
+		if open {
+			line = models.HighlightStart + line
+		}
+
+		open = strings.LastIndex(line, models.HighlightStart) > strings.LastIndex(line, models.HighlightEnd)
+
+		if open {
+			line += models.HighlightEnd
+		}
+
+		if !matched {
+			continue
+		}
+
+		lnum := i + 1
+
+		search.Matches = append(search.Matches, &LineMatch{
+			Line: lnum,
+			HTML: highlightHTML(line),
+			URL:  fmt.Sprintf("/runs/%s#V%dL%d", model.RunID, num, lnum),
+		})
+	}
+
+	return search
+}
+
+// highlightHTML escapes the line and replaces its highlight markers with
+// <mark> tags.
+func highlightHTML(line string) string {
+	return strings.NewReplacer(
+		models.HighlightStart, "<mark>",
+		models.HighlightEnd, "</mark>",
+	).Replace(html.EscapeString(line))
+}
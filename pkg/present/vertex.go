@@ -3,6 +3,7 @@ package present
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"sort"
 	"strings"
 	"time"
@@ -13,12 +14,30 @@ import (
 )
 
 type Vertex struct {
-	Num      int     `json:"num"`
-	Name     string  `json:"name"`
-	Duration string  `json:"duration"`
-	Lines    []*Line `json:"lines"`
-	Cached   bool    `json:"cached"`
-	Error    string  `json:"error,omitempty"`
+	Num         int     `json:"num"`
+	Digest      string  `json:"digest"`
+	URL         string  `json:"url"`
+	Name        string  `json:"name"`
+	StartedAt   string  `json:"started_at,omitempty"`
+	CompletedAt string  `json:"completed_at,omitempty"`
+	Duration    string  `json:"duration"`
+	Lines       []*Line `json:"lines"`
+	Cached      bool    `json:"cached"`
+	Error       string  `json:"error,omitempty"`
+
+	// LogOffset is the line that Lines start at, for live updates which only
+	// include the lines written since the last update.
+	LogOffset int `json:"log_offset,omitempty"`
+
+	// Runtime is the runtime the vertex ran on, if known.
+	Runtime *VertexRuntime `json:"runtime,omitempty"`
+}
+
+// VertexRuntime is the runtime a vertex ran on.
+type VertexRuntime struct {
+	Name     string `json:"name"`
+	User     *User  `json:"user"`
+	Platform string `json:"platform"`
 }
 
 type Line struct {
@@ -28,50 +47,151 @@ type Line struct {
 func Vertexes(ctx context.Context, conn models.DB, bucket *blobs.Bucket, vertexModels []*models.Vertex) ([]*Vertex, error) {
 	vertexes := []*Vertex{}
 
-	sort.Slice(vertexModels, func(i, j int) bool {
-		return vertexModels[i].EndTime.Time().Before(vertexModels[j].EndTime.Time())
-	})
+	sortVertexes(vertexModels)
+
+	placements := map[string]*VertexRuntime{}
+	if len(vertexModels) > 0 {
+		rts, err := models.VertexRuntimesByRunID(ctx, conn, vertexModels[0].RunID)
+		if err != nil {
+			return nil, fmt.Errorf("get vertex runtimes: %w", err)
+		}
+
+		presented := map[string]*VertexRuntime{}
+		for _, rt := range rts {
+			key := rt.UserID + "/" + rt.RuntimeName
+
+			runtime, found := presented[key]
+			if !found {
+				runtime, err = NewVertexRuntime(ctx, conn, rt)
+				if err != nil {
+					return nil, err
+				}
+
+				presented[key] = runtime
+			}
+
+			placements[rt.Digest] = runtime
+		}
+	}
 
 	for i, model := range vertexModels {
 		if strings.Contains(model.Name, "[hide]") {
 			continue
 		}
 
-		logHTML, err := bucket.ReadAll(ctx, blobs.VertexHTMLLogKey(model))
-		if err != nil && gcerrors.Code(err) != gcerrors.NotFound {
-			return nil, fmt.Errorf("get vertex log: %w", err)
+		vertex, err := NewVertex(ctx, bucket, model, i+1)
+		if err != nil {
+			return nil, err
 		}
 
-		var lines []*Line
-		for _, content := range strings.Split(string(logHTML), "\n") {
-			lines = append(lines, &Line{
-				Content: content,
-			})
-		}
+		vertex.Runtime = placements[model.Digest]
 
-		// trim trailing empty lines
-		for i := len(lines) - 1; i >= 0; i-- {
-			if lines[i].Content == "" {
-				lines = lines[:i]
-			} else {
-				break
-			}
-		}
+		vertexes = append(vertexes, vertex)
+	}
 
-		var dur time.Duration
-		if model.EndTime != nil {
-			dur = model.EndTime.Time().Sub(model.StartTime.Time())
-		}
+	return vertexes, nil
+}
+
+// VertexNums returns the number of each vertex in its run, by digest, as
+// numbered on the run page.
+func VertexNums(vertexModels []*models.Vertex) map[string]int {
+	sorted := append([]*models.Vertex{}, vertexModels...)
+	sortVertexes(sorted)
+
+	nums := map[string]int{}
+	for i, model := range sorted {
+		nums[model.Digest] = i + 1
+	}
+
+	return nums
+}
+
+// sortVertexes sorts vertexes in the order they completed.
+func sortVertexes(vertexModels []*models.Vertex) {
+	sort.Slice(vertexModels, func(i, j int) bool {
+		return vertexModels[i].EndTime.Time().Before(vertexModels[j].EndTime.Time())
+	})
+}
+
+func NewVertex(ctx context.Context, bucket *blobs.Bucket, model *models.Vertex, num int) (*Vertex, error) {
+	logHTML, err := bucket.ReadAll(ctx, blobs.VertexHTMLLogKey(model))
+	if err != nil && gcerrors.Code(err) != gcerrors.NotFound {
+		return nil, fmt.Errorf("get vertex log: %w", err)
+	}
+
+	return NewLiveVertex(model, logHTML, num), nil
+}
 
-		vertexes = append(vertexes, &Vertex{
-			Num:      i + 1,
-			Name:     model.Name,
-			Duration: Duration(dur),
-			Lines:    lines,
-			Cached:   model.Cached == 1,
-			Error:    model.Error.String,
+// NewLiveVertex presents a vertex using already-rendered log HTML, e.g. from
+// a run that is still in flight.
+func NewLiveVertex(model *models.Vertex, logHTML []byte, num int) *Vertex {
+	var lines []*Line
+	for _, content := range strings.Split(string(logHTML), "\n") {
+		lines = append(lines, &Line{
+			Content: content,
 		})
 	}
 
-	return vertexes, nil
+	// trim trailing empty lines
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i].Content == "" {
+			lines = lines[:i]
+		} else {
+			break
+		}
+	}
+
+	vertex := NewVertexLink(model)
+	vertex.Num = num
+	vertex.Lines = lines
+	return vertex
+}
+
+// NewVertexLink presents a vertex without loading its logs, e.g. for linking
+// to it from another vertex.
+func NewVertexLink(model *models.Vertex) *Vertex {
+	vertex := &Vertex{
+		Digest: model.Digest,
+		URL:    VertexURL(model),
+		Name:   model.Name,
+		Lines:  []*Line{},
+		Cached: model.Cached == 1,
+		Error:  model.Error.String,
+	}
+
+	if model.StartTime != nil && !model.StartTime.Time().IsZero() {
+		vertex.StartedAt = model.StartTime.Time().Format(time.RFC3339)
+	}
+
+	if model.EndTime != nil && !model.EndTime.Time().IsZero() {
+		vertex.CompletedAt = model.EndTime.Time().Format(time.RFC3339)
+	}
+
+	var dur time.Duration
+	if model.StartTime != nil && model.EndTime != nil {
+		dur = model.EndTime.Time().Sub(model.StartTime.Time())
+	}
+
+	vertex.Duration = Duration(dur)
+
+	return vertex
+}
+
+// NewVertexRuntime presents the runtime a vertex ran on.
+func NewVertexRuntime(ctx context.Context, db models.DB, model *models.VertexRuntime) (*VertexRuntime, error) {
+	user, err := models.UserByID(ctx, db, model.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+
+	return &VertexRuntime{
+		Name:     model.RuntimeName,
+		User:     NewUser(user),
+		Platform: model.Os + "/" + model.Arch,
+	}, nil
+}
+
+// VertexURL returns the path to the vertex's page.
+func VertexURL(model *models.Vertex) string {
+	return "/runs/" + model.RunID + "/vertexes/" + url.PathEscape(model.Digest)
 }
@@ -0,0 +1,432 @@
+// Package queue stores webhook deliveries in the database and dispatches them
+// with bounded concurrency, retrying failed attempts with backoff.
+//
+// Deliveries that were in flight when the process stopped are resumed on
+// startup if their run hadn't been created yet. Otherwise they are concluded
+// rather than run again, since their hook may have already run.
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/vito/bass-loop/pkg/cfg"
+	"github.com/vito/bass-loop/pkg/logs"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass/pkg/zapctx"
+	"go.uber.org/zap"
+)
+
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+const (
+	DefaultConcurrency = 8
+	DefaultMaxAttempts = 5
+)
+
+// how often to check for deliveries whose backoff has elapsed
+const pollInterval = 10 * time.Second
+
+// delay before the first retry; doubles with each attempt
+const baseBackoff = 10 * time.Second
+
+// how long to wait before trying a postponed delivery again
+const postponeInterval = 30 * time.Second
+
+// Postpone returns an error which causes the delivery to be tried again later
+// without counting as a failed attempt, e.g. while it waits for a runtime.
+func Postpone(reason error) error {
+	return postponeError{reason}
+}
+
+type postponeError struct {
+	error
+}
+
+func (err postponeError) Unwrap() error {
+	return err.error
+}
+
+// Abandon returns an error which causes the delivery to fail without being
+// retried.
+func Abandon(err error) error {
+	return abandonError{err}
+}
+
+type abandonError struct {
+	error
+}
+
+func (err abandonError) Unwrap() error {
+	return err.error
+}
+
+// Handler dispatches a delivery.
+//
+// If the handler creates a run for the delivery it should set and save the
+// delivery's RunID. Errors returned after that point are recorded but not retried, since
+// retrying would only run the hook again.
+type Handler func(context.Context, *models.Delivery) error
+
+type Queue struct {
+	DB          models.DB
+	Concurrency int
+	MaxAttempts int
+
+	// Node is the name of this node, recorded on the deliveries it claims.
+	Node string
+
+	logger *logs.Logger
+	wake   chan struct{}
+}
+
+func New(config *cfg.Config, logger *logs.Logger, db *models.Conn) *Queue {
+	concurrency := config.Deliveries.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	maxAttempts := config.Deliveries.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+
+	return &Queue{
+		DB:          db,
+		Concurrency: concurrency,
+		MaxAttempts: maxAttempts,
+		Node:        config.SSH.Node(),
+
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Enqueue stores a delivery and schedules it to be dispatched.
+//
+// Deliveries are identified by ID, so a repeated delivery is ignored unless
+// force is true, in which case it is dispatched again with the new payload.
+// Returns false if the delivery was ignored.
+func (q *Queue) Enqueue(ctx context.Context, integration, event, id string, payload []byte, force bool) (bool, error) {
+	now := models.NewTime(time.Now().UTC())
+
+	delivery, err := models.DeliveryByID(ctx, q.DB, id)
+	switch {
+	case err == nil:
+		if !force {
+			return false, nil
+		}
+
+		if delivery.Status == StatusRunning {
+			return false, fmt.Errorf("delivery %s is already running", id)
+		}
+
+		delivery.Event = event
+		delivery.Payload = payload
+		delivery.Status = StatusPending
+		delivery.Attempts = 0
+		delivery.Error = sql.NullString{}
+		delivery.RunID = sql.NullString{}
+		delivery.Postponed = 0
+		delivery.AttemptAt = now
+
+		if err := delivery.Update(ctx, q.DB); err != nil {
+			return false, fmt.Errorf("update delivery: %w", err)
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		delivery = &models.Delivery{
+			ID:          id,
+			Integration: integration,
+			Event:       event,
+			Payload:     payload,
+			Status:      StatusPending,
+			CreatedAt:   now,
+			AttemptAt:   now,
+		}
+
+		if err := delivery.Insert(ctx, q.DB); err != nil {
+			return false, fmt.Errorf("save delivery: %w", err)
+		}
+	default:
+		return false, fmt.Errorf("get delivery: %w", err)
+	}
+
+	q.notify()
+
+	return true, nil
+}
+
+// Redeliver schedules a delivery to be dispatched again from its stored
+// payload.
+//
+// The delivery's check run is kept so that a check still waiting for a runner
+// is reused rather than created again.
+func (q *Queue) Redeliver(ctx context.Context, id string) error {
+	delivery, err := models.DeliveryByID(ctx, q.DB, id)
+	if err != nil {
+		return fmt.Errorf("get delivery: %w", err)
+	}
+
+	if delivery.Status == StatusRunning {
+		return fmt.Errorf("delivery %s is already running", id)
+	}
+
+	delivery.Status = StatusPending
+	delivery.Attempts = 0
+	delivery.Error = sql.NullString{}
+	delivery.RunID = sql.NullString{}
+	delivery.Postponed = 0
+	delivery.AttemptAt = models.NewTime(time.Now().UTC())
+
+	if err := delivery.Update(ctx, q.DB); err != nil {
+		return fmt.Errorf("update delivery: %w", err)
+	}
+
+	q.notify()
+
+	return nil
+}
+
+// Hold stores a delivery which this node is already handling, e.g. a check
+// started by a hook which is waiting for a runtime.
+//
+// Held deliveries aren't dispatched while this node is running. If it stops
+// before the delivery is concluded with Finish, the delivery is resumed like
+// any other interrupted delivery.
+func (q *Queue) Hold(ctx context.Context, delivery *models.Delivery) error {
+	now := models.NewTime(time.Now().UTC())
+
+	delivery.Status = StatusRunning
+	delivery.Node = q.Node
+	delivery.Attempts = 1
+	delivery.CreatedAt = now
+	delivery.AttemptAt = now
+
+	if err := delivery.Insert(ctx, q.DB); err != nil {
+		return fmt.Errorf("save delivery: %w", err)
+	}
+
+	return nil
+}
+
+// Finish concludes a held delivery with the result of handling it.
+//
+// As with dispatched deliveries, an error after the delivery's run was
+// created is recorded but the delivery is still done.
+func (q *Queue) Finish(delivery *models.Delivery, err error) error {
+	switch {
+	case err == nil:
+		delivery.Status = StatusDone
+		delivery.Error = sql.NullString{}
+	case delivery.RunID.Valid:
+		delivery.Status = StatusDone
+		delivery.Error = sql.NullString{String: err.Error(), Valid: true}
+	default:
+		delivery.Status = StatusFailed
+		delivery.Error = sql.NullString{String: err.Error(), Valid: true}
+	}
+
+	if err := delivery.Update(context.Background(), q.DB); err != nil {
+		return fmt.Errorf("update delivery: %w", err)
+	}
+
+	return nil
+}
+
+// Wake schedules postponed deliveries to be dispatched again immediately, e.g.
+// once a runtime has been registered.
+//
+// Every postponed delivery is woken, no matter how many times it failed
+// before. Deliveries backing off after a failure are left be.
+func (q *Queue) Wake(ctx context.Context) error {
+	if err := models.WakeDeliveries(ctx, q.DB, models.NewTime(time.Now().UTC())); err != nil {
+		return fmt.Errorf("wake deliveries: %w", err)
+	}
+
+	q.notify()
+
+	return nil
+}
+
+// Run dispatches deliveries to the handler until the context is canceled.
+func (q *Queue) Run(ctx context.Context, handler Handler) error {
+	logger := q.logger
+
+	running, err := models.DeliveriesByStatus(ctx, q.DB, StatusRunning)
+	if err != nil {
+		return fmt.Errorf("get running deliveries: %w", err)
+	}
+
+	for _, delivery := range running {
+		if delivery.Node != q.Node {
+			// may still be running on a peer
+			continue
+		}
+
+		// interrupted by a restart; if the run was created the hook may have
+		// already run, so don't run it again automatically
+		switch {
+		case delivery.RunID.Valid:
+			logger.Warn("concluding interrupted delivery", zap.String("delivery", delivery.ID))
+			delivery.Status = StatusDone
+		case delivery.Attempts >= q.MaxAttempts:
+			logger.Warn("failing interrupted delivery", zap.String("delivery", delivery.ID))
+			delivery.Status = StatusFailed
+		default:
+			logger.Info("resuming interrupted delivery", zap.String("delivery", delivery.ID))
+			delivery.Status = StatusPending
+			delivery.AttemptAt = models.NewTime(time.Now().UTC())
+		}
+
+		delivery.Error = sql.NullString{String: "interrupted by a restart", Valid: true}
+
+		if err := delivery.Update(ctx, q.DB); err != nil {
+			return fmt.Errorf("conclude delivery %s: %w", delivery.ID, err)
+		}
+	}
+
+	slots := make(chan struct{}, q.Concurrency)
+
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+
+	for {
+		if err := q.dispatchDue(ctx, slots, handler); err != nil {
+			logger.Error("failed to dispatch deliveries", zap.Error(err))
+		}
+
+		select {
+		case <-q.wake:
+		case <-poll.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (q *Queue) dispatchDue(ctx context.Context, slots chan struct{}, handler Handler) error {
+	pending, err := models.DeliveriesByStatus(ctx, q.DB, StatusPending)
+	if err != nil {
+		return fmt.Errorf("get pending deliveries: %w", err)
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Time().Before(pending[j].CreatedAt.Time())
+	})
+
+	now := time.Now()
+
+	for _, delivery := range pending {
+		if delivery.AttemptAt.Time().After(now) {
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			// at capacity; the rest will be picked up once a slot frees up
+			return nil
+		}
+
+		claimed, err := delivery.Claim(ctx, q.DB, q.Node)
+		if err != nil {
+			<-slots
+			return fmt.Errorf("claim delivery %s: %w", delivery.ID, err)
+		}
+
+		if !claimed {
+			// claimed by a peer
+			<-slots
+			continue
+		}
+
+		go func(delivery *models.Delivery) {
+			defer func() {
+				<-slots
+				q.notify()
+			}()
+
+			q.attempt(ctx, handler, delivery)
+		}(delivery)
+	}
+
+	return nil
+}
+
+func (q *Queue) attempt(ctx context.Context, handler Handler, delivery *models.Delivery) {
+	logger := q.logger.With(
+		zap.String("integration", delivery.Integration),
+		zap.String("event", delivery.Event),
+		zap.String("delivery", delivery.ID),
+		zap.Int("attempt", delivery.Attempts),
+	)
+
+	err := q.call(zapctx.ToContext(ctx, logger), handler, delivery)
+
+	var postpone postponeError
+	var abandon abandonError
+
+	delivery.Postponed = 0
+
+	switch {
+	case err == nil:
+		delivery.Status = StatusDone
+		delivery.Error = sql.NullString{}
+	case errors.As(err, &postpone):
+		logger.Info("postponing delivery", zap.Error(err))
+		delivery.Status = StatusPending
+		delivery.Attempts--
+		delivery.Postponed = 1
+		delivery.Error = sql.NullString{String: err.Error(), Valid: true}
+		delivery.AttemptAt = models.NewTime(time.Now().Add(postponeInterval).UTC())
+	case errors.As(err, &abandon):
+		logger.Error("abandoning delivery", zap.Error(err))
+		delivery.Status = StatusFailed
+		delivery.Error = sql.NullString{String: err.Error(), Valid: true}
+	case delivery.RunID.Valid:
+		logger.Warn("dispatch errored", zap.Error(err))
+		delivery.Status = StatusDone
+		delivery.Error = sql.NullString{String: err.Error(), Valid: true}
+	case delivery.Attempts >= q.MaxAttempts:
+		logger.Error("giving up on delivery", zap.Error(err))
+		delivery.Status = StatusFailed
+		delivery.Error = sql.NullString{String: err.Error(), Valid: true}
+	default:
+		backoff := baseBackoff << (delivery.Attempts - 1)
+		logger.Warn("dispatch errored; retrying", zap.Error(err), zap.Duration("backoff", backoff))
+		delivery.Status = StatusPending
+		delivery.Error = sql.NullString{String: err.Error(), Valid: true}
+		delivery.AttemptAt = models.NewTime(time.Now().Add(backoff).UTC())
+	}
+
+	if err := delivery.Update(context.Background(), q.DB); err != nil {
+		logger.Error("failed to update delivery", zap.Error(err))
+	}
+}
+
+func (q *Queue) call(ctx context.Context, handler Handler, delivery *models.Delivery) (err error) {
+	defer func() {
+		// prevent panics from taking down the whole loop
+		if p := recover(); p != nil {
+			err = fmt.Errorf("dispatch panic: %v", p)
+		}
+	}()
+
+	return handler(ctx, delivery)
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,266 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vito/bass-loop/pkg/cfg"
+	"github.com/vito/bass-loop/pkg/models"
+	"go.uber.org/zap"
+)
+
+func TestRunRecoversInterruptedDeliveries(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := models.Open(&cfg.Config{
+		SQLitePath: filepath.Join(t.TempDir(), "loop.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	q := &Queue{
+		DB:          db,
+		Concurrency: 1,
+		MaxAttempts: 3,
+		Node:        "node",
+
+		logger: zap.NewNop(),
+		wake:   make(chan struct{}, 1),
+	}
+
+	past := models.NewTime(time.Now().Add(-time.Minute).UTC())
+
+	for _, delivery := range []*models.Delivery{
+		{ID: "no-run", Attempts: 1},
+		{ID: "has-run", Attempts: 1, RunID: sql.NullString{String: "run", Valid: true}},
+		{ID: "out-of-attempts", Attempts: 3},
+		{ID: "peer", Attempts: 1, Node: "peer"},
+	} {
+		delivery.Integration = "github"
+		delivery.Event = "push"
+		delivery.Payload = []byte(`{}`)
+		delivery.Status = StatusRunning
+		delivery.CreatedAt = past
+		delivery.AttemptAt = past
+		if delivery.Node == "" {
+			delivery.Node = q.Node
+		}
+
+		if err := delivery.Insert(ctx, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dispatched := make(chan string, 4)
+	go q.Run(runCtx, func(ctx context.Context, delivery *models.Delivery) error {
+		dispatched <- delivery.ID
+		return nil
+	})
+
+	select {
+	case id := <-dispatched:
+		if id != "no-run" {
+			t.Errorf("expected no-run to be resumed, got %s", id)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the interrupted delivery to resume")
+	}
+
+	cancel()
+
+	for id, status := range map[string]string{
+		"has-run":         StatusDone,
+		"out-of-attempts": StatusFailed,
+		"peer":            StatusRunning,
+	} {
+		delivery, err := models.DeliveryByID(ctx, db, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if delivery.Status != status {
+			t.Errorf("%s: expected status %s, got %s", id, status, delivery.Status)
+		}
+	}
+
+	select {
+	case id := <-dispatched:
+		t.Errorf("unexpected dispatch of %s", id)
+	default:
+	}
+}
+
+func TestWakeAndRedeliver(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := models.Open(&cfg.Config{
+		SQLitePath: filepath.Join(t.TempDir(), "loop.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	q := &Queue{
+		DB:          db,
+		Concurrency: 1,
+		MaxAttempts: 3,
+		Node:        "node",
+
+		logger: zap.NewNop(),
+		wake:   make(chan struct{}, 1),
+	}
+
+	now := time.Now().UTC()
+	later := models.NewTime(now.Add(time.Hour))
+	checkRunID := sql.NullInt64{Int64: 42, Valid: true}
+
+	for _, delivery := range []*models.Delivery{
+		{ID: "postponed", Attempts: 0, Postponed: 1},
+		{ID: "postponed-after-failure", Attempts: 1, Postponed: 1, CheckRunID: checkRunID},
+		{ID: "backing-off", Attempts: 1},
+	} {
+		delivery.Integration = "github"
+		delivery.Event = "push"
+		delivery.Payload = []byte(`{}`)
+		delivery.Status = StatusPending
+		delivery.CreatedAt = models.NewTime(now)
+		delivery.AttemptAt = later
+
+		if err := delivery.Insert(ctx, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := q.Wake(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, woken := range map[string]bool{
+		"postponed":               true,
+		"postponed-after-failure": true,
+		"backing-off":             false,
+	} {
+		delivery, err := models.DeliveryByID(ctx, db, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if delivery.AttemptAt.Time().After(now.Add(time.Minute)) == woken {
+			t.Errorf("%s: expected woken to be %v, got attempt at %s", id, woken, delivery.AttemptAt.Time())
+		}
+	}
+
+	if err := q.Redeliver(ctx, "postponed-after-failure"); err != nil {
+		t.Fatal(err)
+	}
+
+	delivery, err := models.DeliveryByID(ctx, db, "postponed-after-failure")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivery.CheckRunID != checkRunID {
+		t.Errorf("expected the check run to be kept, got %v", delivery.CheckRunID)
+	}
+}
+
+func TestHoldAndFinish(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := models.Open(&cfg.Config{
+		SQLitePath: filepath.Join(t.TempDir(), "loop.db"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	q := &Queue{
+		DB:          db,
+		Concurrency: 1,
+		MaxAttempts: 3,
+		Node:        "node",
+
+		logger: zap.NewNop(),
+		wake:   make(chan struct{}, 1),
+	}
+
+	held := map[string]*models.Delivery{}
+	for _, id := range []string{"succeeded", "failed-after-run", "failed-before-run", "interrupted"} {
+		delivery := &models.Delivery{
+			ID:          id,
+			Integration: "github-check",
+			Event:       "check",
+			Payload:     []byte(`{}`),
+		}
+
+		if err := q.Hold(ctx, delivery); err != nil {
+			t.Fatal(err)
+		}
+
+		held[id] = delivery
+	}
+
+	held["failed-after-run"].RunID = sql.NullString{String: "run", Valid: true}
+
+	for id, err := range map[string]error{
+		"succeeded":         nil,
+		"failed-after-run":  errors.New("check failed"),
+		"failed-before-run": errors.New("no runtime available"),
+	} {
+		if err := q.Finish(held[id], err); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	dispatched := make(chan string, 4)
+	go q.Run(runCtx, func(ctx context.Context, delivery *models.Delivery) error {
+		dispatched <- delivery.ID
+		return nil
+	})
+
+	select {
+	case id := <-dispatched:
+		if id != "interrupted" {
+			t.Errorf("expected interrupted to be resumed, got %s", id)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the held delivery to resume")
+	}
+
+	cancel()
+
+	for id, status := range map[string]string{
+		"succeeded":         StatusDone,
+		"failed-after-run":  StatusDone,
+		"failed-before-run": StatusFailed,
+	} {
+		delivery, err := models.DeliveryByID(ctx, db, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if delivery.Status != status {
+			t.Errorf("%s: expected status %s, got %s", id, status, delivery.Status)
+		}
+	}
+
+	select {
+	case id := <-dispatched:
+		t.Errorf("unexpected dispatch of %s", id)
+	default:
+	}
+}
@@ -1,59 +1,284 @@
 package runnel
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/gliderlabs/ssh"
 	"github.com/google/go-github/v43/github"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass/pkg/zapctx"
 	"go.uber.org/zap"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 type userIdKey struct{}
 type loggerKey struct{}
 
-type GitHubAuthenticator struct {
+// Identity is the user a set of keys belongs to.
+type Identity struct {
+	// ID is the user's ID, e.g. their GitHub node ID.
+	ID string
+
+	// Login is the name the user authenticates as.
+	Login string
+}
+
+// KeyProvider looks up a user's identity and authorized public keys.
+type KeyProvider interface {
+	UserKeys(ctx context.Context, login string) (Identity, []ssh.PublicKey, error)
+}
+
+// ErrUnknownUser is returned by a KeyProvider when the user does not exist.
+var ErrUnknownUser = errors.New("unknown user")
+
+// ErrKeysUnavailable is returned by a KeyProvider when keys can't be looked up
+// for the time being, e.g. because GitHub can't be reached.
+var ErrKeysUnavailable = errors.New("keys unavailable")
+
+// Authenticator authenticates SSH sessions by public key.
+type Authenticator struct {
 	Logger *zap.Logger
+	DB     models.DB
+	Keys   KeyProvider
 
-	*github.Client
+	// Admit is called once a key matches, and rejects the user if it returns
+	// an error.
+	Admit func(ssh.Context, Identity) error
 }
 
-func (auth GitHubAuthenticator) Auth(ctx ssh.Context, key ssh.PublicKey) bool {
+func (auth Authenticator) Auth(ctx ssh.Context, key ssh.PublicKey) bool {
 	logger := auth.Logger.With(
 		zap.String("user", ctx.User()),
 		zap.String("session", ctx.SessionID()),
 	)
 
-	user, _, err := auth.Users.Get(ctx, ctx.User())
+	id, keys, err := auth.Keys.UserKeys(zapctx.ToContext(ctx, logger), ctx.User())
 	if err != nil {
-		logger.Error("failed to get user", zap.Error(err))
+		logger.Error("failed to get keys", zap.Error(err))
 		return false
 	}
 
-	ctx.SetValue(userIdKey{}, user.GetNodeID())
-	setLoggerInContext(ctx, logger)
+	for _, k := range keys {
+		if ssh.KeysEqual(k, key) {
+			logger.Info("keys equal", zap.String("type", key.Type()))
+
+			if auth.Admit != nil {
+				if err := auth.Admit(ctx, id); err != nil {
+					logger.Warn("rejecting user", zap.Error(err))
+					return false
+				}
+			}
+
+			user := models.User{
+				ID:    id.ID,
+				Login: id.Login,
+			}
+
+			if err := user.Upsert(ctx, auth.DB); err != nil {
+				logger.Error("failed to save user", zap.Error(err))
+				return false
+			}
+
+			ctx.SetValue(userIdKey{}, id.ID)
+			setLoggerInContext(ctx, logger)
+
+			return true
+		}
+	}
+
+	logger.Warn("rejecting auth", zap.String("remote", ctx.RemoteAddr().String()))
+
+	return false
+}
+
+// GitHubKeys provides the public keys users have added to their GitHub
+// accounts.
+type GitHubKeys struct {
+	*github.Client
+}
 
-	keys, _, err := auth.Users.ListKeys(ctx, ctx.User(), nil)
+func (provider GitHubKeys) UserKeys(ctx context.Context, login string) (Identity, []ssh.PublicKey, error) {
+	user, res, err := provider.Users.Get(ctx, login)
 	if err != nil {
-		logger.Error("failed to list keys", zap.Error(err))
-		return false
+		if res != nil && res.StatusCode == 404 {
+			return Identity{}, nil, fmt.Errorf("%w: %s", ErrUnknownUser, login)
+		}
+
+		return Identity{}, nil, fmt.Errorf("get user: %w", gitHubKeysErr(res, err))
 	}
 
-	for _, k := range keys {
-		logger := logger.With(zap.Int64("id", k.GetID()), zap.String("type", key.Type()))
+	ghKeys, res, err := provider.Users.ListKeys(ctx, login, nil)
+	if err != nil {
+		return Identity{}, nil, fmt.Errorf("list keys: %w", gitHubKeysErr(res, err))
+	}
 
+	var keys []ssh.PublicKey
+	for _, k := range ghKeys {
 		pkey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(k.GetKey()))
 		if err != nil {
-			logger.Error("failed to parse authorized key", zap.Error(err))
-			return false
+			return Identity{}, nil, fmt.Errorf("parse key %d: %w", k.GetID(), err)
 		}
 
-		if ssh.KeysEqual(pkey, key) {
-			logger.Info("keys equal")
-			return true
+		keys = append(keys, pkey)
+	}
+
+	return Identity{
+		ID:    user.GetNodeID(),
+		Login: user.GetLogin(),
+	}, keys, nil
+}
+
+// gitHubKeysErr marks an error from GitHub with ErrKeysUnavailable if it's
+// worth waiting out: GitHub couldn't be reached, errored, or rate limited us.
+func gitHubKeysErr(res *github.Response, err error) error {
+	var rateLimit *github.RateLimitError
+	var abuse *github.AbuseRateLimitError
+	if res == nil || res.StatusCode >= 500 || errors.As(err, &rateLimit) || errors.As(err, &abuse) {
+		return fmt.Errorf("%w: %w", ErrKeysUnavailable, err)
+	}
+
+	return err
+}
+
+// AuthorizedKeysFile provides keys from an authorized_keys file, where each
+// key's comment is the login of the user it belongs to.
+//
+// The file is read on every lookup so that it can be edited without a
+// restart.
+type AuthorizedKeysFile struct {
+	Path string
+}
+
+// AuthorizedKeysIDPrefix is prepended to logins to form the IDs of users
+// authenticated with an authorized_keys file.
+const AuthorizedKeysIDPrefix = "keys:"
+
+// isGitHubUser returns true if the user ID belongs to a GitHub user, as
+// opposed to a user from an authorized_keys file whose login may collide with
+// one.
+func isGitHubUser(userID string) bool {
+	return !strings.HasPrefix(userID, AuthorizedKeysIDPrefix)
+}
+
+func (provider AuthorizedKeysFile) UserKeys(ctx context.Context, login string) (Identity, []ssh.PublicKey, error) {
+	content, err := os.ReadFile(provider.Path)
+	if err != nil {
+		return Identity{}, nil, fmt.Errorf("read authorized keys: %w", err)
+	}
+
+	var keys []ssh.PublicKey
+	for rest := content; len(bytes.TrimSpace(rest)) > 0; {
+		var pkey ssh.PublicKey
+		var comment string
+		pkey, comment, _, rest, err = ssh.ParseAuthorizedKey(rest)
+		if err != nil {
+			return Identity{}, nil, fmt.Errorf("parse authorized keys: %w", err)
+		}
+
+		if comment == login {
+			keys = append(keys, pkey)
 		}
 	}
 
-	logger.Warn("rejecting auth", zap.String("remote", ctx.RemoteAddr().String()))
+	if len(keys) == 0 {
+		return Identity{}, nil, fmt.Errorf("%w: %s", ErrUnknownUser, login)
+	}
 
-	return false
+	return Identity{
+		ID:    AuthorizedKeysIDPrefix + login,
+		Login: login,
+	}, keys, nil
+}
+
+// DefaultKeyCacheTTL is how long keys are cached by default.
+const DefaultKeyCacheTTL = 10 * time.Minute
+
+// DefaultKeyMaxStale is how old cached keys may be by default and still be
+// used while the provider is unavailable.
+const DefaultKeyMaxStale = time.Hour
+
+// CachedKeys caches keys from another provider in the database.
+//
+// If the provider returns ErrKeysUnavailable, stale keys are used instead so
+// that users can still log in while it is unavailable, until they're older
+// than MaxStale. Any other error, e.g. the user no longer existing, is
+// returned as-is.
+type CachedKeys struct {
+	DB       models.DB
+	TTL      time.Duration
+	MaxStale time.Duration
+
+	KeyProvider
+}
+
+func (provider CachedKeys) UserKeys(ctx context.Context, login string) (Identity, []ssh.PublicKey, error) {
+	cached, err := models.CachedKeyByLogin(ctx, provider.DB, login)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Identity{}, nil, fmt.Errorf("get cached keys: %w", err)
+	}
+
+	if cached != nil && time.Since(cached.FetchedAt.Time()) < provider.TTL {
+		return cachedIdentity(cached)
+	}
+
+	id, keys, err := provider.KeyProvider.UserKeys(ctx, login)
+	if err != nil {
+		if cached != nil && errors.Is(err, ErrKeysUnavailable) && time.Since(cached.FetchedAt.Time()) < provider.MaxStale {
+			zapctx.FromContext(ctx).Warn("using stale keys", zap.Error(err))
+			return cachedIdentity(cached)
+		}
+
+		return Identity{}, nil, err
+	}
+
+	lines := []string{}
+	for _, key := range keys {
+		lines = append(lines, strings.TrimSpace(string(gossh.MarshalAuthorizedKey(key))))
+	}
+
+	fresh := &models.CachedKey{
+		Login:     login,
+		UserID:    id.ID,
+		Keys:      strings.Join(lines, "\n"),
+		FetchedAt: models.NewTime(time.Now().UTC()),
+	}
+
+	if err := fresh.Upsert(ctx, provider.DB); err != nil {
+		return Identity{}, nil, fmt.Errorf("cache keys: %w", err)
+	}
+
+	return id, keys, nil
+}
+
+func cachedIdentity(cached *models.CachedKey) (Identity, []ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+
+	scanner := bufio.NewScanner(strings.NewReader(cached.Keys))
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+
+		pkey, _, _, _, err := ssh.ParseAuthorizedKey(scanner.Bytes())
+		if err != nil {
+			return Identity{}, nil, fmt.Errorf("parse cached key: %w", err)
+		}
+
+		keys = append(keys, pkey)
+	}
+
+	return Identity{
+		ID:    cached.UserID,
+		Login: cached.Login,
+	}, keys, nil
 }
 
 func setLoggerInContext(ctx ssh.Context, logger *zap.Logger) {
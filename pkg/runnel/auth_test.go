@@ -0,0 +1,28 @@
+package runnel
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v43/github"
+	"github.com/vito/is"
+)
+
+func TestGitHubKeysErr(t *testing.T) {
+	is := is.New(t)
+
+	response := func(status int) *github.Response {
+		return &github.Response{Response: &http.Response{StatusCode: status}}
+	}
+
+	err := errors.New("boom")
+
+	is.True(errors.Is(gitHubKeysErr(nil, err), ErrKeysUnavailable))           // unreachable
+	is.True(errors.Is(gitHubKeysErr(response(502), err), ErrKeysUnavailable)) // server error
+	is.True(errors.Is(gitHubKeysErr(response(403), &github.RateLimitError{}), ErrKeysUnavailable))
+	is.True(errors.Is(gitHubKeysErr(response(403), &github.AbuseRateLimitError{}), ErrKeysUnavailable))
+
+	is.True(!errors.Is(gitHubKeysErr(response(403), err), ErrKeysUnavailable)) // forbidden
+	is.True(!errors.Is(gitHubKeysErr(response(422), err), ErrKeysUnavailable)) // invalid
+}
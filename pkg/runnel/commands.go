@@ -0,0 +1,431 @@
+package runnel
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	flag "github.com/spf13/pflag"
+	"github.com/vito/bass-loop/pkg/blobs"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass/pkg/bass"
+	"go.uber.org/zap"
+)
+
+const (
+	StatusCommandName = "status"
+	RunsCommandName   = "runs"
+	LogsCommandName   = "logs"
+)
+
+// DefaultRunsLimit is the number of runs listed by the runs command by
+// default.
+const DefaultRunsLimit = 20
+
+func (server *Server) commands() []Command {
+	return []Command{
+		{
+			Command:     ForwardCommandName,
+			Usage:       "forward [--os OS] [--arch ARCH] [--priority N] [--label KEY=VAL] [--scope SCOPE]",
+			Description: "register a runtime forwarded over this session",
+			Callback:    server.HandleForwardCommand,
+		},
+		{
+			Command:     ConfigureCommandName,
+			Usage:       "configure [--priority N] [--label KEY=VAL] [--scope SCOPE] [--reset]",
+			Description: "configure flags for every runtime you forward, e.g. with bass --runner",
+			Callback:    server.HandleConfigureCommand,
+		},
+		{
+			Command:     RunCommandName,
+			Usage:       "run < thunk.json",
+			Description: "run a thunk on your runtimes and record it",
+			Callback:    server.HandleRunCommand,
+		},
+		{
+			Command:     StatusCommandName,
+			Usage:       "status",
+			Description: "show your registered runtimes and services",
+			Callback:    server.HandleStatusCommand,
+		},
+		{
+			Command:     RunsCommandName,
+			Usage:       "runs [--repo OWNER/NAME] [--limit N]",
+			Description: "list your recent runs and their outcomes",
+			Callback:    server.HandleRunsCommand,
+		},
+		{
+			Command:     LogsCommandName,
+			Usage:       "logs RUN [VERTEX]",
+			Description: "print the logs of a run you can view, or of one of its vertices",
+			Callback:    server.HandleLogsCommand,
+		},
+		{
+			Command:     HelpCommandName,
+			Usage:       "help",
+			Description: "show this help",
+			Callback:    server.HandleHelpCommand,
+		},
+	}
+}
+
+func (server *Server) HandleHelpCommand(s ssh.Session, flags *flag.FlagSet, args []string) {
+	fmt.Fprintln(s, "commands:")
+
+	w := tabwriter.NewWriter(s, 0, 4, 2, ' ', 0)
+	for _, cmd := range server.commands() {
+		fmt.Fprintf(w, "  %s\t%s\n", cmd.Usage, cmd.Description)
+	}
+	w.Flush()
+
+	s.Exit(0)
+}
+
+func (server *Server) HandleStatusCommand(s ssh.Session, flags *flag.FlagSet, args []string) {
+	logger := bass.LoggerTo(s, zap.DebugLevel).With(zap.String("side", "server"))
+
+	if err := flags.Parse(args); err != nil {
+		logger.Error("failed to parse flags", zap.Error(err))
+		s.Exit(2)
+		return
+	}
+
+	userID, ok := sessionUserID(s)
+	if !ok {
+		logger.Error("user id not found in context")
+		s.Exit(1)
+		return
+	}
+
+	ctx := s.Context()
+
+	rts, err := models.RuntimesByUserID(ctx, server.DB, userID)
+	if err != nil {
+		logger.Error("failed to get runtimes", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	if len(rts) == 0 {
+		fmt.Fprintln(s, "no runtimes registered")
+		s.Exit(0)
+		return
+	}
+
+	w := tabwriter.NewWriter(s, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RUNTIME\tPLATFORM\tPRIORITY\tHEALTH\tNODE\tSERVICES\tCONNECTED")
+	for _, rt := range rts {
+		svcs, err := models.ServicesByUserIDRuntimeName(ctx, server.DB, rt.UserID, rt.Name)
+		if err != nil {
+			logger.Error("failed to get services", zap.Error(err))
+			s.Exit(1)
+			return
+		}
+
+		services := []string{}
+		for _, svc := range svcs {
+			services = append(services, svc.Service)
+		}
+
+		health := "healthy"
+		if rt.Healthy == 0 {
+			health = "unhealthy"
+		}
+
+		connected := "-"
+		if rt.ConnectedAt != nil {
+			connected = since(rt.ConnectedAt.Time())
+		}
+
+		fmt.Fprintf(w, "%s\t%s/%s\t%d\t%s\t%s\t%s\t%s\n",
+			rt.Name,
+			rt.Os, rt.Arch,
+			rt.Priority,
+			health,
+			rt.Node,
+			strings.Join(services, ","),
+			connected)
+	}
+	w.Flush()
+
+	s.Exit(0)
+}
+
+func (server *Server) HandleRunsCommand(s ssh.Session, flags *flag.FlagSet, args []string) {
+	logger := bass.LoggerTo(s, zap.DebugLevel).With(zap.String("side", "server"))
+
+	var repo string
+	flags.StringVar(&repo, "repo", "", "only list runs for the repo, e.g. acme/widgets")
+
+	var limit int
+	flags.IntVarP(&limit, "limit", "n", DefaultRunsLimit, "number of runs to list")
+
+	if err := flags.Parse(args); err != nil {
+		logger.Error("failed to parse flags", zap.Error(err))
+		s.Exit(2)
+		return
+	}
+
+	userID, ok := sessionUserID(s)
+	if !ok {
+		logger.Error("user id not found in context")
+		s.Exit(1)
+		return
+	}
+
+	ctx := s.Context()
+
+	recent, err := models.RecentUserRuns(ctx, server.DB, userID, repo, limit)
+	if err != nil {
+		logger.Error("failed to get runs", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	w := tabwriter.NewWriter(s, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tSTATUS\tREPO\tNAME\tSTARTED\tDURATION")
+
+	for _, run := range recent {
+		meta, err := runMeta(run)
+		if err != nil {
+			logger.Error("failed to get run meta", zap.Error(err))
+			s.Exit(1)
+			return
+		}
+
+		runRepo, _ := run.Repo()
+
+		name := meta.Check.Name
+		if name == "" {
+			name = meta.Event.Name
+		}
+
+		duration := "-"
+		if run.EndTime != nil {
+			duration = run.EndTime.Time().Sub(run.StartTime.Time()).Truncate(time.Second).String()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			run.ID,
+			runStatus(run),
+			orDash(runRepo.FullName),
+			orDash(name),
+			since(run.StartTime.Time()),
+			duration)
+	}
+	w.Flush()
+
+	s.Exit(0)
+}
+
+func (server *Server) HandleLogsCommand(s ssh.Session, flags *flag.FlagSet, args []string) {
+	logger := bass.LoggerTo(s, zap.DebugLevel).With(zap.String("side", "server"))
+
+	if err := flags.Parse(args); err != nil {
+		logger.Error("failed to parse flags", zap.Error(err))
+		s.Exit(2)
+		return
+	}
+
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Fprintln(s, "usage: logs RUN [VERTEX]")
+		s.Exit(2)
+		return
+	}
+
+	userID, ok := sessionUserID(s)
+	if !ok {
+		logger.Error("user id not found in context")
+		s.Exit(1)
+		return
+	}
+
+	ctx := s.Context()
+
+	runID := flags.Arg(0)
+
+	run, err := models.RunByID(ctx, server.DB, runID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger.Error("failed to get run", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	if run != nil {
+		ok, err = server.canView(ctx, userID, run)
+		if err != nil {
+			logger.Error("failed to check access", zap.Error(err))
+			s.Exit(1)
+			return
+		}
+	}
+
+	if run == nil || !ok {
+		// don't reveal whether runs the user can't view exist
+		fmt.Fprintf(s, "run not found: %s\n", runID)
+		s.Exit(1)
+		return
+	}
+
+	vtxs, err := models.VertexesByRunID(ctx, server.DB, runID)
+	if err != nil {
+		logger.Error("failed to get vertices", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	if flags.NArg() == 2 {
+		vtx := findVertex(vtxs, flags.Arg(1))
+		if vtx == nil {
+			fmt.Fprintf(s, "vertex not found: %s\n", flags.Arg(1))
+			s.Exit(1)
+			return
+		}
+
+		if err := server.copyLogs(ctx, s, vtx); err != nil {
+			logger.Error("failed to read logs", zap.Error(err))
+			s.Exit(1)
+			return
+		}
+
+		s.Exit(0)
+		return
+	}
+
+	for _, vtx := range vtxs {
+		fmt.Fprintf(s, "\x1b[1m%s\x1b[0m \x1b[2m%s\x1b[0m\n", vtx.Name, vtx.Digest)
+
+		if err := server.copyLogs(ctx, s, vtx); err != nil {
+			logger.Error("failed to read logs", zap.Error(err))
+			s.Exit(1)
+			return
+		}
+	}
+
+	s.Exit(0)
+}
+
+// canView returns true if the user may read the run's logs.
+//
+// Users authenticated with an authorized_keys file aren't GitHub users, so
+// they may only read public runs and their own.
+func (server *Server) canView(ctx context.Context, userID string, run *models.Run) (bool, error) {
+	if run.UserID == userID {
+		return true, nil
+	}
+
+	var viewer *models.User
+	if isGitHubUser(userID) {
+		var err error
+		viewer, err = models.UserByID(ctx, server.DB, userID)
+		if err != nil {
+			return false, fmt.Errorf("get user: %w", err)
+		}
+	}
+
+	return server.Access.CanView(ctx, viewer, run)
+}
+
+// copyLogs writes the vertex's raw logs, including ANSI colors.
+func (server *Server) copyLogs(ctx context.Context, w io.Writer, vtx *models.Vertex) error {
+	key := blobs.VertexRawLogKey(vtx)
+
+	exists, err := server.Blobs.Exists(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		// vertices without output have no logs
+		return nil
+	}
+
+	r, err := server.Blobs.NewReader(ctx, key, nil)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// findVertex finds a vertex by digest, digest prefix, or name.
+func findVertex(vtxs []*models.Vertex, ref string) *models.Vertex {
+	for _, vtx := range vtxs {
+		if vtx.Digest == ref || vtx.Name == ref {
+			return vtx
+		}
+	}
+
+	for _, vtx := range vtxs {
+		if strings.HasPrefix(vtx.Digest, ref) ||
+			strings.HasPrefix(strings.TrimPrefix(vtx.Digest, "sha256:"), ref) {
+			return vtx
+		}
+	}
+
+	return nil
+}
+
+// runMetadata is the subset of run metadata shown by the runs command.
+type runMetadata struct {
+	Check struct {
+		Name string `json:"name"`
+	} `json:"check"`
+
+	Event struct {
+		Name string `json:"name"`
+	} `json:"event"`
+}
+
+func runMeta(run *models.Run) (runMetadata, error) {
+	var meta runMetadata
+	if !run.Meta.Valid {
+		return meta, nil
+	}
+
+	if err := json.Unmarshal([]byte(run.Meta.String), &meta); err != nil {
+		return meta, fmt.Errorf("unmarshal meta: %w", err)
+	}
+
+	return meta, nil
+}
+
+func runStatus(run *models.Run) string {
+	switch {
+	case run.EndTime == nil:
+		return "running"
+	case run.Cancelled == 1:
+		return "cancelled"
+	case run.Succeeded.Int64 == 1:
+		return "succeeded"
+	default:
+		return "failed"
+	}
+}
+
+func since(t time.Time) string {
+	return time.Since(t).Truncate(time.Second).String() + " ago"
+}
+
+func orDash(str string) string {
+	if str == "" {
+		return "-"
+	}
+
+	return str
+}
+
+func sessionUserID(s ssh.Session) (string, bool) {
+	userID, ok := s.Context().Value(userIdKey{}).(string)
+	return userID, ok
+}
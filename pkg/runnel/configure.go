@@ -0,0 +1,160 @@
+package runnel
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	flag "github.com/spf13/pflag"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/pool"
+	"github.com/vito/bass/pkg/bass"
+	"go.uber.org/zap"
+)
+
+const ConfigureCommandName = "configure"
+
+// runnerFlags are the forward command's flags which may also be configured
+// ahead of time with the configure command.
+//
+// Runners like `bass --runner` only pass --os and --arch to the forward
+// command, so configuring the rest is the only way to set them.
+type runnerFlags struct {
+	priority int
+	labels   map[string]string
+	scope    string
+}
+
+func (rf *runnerFlags) register(flags *flag.FlagSet) {
+	flags.IntVarP(&rf.priority, "priority", "p", 0, "priority")
+	flags.StringToStringVarP(&rf.labels, "label", "l", nil, "runtime label for selecting the runtime, e.g. gpu=true (repeatable)")
+	flags.StringVar(&rf.scope, "scope", "", "share the runtime with an org or repo, e.g. org:acme or repo:acme/widgets")
+}
+
+// configuredArgs returns the forward command arguments configured by the
+// user, if any.
+func (server *Server) configuredArgs(s ssh.Session, userID string) ([]string, error) {
+	settings, err := models.RunnerSettingByUserID(s.Context(), server.DB, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("get runner settings: %w", err)
+	}
+
+	var args []string
+	if err := json.Unmarshal([]byte(settings.Args), &args); err != nil {
+		return nil, fmt.Errorf("unmarshal runner settings: %w", err)
+	}
+
+	return args, nil
+}
+
+// HandleConfigureCommand configures flags to apply to every runtime the user
+// forwards from then on, e.g. to share runtimes forwarded by `bass --runner`.
+//
+// Flags passed to the forward command itself take precedence. Without any
+// flags the current configuration is printed, and --reset clears it.
+func (server *Server) HandleConfigureCommand(s ssh.Session, flags *flag.FlagSet, args []string) {
+	logger := bass.LoggerTo(s, zap.DebugLevel).With(zap.String("side", "server"))
+
+	var rf runnerFlags
+	rf.register(flags)
+
+	var reset bool
+	flags.BoolVar(&reset, "reset", false, "clear the configured flags")
+
+	if err := flags.Parse(args); err != nil {
+		logger.Error("failed to parse flags", zap.Error(err))
+		s.Exit(2)
+		return
+	}
+
+	if flags.NArg() > 0 {
+		logger.Error("unexpected arguments", zap.Strings("args", flags.Args()))
+		s.Exit(2)
+		return
+	}
+
+	userID, ok := sessionUserID(s)
+	if !ok {
+		logger.Error("user id not found in context")
+		s.Exit(1)
+		return
+	}
+
+	ctx := s.Context()
+
+	if reset {
+		if _, err := server.DB.ExecContext(ctx, `DELETE FROM runner_settings WHERE user_id = $1`, userID); err != nil {
+			logger.Error("failed to reset runner settings", zap.Error(err))
+			s.Exit(1)
+			return
+		}
+
+		fmt.Fprintln(s, "runner settings cleared")
+		s.Exit(0)
+		return
+	}
+
+	if len(args) == 0 {
+		configured, err := server.configuredArgs(s, userID)
+		if err != nil {
+			logger.Error("failed to get runner settings", zap.Error(err))
+			s.Exit(1)
+			return
+		}
+
+		if len(configured) == 0 {
+			fmt.Fprintln(s, "no runner settings configured")
+		} else {
+			fmt.Fprintln(s, strings.Join(configured, " "))
+		}
+
+		s.Exit(0)
+		return
+	}
+
+	if rf.scope != "" {
+		if _, _, err := pool.ParseScope(rf.scope); err != nil {
+			logger.Error("invalid scope", zap.Error(err))
+			s.Exit(2)
+			return
+		}
+
+		// checked again whenever a runtime is forwarded, in case the user
+		// leaves the org or repo
+		if err := server.VerifyScope(ctx, Identity{ID: userID, Login: s.User()}, rf.scope); err != nil {
+			logger.Error("cannot share runtimes", zap.String("scope", rf.scope), zap.Error(err))
+			s.Exit(1)
+			return
+		}
+	}
+
+	payload, err := json.Marshal(args)
+	if err != nil {
+		logger.Error("failed to marshal runner settings", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	settings := &models.RunnerSetting{
+		UserID:    userID,
+		Args:      string(payload),
+		UpdatedAt: models.NewTime(time.Now().UTC()),
+	}
+
+	if err := settings.Upsert(ctx, server.DB); err != nil {
+		logger.Error("failed to save runner settings", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	fmt.Fprintln(s, "runtimes you forward will use:", strings.Join(args, " "))
+	s.Exit(0)
+}
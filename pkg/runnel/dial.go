@@ -0,0 +1,46 @@
+package runnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/vito/bass-loop/pkg/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Dial connects to a forwarded service.
+//
+// Services are forwarded either over a unix socket (unix://) or a TCP port
+// (tcp://). Connections to TCP ports authenticate with the token shared
+// between nodes, if any.
+func Dial(svc *models.Service, peerToken string) (*grpc.ClientConn, error) {
+	addr, err := url.Parse(svc.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("parse service addr: %w", err)
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+
+	var target string
+	switch addr.Scheme {
+	case "unix":
+		target = svc.Addr
+	case "tcp":
+		target = addr.Host
+
+		if peerToken != "" {
+			opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+				return dialPeer(ctx, addr, peerToken)
+			}))
+		}
+	default:
+		return nil, fmt.Errorf("unknown service addr scheme: %s", svc.Addr)
+	}
+
+	return grpc.Dial(target, opts...)
+}
@@ -8,12 +8,14 @@ import (
 	"net/url"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/adrg/xdg"
 	"github.com/gliderlabs/ssh"
 	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass/pkg/runtimes"
 	"github.com/vito/bass/pkg/zapctx"
 	"go.uber.org/zap"
 	gossh "golang.org/x/crypto/ssh"
@@ -28,21 +30,44 @@ const (
 	StreamlocalForwardChannelType       = "streamlocal-forward@openssh.com"
 	CancelStreamlocalForwardChannelType = "cancel-streamlocal-forward@openssh.com"
 
+	ForwardedTCPChannelType     = "forwarded-tcpip"
+	TCPForwardRequestType       = "tcpip-forward"
+	CancelTCPForwardRequestType = "cancel-tcpip-forward"
+
 	KeepaliveRequestType = "keepalive"
 )
 
 type ForwardHandler struct {
 	DB models.DB
 
+	// node owning the forwarded services
+	Node string
+
+	// when set, services listen on this host so that peers can reach them
+	PeerAddr string
+
+	// when set, connections to services listening on TCP ports must
+	// authenticate with this token; see acceptPeer
+	PeerToken string
+
+	// how many services each session may forward; unlimited when zero
+	MaxServices int
+
+	// services which may be forwarded; any may be when empty
+	AllowedServices []string
+
 	processCtx context.Context
 
 	forwards map[string]net.Listener
 	sync.Mutex
 }
 
-func NewForwardHandler(ctx context.Context, db models.DB) *ForwardHandler {
+func NewForwardHandler(ctx context.Context, db models.DB, node, peerAddr, peerToken string) *ForwardHandler {
 	return &ForwardHandler{
-		DB: db,
+		DB:        db,
+		Node:      node,
+		PeerAddr:  peerAddr,
+		PeerToken: peerToken,
 
 		processCtx: ctx,
 		forwards:   make(map[string]net.Listener),
@@ -72,61 +97,230 @@ func (h *ForwardHandler) HandleStreamlocalForward(ctx ssh.Context, srv *ssh.Serv
 
 	svcName := filepath.Base(logicalSocketPath)
 
-	realSocketPath, err := xdg.StateFile(path.Join(
-		"bass-loop",
-		"svc",
-		ctx.User(),
-		sessionID[:16], // avoid exceeding unix socket path max length (~108)
-		svcName+".sock",
-	))
-	if err != nil {
-		logger.Error("failed to create socket", zap.Error(err))
+	if err := h.allowForward(sessionID, svcName); err != nil {
+		logger.Warn("rejecting forward", zap.Error(err))
 		return false, []byte(err.Error())
 	}
 
 	userIDVal := ctx.Value(userIdKey{})
 	if userIDVal == nil {
-		logger.Error("no user ID in context", zap.Error(err))
+		logger.Error("no user ID in context")
 		return false, []byte("user id not found in context - this should never happen")
 	}
 
 	userID := userIDVal.(string)
 
+	var ln net.Listener
+	var addr *url.URL
+	if h.PeerAddr != "" {
+		var err error
+		ln, addr, err = h.listenPeer()
+		if err != nil {
+			logger.Error("failed to listen", zap.Error(err))
+			return false, []byte(err.Error())
+		}
+	} else {
+		realSocketPath, err := xdg.StateFile(path.Join(
+			"bass-loop",
+			"svc",
+			ctx.User(),
+			sessionID[:16], // avoid exceeding unix socket path max length (~108)
+			svcName+".sock",
+		))
+		if err != nil {
+			logger.Error("failed to create socket", zap.Error(err))
+			return false, []byte(err.Error())
+		}
+
+		ln, err = net.Listen("unix", realSocketPath)
+		if err != nil {
+			logger.Error("failed to listen", zap.Error(err))
+			return false, []byte(err.Error())
+		}
+
+		addr = &url.URL{Scheme: "unix", Path: realSocketPath}
+	}
+
 	svc := models.Service{
 		UserID:      userID,
 		RuntimeName: sessionID,
 		Service:     svcName,
-		Addr:        (&url.URL{Scheme: "unix", Path: realSocketPath}).String(),
+		Addr:        addr.String(),
+		Node:        h.Node,
 	}
 
 	if err := svc.Upsert(ctx, h.DB); err != nil {
 		logger.Error("failed to upsert service", zap.Error(err))
+		ln.Close()
+		return false, []byte(err.Error())
+	}
+
+	logger = logger.With(zap.String("service", svc.Service), zap.String("addr", svc.Addr))
+
+	h.serve(ctx, logger, &svc, ln, logicalSocketPath, ForwardedStreamlocalChannelType, func(net.Conn) []byte {
+		return gossh.Marshal(&forwardedStreamlocalPayload{
+			SocketPath: logicalSocketPath,
+		})
+	})
+
+	return true, nil
+}
+
+func (h *ForwardHandler) HandleCancelStreamlocalForward(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
+	logger := zapctx.FromContext(h.processCtx).With(zap.String("request", req.Type))
+
+	logger.Info("handling cancel-streamlocal-forward")
+
+	var reqPayload streamlocalChannelForwardMsg
+	if err := gossh.Unmarshal(req.Payload, &reqPayload); err != nil {
+		logger.Error("malformed request", zap.Error(err))
+		return false, []byte(err.Error())
+	}
+
+	h.closeListener(ctx.SessionID(), reqPayload.SocketPath)
+
+	return true, nil
+}
+
+// HandleTCPForward handles a tcpip-forward request, i.e. ssh -R, by
+// listening on a local TCP port and registering it as a service.
+//
+// The service is named by the requested bind address, e.g. `ssh -R
+// runtime:0:localhost:6446`. If the bind address is a wildcard or loopback
+// address it is assumed to be the runtime service.
+func (h *ForwardHandler) HandleTCPForward(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
+	logger := zapctx.FromContext(h.processCtx).With(zap.String("request", req.Type))
+
+	var reqPayload tcpipForwardMsg
+	if err := gossh.Unmarshal(req.Payload, &reqPayload); err != nil {
+		logger.Error("malformed request", zap.Error(err))
+		return false, []byte(err.Error())
+	}
+
+	sessionID := ctx.SessionID()
+
+	logger.Info("handling tcpip-forward",
+		zap.String("bind", reqPayload.BindAddr),
+		zap.Uint32("port", reqPayload.BindPort))
+
+	svcName := reqPayload.BindAddr
+	switch svcName {
+	case "", "*", "localhost", "0.0.0.0", "127.0.0.1", "::", "::1":
+		svcName = runtimes.RuntimeServiceName
+	}
+
+	if err := h.allowForward(sessionID, svcName); err != nil {
+		logger.Warn("rejecting forward", zap.Error(err))
+		return false, []byte(err.Error())
+	}
+
+	userIDVal := ctx.Value(userIdKey{})
+	if userIDVal == nil {
+		logger.Error("no user ID in context")
 		return false, []byte("user id not found in context - this should never happen")
 	}
 
-	logger = logger.With(zap.String("service", svc.Service))
+	userID := userIDVal.(string)
 
-	ln, err := net.Listen("unix", realSocketPath)
+	// always listen on a random port; the requested port is only meaningful to
+	// the client
+	ln, addr, err := h.listenPeer()
 	if err != nil {
 		logger.Error("failed to listen", zap.Error(err))
 		return false, []byte(err.Error())
 	}
 
-	h.trackListener(sessionID, logicalSocketPath, ln)
+	svc := models.Service{
+		UserID:      userID,
+		RuntimeName: sessionID,
+		Service:     svcName,
+		Addr:        addr.String(),
+		Node:        h.Node,
+	}
 
-	eg := new(errgroup.Group)
-	eg.Go(func() error {
-		defer h.closeListener(sessionID, logicalSocketPath)
-		<-ctx.Done()
-		return ctx.Err()
-	})
-	eg.Go(func() error {
-		defer h.closeListener(sessionID, logicalSocketPath)
-		return h.listen(ctx, ln, logicalSocketPath)
+	if err := svc.Upsert(ctx, h.DB); err != nil {
+		logger.Error("failed to upsert service", zap.Error(err))
+		ln.Close()
+		return false, []byte(err.Error())
+	}
+
+	logger = logger.With(zap.String("service", svc.Service), zap.String("addr", svc.Addr))
+
+	// the client identifies forwarded connections (and cancels them) by the
+	// address and port it asked for, or the port we allocated if it asked for 0
+	bindPort := reqPayload.BindPort
+	var reply []byte
+	if bindPort == 0 {
+		bindPort = uint32(ln.Addr().(*net.TCPAddr).Port)
+		reply = gossh.Marshal(&tcpipForwardReply{Port: bindPort})
+	}
+
+	forwardID := net.JoinHostPort(reqPayload.BindAddr, strconv.Itoa(int(bindPort)))
+
+	h.serve(ctx, logger, &svc, ln, forwardID, ForwardedTCPChannelType, func(c net.Conn) []byte {
+		origin := c.RemoteAddr().(*net.TCPAddr)
+		return gossh.Marshal(&forwardedTCPPayload{
+			Addr:       reqPayload.BindAddr,
+			Port:       bindPort,
+			OriginAddr: origin.IP.String(),
+			OriginPort: uint32(origin.Port),
+		})
 	})
 
+	return true, reply
+}
+
+func (h *ForwardHandler) HandleCancelTCPForward(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
+	logger := zapctx.FromContext(h.processCtx).With(zap.String("request", req.Type))
+
+	logger.Info("handling cancel-tcpip-forward")
+
+	var reqPayload tcpipForwardMsg
+	if err := gossh.Unmarshal(req.Payload, &reqPayload); err != nil {
+		logger.Error("malformed request", zap.Error(err))
+		return false, []byte(err.Error())
+	}
+
+	forwardID := net.JoinHostPort(reqPayload.BindAddr, strconv.Itoa(int(reqPayload.BindPort)))
+
+	h.closeListener(ctx.SessionID(), forwardID)
+
+	return true, nil
+}
+
+// listenPeer listens on a random TCP port on the peer address, or on
+// localhost if no peer address is configured.
+func (h *ForwardHandler) listenPeer() (net.Listener, *url.URL, error) {
+	host := h.PeerAddr
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ln, &url.URL{Scheme: "tcp", Host: ln.Addr().String()}, nil
+}
+
+// serve forwards connections from the listener over new channels until the
+// session ends or the forward is cancelled, and then deletes the service.
+func (h *ForwardHandler) serve(ctx ssh.Context, logger *zap.Logger, svc *models.Service, ln net.Listener, forwardID, channelType string, payload func(net.Conn) []byte) {
+	sessionID := ctx.SessionID()
+
+	h.trackListener(sessionID, forwardID, ln)
+
 	go func() {
-		if err := eg.Wait(); err != nil &&
+		<-ctx.Done()
+		h.closeListener(sessionID, forwardID)
+	}()
+
+	go func() {
+		err := h.listen(ctx, ln, channelType, payload)
+		h.closeListener(sessionID, forwardID)
+
+		if err != nil &&
 			!errors.Is(err, context.Canceled) &&
 			!strings.HasSuffix(err.Error(), "use of closed network connection") {
 			logger.Error("error forwarding", zap.Error(err))
@@ -140,27 +334,9 @@ func (h *ForwardHandler) HandleStreamlocalForward(ctx ssh.Context, srv *ssh.Serv
 			logger.Debug("deleted service")
 		}
 	}()
-
-	return true, nil
 }
 
-func (h *ForwardHandler) HandleCancelStreamlocalForward(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
-	logger := zapctx.FromContext(h.processCtx).With(zap.String("request", req.Type))
-
-	logger.Info("handling cancel-streamlocal-forward")
-
-	var reqPayload streamlocalChannelForwardMsg
-	if err := gossh.Unmarshal(req.Payload, &reqPayload); err != nil {
-		logger.Error("malformed request", zap.Error(err))
-		return false, []byte(err.Error())
-	}
-
-	h.closeListener(ctx.SessionID(), reqPayload.SocketPath)
-
-	return true, nil
-}
-
-func (h *ForwardHandler) listen(ctx ssh.Context, ln net.Listener, logicalSocketPath string) error {
+func (h *ForwardHandler) listen(ctx ssh.Context, ln net.Listener, channelType string, payload func(net.Conn) []byte) error {
 	conn := ctx.Value(ssh.ContextKeyConn).(*gossh.ServerConn)
 
 	for {
@@ -172,11 +348,15 @@ func (h *ForwardHandler) listen(ctx ssh.Context, ln net.Listener, logicalSocketP
 		logger := zapctx.FromContext(h.processCtx).With(zap.String("conn", c.RemoteAddr().String()))
 
 		go func() {
-			payload := gossh.Marshal(&forwardedStreamlocalPayload{
-				SocketPath: logicalSocketPath,
-			})
+			if _, isTCP := c.(*net.TCPConn); isTCP && h.PeerToken != "" {
+				if err := acceptPeer(c, h.PeerToken); err != nil {
+					logger.Warn("rejecting unauthenticated connection", zap.Error(err))
+					c.Close()
+					return
+				}
+			}
 
-			ch, reqs, err := conn.OpenChannel(ForwardedStreamlocalChannelType, payload)
+			ch, reqs, err := conn.OpenChannel(channelType, payload(c))
 			if err != nil {
 				logger.Error("failed to open channel", zap.Error(err))
 				c.Close()
@@ -212,16 +392,16 @@ func (h *ForwardHandler) listen(ctx ssh.Context, ln net.Listener, logicalSocketP
 	}
 }
 
-func (h *ForwardHandler) trackListener(sessionID, socketPath string, ln net.Listener) {
-	id := sessionID + ":" + socketPath
+func (h *ForwardHandler) trackListener(sessionID, forwardID string, ln net.Listener) {
+	id := sessionID + ":" + forwardID
 
 	h.Lock()
 	h.forwards[id] = ln
 	h.Unlock()
 }
 
-func (h *ForwardHandler) closeListener(sessionID, socketPath string) {
-	id := sessionID + ":" + socketPath
+func (h *ForwardHandler) closeListener(sessionID, forwardID string) {
+	id := sessionID + ":" + forwardID
 
 	h.Lock()
 	defer h.Unlock()
@@ -242,3 +422,23 @@ type forwardedStreamlocalPayload struct {
 	SocketPath string
 	Reserved0  string
 }
+
+// tcpipForwardMsg is the payload of a "tcpip-forward" or
+// "cancel-tcpip-forward" global request.
+type tcpipForwardMsg struct {
+	BindAddr string
+	BindPort uint32
+}
+
+// tcpipForwardReply is the reply to a "tcpip-forward" request for port 0.
+type tcpipForwardReply struct {
+	Port uint32
+}
+
+// forwardedTCPPayload is the payload of a "forwarded-tcpip" channel.
+type forwardedTCPPayload struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
@@ -0,0 +1,237 @@
+package runnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/pool"
+	"github.com/vito/bass/pkg/runtimes"
+)
+
+var (
+	// ErrUserNotAllowed is returned when a user is not on the allowlist.
+	ErrUserNotAllowed = errors.New("user not allowed")
+
+	// ErrTooManySessions is returned when a user has too many connections open
+	// or too many runtimes forwarded.
+	ErrTooManySessions = errors.New("too many sessions")
+
+	// ErrTooManyServices is returned when a session forwards too many services.
+	ErrTooManyServices = errors.New("too many services")
+
+	// ErrServiceNotAllowed is returned when forwarding a service that is not
+	// on the allowlist.
+	ErrServiceNotAllowed = errors.New("service not allowed")
+)
+
+// Admit checks whether a newly authenticated user may connect.
+func (server *Server) Admit(ctx ssh.Context, id Identity) error {
+	if err := server.AllowUser(ctx, id); err != nil {
+		return err
+	}
+
+	return server.admitSession(ctx, id.ID, ctx.SessionID())
+}
+
+// admitSession checks that the user may open another SSH connection, counting
+// it until the context is done.
+//
+// Connections are counted on each node, so that users can't hold any number
+// of them open just to forward services. Authenticating again on the same
+// connection doesn't count twice.
+func (server *Server) admitSession(ctx context.Context, userID, sessionID string) error {
+	if server.MaxSessions <= 0 {
+		return nil
+	}
+
+	server.sessionsL.Lock()
+	defer server.sessionsL.Unlock()
+
+	if server.sessions == nil {
+		server.sessions = map[string]map[string]bool{}
+	}
+
+	open := server.sessions[userID]
+	if open[sessionID] {
+		return nil
+	}
+
+	if len(open) >= server.MaxSessions {
+		return fmt.Errorf("%w: %d of %d open", ErrTooManySessions, len(open), server.MaxSessions)
+	}
+
+	if open == nil {
+		open = map[string]bool{}
+		server.sessions[userID] = open
+	}
+
+	open[sessionID] = true
+
+	go func() {
+		<-ctx.Done()
+
+		server.sessionsL.Lock()
+		delete(open, sessionID)
+		if len(open) == 0 {
+			delete(server.sessions, userID)
+		}
+		server.sessionsL.Unlock()
+	}()
+
+	return nil
+}
+
+// AllowUser checks that the user is on the allowlist, either by login or as
+// a member of an allowed org. Everyone is allowed if the allowlist is empty.
+//
+// Org rules only admit GitHub users; users from an authorized_keys file must
+// be allowed by login.
+func (server *Server) AllowUser(ctx context.Context, id Identity) error {
+	if len(server.AllowedUsers) == 0 {
+		return nil
+	}
+
+	for _, allowed := range server.AllowedUsers {
+		kind, org, isOrg := strings.Cut(allowed, ":")
+		if !isOrg {
+			if strings.EqualFold(allowed, id.Login) {
+				return nil
+			}
+
+			continue
+		}
+
+		if kind != pool.OrgScopeKind {
+			return fmt.Errorf("invalid allowed user %q; expected LOGIN or %s:NAME", allowed, pool.OrgScopeKind)
+		}
+
+		if !isGitHubUser(id.ID) {
+			// the login may belong to someone else on GitHub
+			continue
+		}
+
+		if server.Transport == nil {
+			return fmt.Errorf("allowing orgs requires a GitHub app")
+		}
+
+		member, err := server.Access.IsOrgMember(ctx, org, id.Login)
+		if err != nil {
+			return err
+		}
+
+		if member {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrUserNotAllowed, id.Login)
+}
+
+// admitRuntime checks that the user may forward another runtime.
+//
+// Runtimes are counted from the runtimes table so that the limit holds across
+// every node. The runtime must already be registered so that concurrent
+// registrations see each other; if there's no room for it, the caller should
+// delete it.
+func (server *Server) admitRuntime(ctx context.Context, runtime *models.Runtime) error {
+	if server.MaxSessions <= 0 {
+		return nil
+	}
+
+	rts, err := models.RuntimesByUserID(ctx, server.DB, runtime.UserID)
+	if err != nil {
+		return fmt.Errorf("get runtimes: %w", err)
+	}
+
+	ahead := runtimesAhead(rts, runtime, time.Now())
+	if ahead >= server.MaxSessions {
+		return fmt.Errorf("%w: %d of %d open", ErrTooManySessions, ahead, server.MaxSessions)
+	}
+
+	return nil
+}
+
+// runtimesAhead counts the live runtimes which connected before the given
+// runtime. When a user goes over their limit, the runtimes which connected
+// first keep their place, so racing registrations can't both be admitted.
+func runtimesAhead(rts []*models.Runtime, runtime *models.Runtime, now time.Time) int {
+	var ahead int
+	for _, rt := range rts {
+		if rt.Name == runtime.Name {
+			continue
+		}
+
+		if rt.ExpiresAt.Time().Before(now) {
+			// stale; waiting to be reaped
+			continue
+		}
+
+		if connectedBefore(rt, runtime) {
+			ahead++
+		}
+	}
+
+	return ahead
+}
+
+func connectedBefore(a, b *models.Runtime) bool {
+	var at, bt time.Time
+	if a.ConnectedAt != nil {
+		at = a.ConnectedAt.Time()
+	}
+	if b.ConnectedAt != nil {
+		bt = b.ConnectedAt.Time()
+	}
+
+	if at.Equal(bt) {
+		return a.Name < b.Name
+	}
+
+	return at.Before(bt)
+}
+
+// allowForward checks that the session may forward another service with the
+// given name.
+//
+// The runtime service is always allowed, since it's the reason runners
+// connect in the first place.
+func (h *ForwardHandler) allowForward(sessionID, svcName string) error {
+	if len(h.AllowedServices) > 0 && svcName != runtimes.RuntimeServiceName {
+		var allowed bool
+		for _, name := range h.AllowedServices {
+			if name == svcName {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return fmt.Errorf("%w: %s", ErrServiceNotAllowed, svcName)
+		}
+	}
+
+	if h.MaxServices <= 0 {
+		return nil
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	var forwarded int
+	for id := range h.forwards {
+		if strings.HasPrefix(id, sessionID+":") {
+			forwarded++
+		}
+	}
+
+	if forwarded >= h.MaxServices {
+		return fmt.Errorf("%w: %d of %d forwarded", ErrTooManyServices, forwarded, h.MaxServices)
+	}
+
+	return nil
+}
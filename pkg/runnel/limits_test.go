@@ -0,0 +1,179 @@
+package runnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass/pkg/runtimes"
+	"github.com/vito/is"
+)
+
+func TestAllowUser(t *testing.T) {
+	ctx := context.Background()
+
+	gitHubUser := Identity{ID: "MDQ6VXNlcjE=", Login: "alice"}
+	keysUser := Identity{ID: AuthorizedKeysIDPrefix + "alice", Login: "alice"}
+
+	allow := func(allowed ...string) *Server {
+		return &Server{AllowedUsers: allowed}
+	}
+
+	t.Run("empty allowlist", func(t *testing.T) {
+		is := is.New(t)
+		is.NoErr(allow().AllowUser(ctx, gitHubUser))
+	})
+
+	t.Run("allowed by login", func(t *testing.T) {
+		is := is.New(t)
+		is.NoErr(allow("bob", "alice").AllowUser(ctx, gitHubUser))
+		is.NoErr(allow("Alice").AllowUser(ctx, gitHubUser)) // logins are case-insensitive
+		is.NoErr(allow("alice").AllowUser(ctx, keysUser))
+	})
+
+	t.Run("not on the allowlist", func(t *testing.T) {
+		is := is.New(t)
+		err := allow("bob").AllowUser(ctx, gitHubUser)
+		is.True(errors.Is(err, ErrUserNotAllowed))
+	})
+
+	t.Run("org rules", func(t *testing.T) {
+		is := is.New(t)
+
+		err := allow("org:acme").AllowUser(ctx, keysUser)
+		is.True(errors.Is(err, ErrUserNotAllowed)) // authorized keys users aren't org members
+
+		err = allow("org:acme").AllowUser(ctx, gitHubUser)
+		is.True(err != nil)                         // needs a GitHub app
+		is.True(!errors.Is(err, ErrUserNotAllowed)) // misconfigured, not rejected
+
+		is.NoErr(allow("alice", "org:acme").AllowUser(ctx, gitHubUser)) // login matched before org rules
+	})
+
+	t.Run("unknown rule kind", func(t *testing.T) {
+		is := is.New(t)
+		err := allow("repo:acme/widgets").AllowUser(ctx, gitHubUser)
+		is.True(err != nil)
+		is.True(!errors.Is(err, ErrUserNotAllowed)) // misconfigured, not rejected
+	})
+}
+
+func TestRuntimesAhead(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	runtime := func(name string, connectedAgo time.Duration, expiresIn time.Duration) *models.Runtime {
+		connectedAt := models.NewTime(now.Add(-connectedAgo))
+		return &models.Runtime{
+			Name:        name,
+			ConnectedAt: &connectedAt,
+			ExpiresAt:   models.NewTime(now.Add(expiresIn)),
+		}
+	}
+
+	self := runtime("b", time.Minute, time.Hour)
+
+	is.Equal(runtimesAhead([]*models.Runtime{self}, self, now), 0) // only this runtime
+
+	is.Equal(runtimesAhead([]*models.Runtime{
+		runtime("x", time.Hour, time.Hour),
+		runtime("y", 2*time.Minute, time.Hour),
+		self,
+	}, self, now), 2) // connected earlier
+
+	is.Equal(runtimesAhead([]*models.Runtime{
+		self,
+		runtime("x", time.Second, time.Hour),
+	}, self, now), 0) // connected later
+
+	is.Equal(runtimesAhead([]*models.Runtime{
+		runtime("a", time.Minute, time.Hour),
+		self,
+		runtime("c", time.Minute, time.Hour),
+	}, self, now), 1) // connected at the same time; ties go by name
+
+	is.Equal(runtimesAhead([]*models.Runtime{
+		runtime("x", 2*time.Hour, -time.Minute),
+		self,
+	}, self, now), 0) // expired
+
+	is.Equal(runtimesAhead([]*models.Runtime{
+		{Name: "x", ExpiresAt: models.NewTime(now.Add(time.Hour))},
+		self,
+	}, self, now), 1) // never connected
+}
+
+func TestAdmitSession(t *testing.T) {
+	is := is.New(t)
+
+	server := &Server{
+		MaxSessions: 2,
+	}
+
+	ctx := context.Background()
+
+	first, closeFirst := context.WithCancel(ctx)
+	defer closeFirst()
+
+	is.NoErr(server.admitSession(first, "alice", "session-1"))
+	is.NoErr(server.admitSession(first, "alice", "session-1")) // authenticating again
+
+	second, closeSecond := context.WithCancel(ctx)
+	defer closeSecond()
+
+	is.NoErr(server.admitSession(second, "alice", "session-2"))
+
+	err := server.admitSession(ctx, "alice", "session-3")
+	is.True(errors.Is(err, ErrTooManySessions))
+
+	is.NoErr(server.admitSession(ctx, "bob", "session-4")) // other users have their own limit
+
+	closeFirst()
+
+	is.Eventually(func() bool {
+		return server.admitSession(ctx, "alice", "session-5") == nil
+	}, time.Second, 10*time.Millisecond) // a closed session frees a slot
+}
+
+func TestAllowForward(t *testing.T) {
+	handler := func(max int, allowed []string, forwarded ...string) *ForwardHandler {
+		h := &ForwardHandler{
+			MaxServices:     max,
+			AllowedServices: allowed,
+			forwards:        map[string]net.Listener{},
+		}
+
+		// IDs of the services already forwarded, as SESSION:SERVICE
+		for _, id := range forwarded {
+			h.forwards[id] = nil
+		}
+
+		return h
+	}
+
+	t.Run("allowed services", func(t *testing.T) {
+		is := is.New(t)
+
+		is.NoErr(handler(0, nil).allowForward("session", "buildkit")) // no limits
+		is.NoErr(handler(0, []string{"buildkit"}).allowForward("session", "buildkit"))
+		is.NoErr(handler(0, []string{"buildkit"}).allowForward("session", runtimes.RuntimeServiceName)) // always allowed
+
+		err := handler(0, []string{"buildkit"}).allowForward("session", "docker")
+		is.True(errors.Is(err, ErrServiceNotAllowed))
+	})
+
+	t.Run("max services", func(t *testing.T) {
+		is := is.New(t)
+
+		is.NoErr(handler(2, nil, "session:runtime").allowForward("session", "buildkit"))
+
+		err := handler(2, nil, "session:runtime", "session:buildkit").allowForward("session", "docker")
+		is.True(errors.Is(err, ErrTooManyServices))
+
+		is.NoErr(handler(1, nil, "other:runtime", "other:buildkit").allowForward("session", "runtime")) // other sessions don't count
+	})
+}
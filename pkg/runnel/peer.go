@@ -0,0 +1,90 @@
+package runnel
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// PeerHandshakeTimeout is how long a connection to a forwarded TCP service has
+// to authenticate.
+const PeerHandshakeTimeout = 10 * time.Second
+
+// size of the challenge sent to connections to forwarded TCP services
+const peerNonceSize = 32
+
+// acceptPeer authenticates a connection to a forwarded TCP service by sending
+// it a random challenge which it must answer with an HMAC of the challenge
+// keyed by the token shared between nodes.
+//
+// The token itself is never sent over the connection.
+func acceptPeer(conn net.Conn, token string) error {
+	if err := conn.SetDeadline(time.Now().Add(PeerHandshakeTimeout)); err != nil {
+		return err
+	}
+
+	nonce := make([]byte, peerNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generate challenge: %w", err)
+	}
+
+	if _, err := conn.Write(nonce); err != nil {
+		return fmt.Errorf("send challenge: %w", err)
+	}
+
+	answer := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, answer); err != nil {
+		return fmt.Errorf("read answer: %w", err)
+	}
+
+	if !hmac.Equal(answer, peerAnswer(token, nonce)) {
+		return fmt.Errorf("peer token mismatch")
+	}
+
+	return conn.SetDeadline(time.Time{})
+}
+
+// dialPeer connects to a forwarded TCP service, answering its challenge with
+// the token shared between nodes.
+func dialPeer(ctx context.Context, addr, token string) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := answerPeer(conn, token); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("authenticate to %s: %w", addr, err)
+	}
+
+	return conn, nil
+}
+
+func answerPeer(conn net.Conn, token string) error {
+	if err := conn.SetDeadline(time.Now().Add(PeerHandshakeTimeout)); err != nil {
+		return err
+	}
+
+	nonce := make([]byte, peerNonceSize)
+	if _, err := io.ReadFull(conn, nonce); err != nil {
+		return fmt.Errorf("read challenge: %w", err)
+	}
+
+	if _, err := conn.Write(peerAnswer(token, nonce)); err != nil {
+		return fmt.Errorf("send answer: %w", err)
+	}
+
+	return conn.SetDeadline(time.Time{})
+}
+
+func peerAnswer(token string, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
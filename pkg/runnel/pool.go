@@ -0,0 +1,136 @@
+package runnel
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/pool"
+	"github.com/vito/bass-loop/pkg/runs"
+	"github.com/vito/bass/pkg/bass"
+	"github.com/vito/bass/pkg/proto"
+	"github.com/vito/bass/pkg/runtimes"
+	"github.com/vito/bass/pkg/zapctx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// LoadPool dials the forwarded runtime service of each runtime and returns
+// them as a pool.
+//
+// Connections to runtimes forwarded over TCP authenticate with the peer token.
+//
+// The policy decides between runtimes which can run the same platform.
+//
+// Runtimes which haven't forwarded their service yet, which can't be reached
+// from this node, or which fail a health probe are left out. Runtimes are
+// probed concurrently, so one that doesn't respond only delays loading by
+// ProbeTimeout.
+func LoadPool(ctx context.Context, db models.DB, node, peerToken string, policy pool.Policy, active *runs.Active, rts []*models.Runtime) (*pool.Pool, error) {
+	logger := zapctx.FromContext(ctx)
+
+	runtimePool := &pool.Pool{
+		Policy: policy,
+	}
+
+	var dialed []*models.Runtime
+	var conns []*grpc.ClientConn
+
+	closeAll := func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+
+	for _, rt := range rts {
+		svc, err := models.ServiceByUserIDRuntimeNameService(ctx, db, rt.UserID, rt.Name, runtimes.RuntimeServiceName)
+		if errors.Is(err, sql.ErrNoRows) {
+			// registered, but not forwarded yet
+			logger.Warn("runtime service not forwarded", zap.String("runtime", rt.Name))
+			continue
+		} else if err != nil {
+			logger.Error("failed to get service", zap.Error(err))
+			closeAll()
+			return nil, fmt.Errorf("get runtime service: %w", err)
+		}
+
+		if svc.Node != node && strings.HasPrefix(svc.Addr, "unix:") {
+			// node-local socket on a peer that isn't configured with a peer address
+			logger.Warn("runtime unreachable from this node",
+				zap.String("runtime", rt.Name),
+				zap.String("node", svc.Node))
+			continue
+		}
+
+		conn, err := Dial(svc, peerToken)
+		if err != nil {
+			logger.Error("grpc dial failed", zap.Error(err))
+			closeAll()
+			return nil, err
+		}
+
+		dialed = append(dialed, rt)
+		conns = append(conns, conn)
+	}
+
+	probeErrs := make([]error, len(conns))
+
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *grpc.ClientConn) {
+			defer wg.Done()
+			probeErrs[i] = Probe(ctx, conn)
+		}(i, conn)
+	}
+	wg.Wait()
+
+	for i, rt := range dialed {
+		conn, probeErr := conns[i], probeErrs[i]
+
+		if err := rt.RecordHealth(ctx, db, probeErr); err != nil {
+			logger.Error("failed to record runtime health", zap.Error(err))
+		}
+
+		if probeErr != nil {
+			logger.Warn("runtime unhealthy",
+				zap.String("runtime", rt.Name),
+				zap.Error(probeErr))
+			conn.Close()
+			continue
+		}
+
+		labels, err := rt.LabelSet()
+		if err != nil {
+			logger.Error("failed to get labels", zap.Error(err))
+			for _, conn := range conns[i:] {
+				conn.Close()
+			}
+			runtimePool.Close()
+			return nil, err
+		}
+
+		runtimePool.Runtimes = append(runtimePool.Runtimes, pool.Runtime{
+			UserID:   rt.UserID,
+			Name:     rt.Name,
+			Priority: rt.Priority,
+			Platform: bass.Platform{
+				OS:           rt.Os,
+				Architecture: rt.Arch,
+			},
+			Labels: labels,
+			Active: active,
+			DB:     db,
+			Runtime: &runtimes.Client{
+				Conn:          conn,
+				RuntimeClient: proto.NewRuntimeClient(conn),
+			},
+		})
+	}
+
+	return runtimePool, nil
+}
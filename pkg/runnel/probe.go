@@ -0,0 +1,39 @@
+package runnel
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// ProbeTimeout is how long a runtime has to respond to a health probe.
+const ProbeTimeout = 5 * time.Second
+
+// Probe checks that a forwarded runtime is responding.
+//
+// Runtimes aren't required to implement the gRPC health service, so an
+// Unimplemented response is still taken as a sign of life.
+func Probe(ctx context.Context, conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(ctx, ProbeTimeout)
+	defer cancel()
+
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("probe runtime: %w", err)
+	}
+
+	if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("probe runtime: %s", res.GetStatus())
+	}
+
+	return nil
+}
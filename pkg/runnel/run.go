@@ -0,0 +1,216 @@
+package runnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gliderlabs/ssh"
+	"github.com/google/go-github/v43/github"
+	"github.com/opencontainers/go-digest"
+	flag "github.com/spf13/pflag"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/pool"
+	"github.com/vito/bass-loop/pkg/runs"
+	"github.com/vito/bass/pkg/bass"
+	"github.com/vito/bass/pkg/cli"
+	"github.com/vito/bass/pkg/ioctx"
+	"github.com/vito/bass/pkg/zapctx"
+	"github.com/vito/progrock"
+	"go.uber.org/zap"
+)
+
+const RunCommandName = "run"
+
+// HandleRunCommand runs a thunk read from stdin as JSON on the user's own
+// runtimes, streaming its output back over the session.
+//
+// The run is recorded like any other, so it can be shared by its URL.
+func (server *Server) HandleRunCommand(s ssh.Session, flags *flag.FlagSet, args []string) {
+	logger := bass.LoggerTo(s.Stderr(), zap.DebugLevel).With(zap.String("side", "server"))
+
+	if err := flags.Parse(args); err != nil {
+		logger.Error("failed to parse flags", zap.Error(err))
+		s.Exit(2)
+		return
+	}
+
+	userID, ok := sessionUserID(s)
+	if !ok {
+		logger.Error("user id not found in context")
+		s.Exit(1)
+		return
+	}
+
+	payload, err := io.ReadAll(s)
+	if err != nil {
+		logger.Error("failed to read thunk", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	var thunk bass.Thunk
+	if err := bass.UnmarshalJSON(payload, &thunk); err != nil {
+		logger.Error("failed to unmarshal thunk", zap.Error(err))
+		s.Exit(2)
+		return
+	}
+
+	// each concurrent Bass must have its own trace
+	ctx := bass.WithTrace(s.Context(), &bass.Trace{})
+	ctx = zapctx.ToContext(ctx, zapctx.FromContext(server.ctx))
+
+	userRts, err := models.RuntimesByUserID(ctx, server.DB, userID)
+	if err != nil {
+		logger.Error("failed to get runtimes", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	rts := []*models.Runtime{}
+	for _, rt := range userRts {
+		if rt.Scope == "" {
+			rts = append(rts, rt)
+		}
+	}
+
+	userPool, err := LoadPool(ctx, server.DB, server.Node, server.PeerToken, server.Policy, server.Active, rts)
+	if err != nil {
+		logger.Error("failed to load runtimes", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+	defer userPool.Close()
+
+	required, err := pool.RequiredLabels(thunk)
+	if err != nil {
+		logger.Error("failed to get required labels", zap.Error(err))
+		s.Exit(2)
+		return
+	}
+
+	runtimePool := userPool.Filter(required)
+	if !runtimePool.CanRun(thunk) {
+		fmt.Fprintln(s.Stderr(), "no runner available; start one with `bass --runner` and try again")
+		s.Exit(1)
+		return
+	}
+
+	ctx = bass.WithRuntimePool(ctx, runtimePool)
+
+	user := &github.User{
+		NodeID: github.String(userID),
+		Login:  github.String(s.User()),
+	}
+
+	run, err := models.CreateThunkRun(ctx, server.DB, user, thunk, models.Meta{
+		"ssh": models.Meta{
+			"command": RunCommandName,
+			"node":    server.Node,
+		},
+	})
+	if err != nil {
+		logger.Error("failed to create run", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	fmt.Fprintf(s.Stderr(), "run: %s\n", server.runURL(run))
+
+	tape := progrock.NewTape()
+	stream := server.Streams.Start(run.ID, server.Redactor.Redaction(run.ID))
+	defer stream.Close()
+
+	runCtx, untrack := server.Active.Track(ctx, run.ID)
+	defer untrack()
+
+	recorder := progrock.NewRecorder(progrock.MultiWriter{tape, stream, &sessionWriter{w: s}})
+	runCtx = progrock.RecorderToContext(runCtx, recorder)
+
+	metaVtx := recorder.Vertex(digest.Digest("run:"+run.ID), "[run] "+thunk.Cmdline())
+	stderr := metaVtx.Stderr()
+	runCtx = ioctx.StderrToContext(runCtx, stderr)
+	runCtx = zapctx.ToContext(runCtx, bass.LoggerTo(stderr, zap.DebugLevel))
+
+	runErr := thunk.Run(runCtx)
+	if runErr != nil {
+		cli.WriteError(runCtx, runErr)
+	}
+
+	metaVtx.Done(runErr)
+
+	if runErr != nil && runCtx.Err() != nil {
+		run.Cancelled = 1
+	}
+
+	// record the run even if the client has disconnected, which cancels the
+	// session's context
+	recordCtx := zapctx.ToContext(context.Background(), zapctx.FromContext(ctx))
+
+	if err := runs.Record(recordCtx, server.DB, server.Blobs, server.Redactor, run, tape, runErr == nil); err != nil {
+		logger.Error("failed to complete run", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	fmt.Fprintf(s.Stderr(), "%s: %s\n", runStatus(run), server.runURL(run))
+
+	if runErr != nil {
+		s.Exit(1)
+		return
+	}
+
+	s.Exit(0)
+}
+
+func (server *Server) runURL(run *models.Run) string {
+	return server.ExternalURL + "/runs/" + run.ID
+}
+
+// sessionWriter writes each vertex's name and output to an SSH session as it
+// runs.
+type sessionWriter struct {
+	w io.Writer
+
+	started   map[string]bool
+	completed map[string]bool
+	l         sync.Mutex
+}
+
+func (sw *sessionWriter) WriteStatus(status *progrock.StatusUpdate) error {
+	sw.l.Lock()
+	defer sw.l.Unlock()
+
+	if sw.started == nil {
+		sw.started = map[string]bool{}
+		sw.completed = map[string]bool{}
+	}
+
+	for _, vtx := range status.Vertexes {
+		if vtx.Started != nil && !sw.started[vtx.Id] {
+			sw.started[vtx.Id] = true
+			fmt.Fprintf(sw.w, "\x1b[1m=> %s\x1b[0m\n", vtx.Name)
+		}
+
+		if vtx.Completed != nil && !sw.completed[vtx.Id] {
+			sw.completed[vtx.Id] = true
+
+			if vtx.Error != nil {
+				fmt.Fprintf(sw.w, "\x1b[31m=> %s: %s\x1b[0m\n", vtx.Name, vtx.GetError())
+			}
+		}
+	}
+
+	for _, log := range status.Logs {
+		if _, err := sw.w.Write(log.Data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sw *sessionWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package runnel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vito/bass-loop/pkg/pool"
+)
+
+// VerifyScope checks that the user may share a runtime with the scope, i.e.
+// that they are a member of the org or a collaborator on the repo.
+//
+// Membership is checked through the GitHub app's installation on the org or
+// repo, so the app must be installed there. Users from an authorized_keys
+// file can't share runtimes, since their logins may belong to someone else
+// on GitHub.
+func (server *Server) VerifyScope(ctx context.Context, id Identity, scope string) error {
+	kind, name, err := pool.ParseScope(scope)
+	if err != nil {
+		return err
+	}
+
+	if !isGitHubUser(id.ID) {
+		return fmt.Errorf("sharing runtimes requires a GitHub user")
+	}
+
+	login := id.Login
+
+	if server.Transport == nil {
+		return fmt.Errorf("sharing runtimes requires a GitHub app")
+	}
+
+	switch kind {
+	case pool.OrgScopeKind:
+		member, err := server.Access.IsOrgMember(ctx, name, login)
+		if err != nil {
+			return err
+		}
+
+		if !member {
+			return fmt.Errorf("%s is not a member of org %s, or the app is not installed there", login, name)
+		}
+	case pool.RepoScopeKind:
+		collaborator, err := server.Access.IsCollaborator(ctx, name, login)
+		if err != nil {
+			return err
+		}
+
+		if !collaborator {
+			return fmt.Errorf("%s is not a collaborator on repo %s, or the app is not installed there", login, name)
+		}
+	}
+
+	return nil
+}
@@ -3,15 +3,24 @@ package runnel
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/gliderlabs/ssh"
 	"github.com/google/go-github/v43/github"
 	flag "github.com/spf13/pflag"
+	"github.com/vito/bass-loop/pkg/access"
 	"github.com/vito/bass-loop/pkg/blobs"
 	"github.com/vito/bass-loop/pkg/cfg"
+	"github.com/vito/bass-loop/pkg/ghapp"
 	"github.com/vito/bass-loop/pkg/logs"
 	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass-loop/pkg/pool"
+	"github.com/vito/bass-loop/pkg/queue"
+	"github.com/vito/bass-loop/pkg/runs"
 	"github.com/vito/bass/pkg/bass"
 	"github.com/vito/bass/pkg/zapctx"
 	"go.uber.org/zap"
@@ -24,8 +33,49 @@ type Server struct {
 	HostKeyPath    string
 	HostKeyContent string
 
-	DB    models.DB
-	Blobs *blobs.Bucket
+	// name of this node; runtimes and services registered through this node
+	// are owned by it
+	Node string
+
+	// peer-reachable address for forwarded services
+	PeerAddr string
+
+	// token authenticating connections to services forwarded over TCP
+	PeerToken string
+
+	DB        *models.Conn
+	Blobs     *blobs.Bucket
+	Transport *ghapp.Transport
+
+	// deliveries waiting for a runtime are woken up when one is registered
+	Queue *queue.Queue
+
+	// for runs started over SSH
+	Streams  *runs.Streams
+	Active   *runs.Active
+	Redactor *runs.Redactor
+	Policy   pool.Policy
+
+	// decides who may read the logs of runs, and checks org membership and
+	// repo collaborators for allowing users and sharing runtimes
+	Access *access.Checker
+
+	// base URL for linking to runs
+	ExternalURL string
+
+	// see cfg.RunnelConfig
+	AuthorizedKeysPath   string
+	KeyCacheTTL          time.Duration
+	KeyMaxStale          time.Duration
+	GitHubInstallationID int64
+	AllowedUsers         []string
+	MaxSessions          int
+	MaxServices          int
+	AllowedServices      []string
+
+	// user ID => session ID => open, for limiting connections per user
+	sessions  map[string]map[string]bool
+	sessionsL sync.Mutex
 
 	ctx context.Context
 	wg  *errgroup.Group
@@ -33,25 +83,66 @@ type Server struct {
 
 const DefaultAddr = "0.0.0.0:6455"
 
-func Listen(config *cfg.Config, logger *logs.Logger, db *models.Conn, bucket *blobs.Bucket) *Server {
+const DefaultExternalURL = "http://localhost:3000"
+
+func Listen(config *cfg.Config, logger *logs.Logger, db *models.Conn, bucket *blobs.Bucket, transport *ghapp.Transport, queue *queue.Queue, streams *runs.Streams, active *runs.Active, redactor *runs.Redactor, checker *access.Checker) (*Server, error) {
+	policy, err := pool.ParsePolicy(config.RuntimePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.SSH.PeerAddr != "" && config.SSH.PeerToken == "" {
+		return nil, fmt.Errorf("SSH_PEER_TOKEN must be set along with SSH_PEER_ADDR")
+	}
+
 	addr := config.SSH.Addr
 	if addr == "" {
 		addr = DefaultAddr
 	}
 
+	externalURL := config.ExternalURL
+	if externalURL == "" {
+		externalURL = DefaultExternalURL
+	}
+
 	srv := &Server{
 		Addr:           addr,
 		HostKeyPath:    config.SSH.HostKeyPath,
 		HostKeyContent: config.SSH.HostKeyContent,
 
-		DB:    db,
-		Blobs: bucket,
+		Node:      config.SSH.Node(),
+		PeerAddr:  config.SSH.PeerAddr,
+		PeerToken: config.SSH.PeerToken,
+
+		DB:        db,
+		Blobs:     bucket,
+		Transport: transport,
+		Queue:     queue,
+
+		Streams:  streams,
+		Active:   active,
+		Redactor: redactor,
+		Policy:   policy,
+
+		Access: checker,
+
+		ExternalURL: strings.TrimSuffix(externalURL, "/"),
+
+		AuthorizedKeysPath:   config.SSH.AuthorizedKeysPath,
+		KeyCacheTTL:          config.SSH.KeyCacheTTL,
+		KeyMaxStale:          config.SSH.KeyMaxStale,
+		GitHubInstallationID: config.SSH.GitHubInstallationID,
+		AllowedUsers:         config.SSH.AllowedUsers,
+		MaxSessions:          config.SSH.MaxSessions,
+		MaxServices:          config.SSH.MaxServices,
+		AllowedServices:      config.SSH.AllowedServices,
 
 		ctx: zapctx.ToContext(context.Background(), logger),
 		wg:  new(errgroup.Group),
 	}
 
 	srv.wg.Go(srv.ListenAndServe)
+	srv.wg.Go(srv.Reap)
 
 	go func() {
 		err := srv.wg.Wait()
@@ -60,7 +151,7 @@ func Listen(config *cfg.Config, logger *logs.Logger, db *models.Conn, bucket *bl
 		}
 	}()
 
-	return srv
+	return srv, nil
 }
 
 const (
@@ -69,8 +160,10 @@ const (
 )
 
 type Command struct {
-	Command  string
-	Callback func(ssh.Session, *flag.FlagSet, []string)
+	Command     string
+	Usage       string
+	Description string
+	Callback    func(ssh.Session, *flag.FlagSet, []string)
 }
 
 func (server *Server) ListenAndServe() error {
@@ -78,12 +171,7 @@ func (server *Server) ListenAndServe() error {
 
 	logger := zapctx.FromContext(ctx)
 
-	commands := []Command{
-		{
-			Command:  "forward",
-			Callback: server.HandleForwardCommand,
-		},
-	}
+	commands := server.commands()
 
 	ssh.Handle(func(s ssh.Session) {
 		logger.Info("handling ssh session",
@@ -109,13 +197,16 @@ func (server *Server) ListenAndServe() error {
 
 		fmt.Fprintf(s, "unknown command: %q\n", cmd)
 		fmt.Fprintf(s, "known commands: %q\n", knownCommands)
+		fmt.Fprintf(s, "run %q for usage\n", HelpCommandName)
 		s.Exit(2)
 	})
 
 	opts := []ssh.Option{
-		ssh.PublicKeyAuth(GitHubAuthenticator{
+		ssh.PublicKeyAuth(Authenticator{
 			Logger: logger,
-			Client: github.NewClient(nil),
+			DB:     server.DB,
+			Keys:   server.keyProvider(),
+			Admit:  server.Admit,
 		}.Auth),
 	}
 
@@ -125,14 +216,16 @@ func (server *Server) ListenAndServe() error {
 		opts = append(opts, ssh.HostKeyPEM([]byte(server.HostKeyContent)))
 	}
 
-	forwardHandler := NewForwardHandler(ctx, server.DB)
+	forwardHandler := NewForwardHandler(ctx, server.DB, server.Node, server.PeerAddr, server.PeerToken)
+	forwardHandler.MaxServices = server.MaxServices
+	forwardHandler.AllowedServices = server.AllowedServices
 
 	sshServer := &ssh.Server{
 		Addr: server.Addr,
 
 		RequestHandlers: map[string]ssh.RequestHandler{
-			// "tcpip-forward":        forwardHandler.HandleSSHRequest,
-			// "cancel-tcpip-forward": forwardHandler.HandleSSHRequest,
+			TCPForwardRequestType:               forwardHandler.HandleTCPForward,
+			CancelTCPForwardRequestType:         forwardHandler.HandleCancelTCPForward,
 			StreamlocalForwardChannelType:       forwardHandler.HandleStreamlocalForward,
 			CancelStreamlocalForwardChannelType: forwardHandler.HandleCancelStreamlocalForward,
 
@@ -152,17 +245,20 @@ func (server *Server) ListenAndServe() error {
 		sshServer.SetOption(opt)
 	}
 
-	if _, err := server.DB.ExecContext(context.Background(), `DELETE FROM runtimes`); err != nil {
+	// clean up after any sessions from a previous run of this node; rows owned
+	// by other nodes may still be in use
+	if _, err := server.DB.ExecContext(context.Background(), `DELETE FROM runtimes WHERE node = $1`, server.Node); err != nil {
 		return fmt.Errorf("clean up runtimes: %w", err)
 	}
 
-	if _, err := server.DB.ExecContext(context.Background(), `DELETE FROM services`); err != nil {
+	if _, err := server.DB.ExecContext(context.Background(), `DELETE FROM services WHERE node = $1`, server.Node); err != nil {
 		return fmt.Errorf("clean up services: %w", err)
 	}
 
 	logger.Info("listening",
 		zap.String("protocol", "ssh"),
-		zap.String("addr", server.Addr))
+		zap.String("addr", server.Addr),
+		zap.String("node", server.Node))
 
 	go func() {
 		<-server.ctx.Done()
@@ -173,6 +269,102 @@ func (server *Server) ListenAndServe() error {
 	return sshServer.ListenAndServe()
 }
 
+// how often to look for runtimes whose heartbeat has stopped
+const reapInterval = time.Minute
+
+// Reap periodically deletes expired runtimes and their services.
+//
+// Runtimes are normally deleted when their session ends, but a node that goes
+// away without cleaning up leaves its rows behind. Any node may reap them.
+func (server *Server) Reap() error {
+	ctx := server.ctx
+
+	logger := zapctx.FromContext(ctx)
+
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := server.reapExpired(ctx); err != nil {
+				logger.Error("failed to reap runtimes", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (server *Server) reapExpired(ctx context.Context) error {
+	logger := zapctx.FromContext(ctx)
+
+	expired, err := models.GetExpiredRuntimesResults(ctx, server.DB, models.NewTime(time.Now().UTC()))
+	if err != nil {
+		return fmt.Errorf("get expired runtimes: %w", err)
+	}
+
+	for _, rt := range expired {
+		if _, err := server.DB.ExecContext(ctx, `DELETE FROM services WHERE user_id = $1 AND runtime_name = $2`, rt.UserID, rt.Name); err != nil {
+			return fmt.Errorf("delete services: %w", err)
+		}
+
+		if _, err := server.DB.ExecContext(ctx, `DELETE FROM runtimes WHERE user_id = $1 AND name = $2`, rt.UserID, rt.Name); err != nil {
+			return fmt.Errorf("delete runtime: %w", err)
+		}
+
+		logger.Info("reaped expired runtime",
+			zap.String("user", rt.UserID),
+			zap.String("runtime", rt.Name))
+	}
+
+	return nil
+}
+
+// keyProvider returns the provider of users' keys, per the config.
+//
+// Keys from GitHub are cached. An authorized_keys file is always read as-is,
+// so that removing a key from it takes effect right away.
+func (server *Server) keyProvider() KeyProvider {
+	if server.AuthorizedKeysPath != "" {
+		return AuthorizedKeysFile{
+			Path: server.AuthorizedKeysPath,
+		}
+	}
+
+	var provider KeyProvider
+	if server.GitHubInstallationID != 0 && server.Transport != nil {
+		provider = GitHubKeys{
+			Client: github.NewClient(&http.Client{
+				Transport: ghinstallation.NewFromAppsTransport(server.Transport, server.GitHubInstallationID),
+			}),
+		}
+	} else {
+		provider = GitHubKeys{
+			Client: github.NewClient(nil),
+		}
+	}
+
+	ttl := server.KeyCacheTTL
+	if ttl < 0 {
+		return provider
+	} else if ttl == 0 {
+		ttl = DefaultKeyCacheTTL
+	}
+
+	maxStale := server.KeyMaxStale
+	if maxStale == 0 {
+		maxStale = DefaultKeyMaxStale
+	}
+
+	return CachedKeys{
+		DB:          server.DB,
+		TTL:         ttl,
+		MaxStale:    maxStale,
+		KeyProvider: provider,
+	}
+}
+
 func (server *Server) Wait() error {
 	return server.wg.Wait()
 }
@@ -180,19 +372,13 @@ func (server *Server) Wait() error {
 func (server *Server) HandleForwardCommand(s ssh.Session, flags *flag.FlagSet, args []string) {
 	logger := bass.LoggerTo(s, zap.DebugLevel).With(zap.String("side", "server"))
 
-	var priority int
-	flags.IntVarP(&priority, "priority", "p", 0, "priority")
+	var rf runnerFlags
+	rf.register(flags)
 
 	var os, arch string
 	flags.StringVar(&os, "os", "linux", "runtime platform OS (ie. GOOS)")
 	flags.StringVar(&arch, "arch", "amd64", "runtime platform architecture (i.e. GOARCH)")
 
-	if err := flags.Parse(args); err != nil {
-		logger.Error("failed to parse flags", zap.Error(err))
-		s.Exit(2)
-		return
-	}
-
 	userIDVal := s.Context().Value(userIdKey{})
 	if userIDVal == nil {
 		logger.Error("user id not found in context")
@@ -202,6 +388,24 @@ func (server *Server) HandleForwardCommand(s ssh.Session, flags *flag.FlagSet, a
 
 	userID := userIDVal.(string)
 
+	configured, err := server.configuredArgs(s, userID)
+	if err != nil {
+		logger.Error("failed to get runner settings", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	// flags passed to the command are parsed last so that they take precedence
+	if err := flags.Parse(append(configured, args...)); err != nil {
+		logger.Error("failed to parse flags", zap.Error(err))
+		s.Exit(2)
+		return
+	}
+
+	priority, labels, scope := rf.priority, rf.labels, rf.scope
+
+	now := models.NewTime(time.Now().UTC())
+
 	runtime := models.Runtime{
 		UserID:    userID,
 		Name:      s.Context().SessionID(),
@@ -209,6 +413,29 @@ func (server *Server) HandleForwardCommand(s ssh.Session, flags *flag.FlagSet, a
 		Os:        os,
 		Arch:      arch,
 		ExpiresAt: models.NewTime(time.Now().Add(time.Hour).UTC()),
+		Node:      server.Node,
+		Healthy:   1,
+
+		ConnectedAt: &now,
+		HeartbeatAt: &now,
+	}
+
+	if err := runtime.SetLabels(labels); err != nil {
+		logger.Error("failed to set labels", zap.Error(err))
+		s.Exit(1)
+		return
+	}
+
+	if scope != "" {
+		if err := server.VerifyScope(s.Context(), Identity{ID: userID, Login: s.User()}, scope); err != nil {
+			logger.Error("cannot share runtime", zap.String("scope", scope), zap.Error(err))
+			s.Exit(1)
+			return
+		}
+
+		// already validated by VerifyScope
+		kind, name, _ := pool.ParseScope(scope)
+		runtime.Scope = kind + ":" + name
 	}
 
 	if err := runtime.Insert(s.Context(), server.DB); err != nil {
@@ -217,7 +444,24 @@ func (server *Server) HandleForwardCommand(s ssh.Session, flags *flag.FlagSet, a
 		return
 	}
 
-	logger.Info("registered")
+	if err := server.admitRuntime(s.Context(), &runtime); err != nil {
+		logger.Error("rejecting runtime", zap.Error(err))
+
+		if err := runtime.Delete(context.Background(), server.DB); err != nil {
+			logger.Error("failed to delete runtime", zap.Error(err))
+		}
+
+		s.Exit(1)
+		return
+	}
+
+	logger.Info("registered",
+		zap.Stringer("labels", models.Labels(labels)),
+		zap.String("scope", runtime.Scope))
+
+	if err := server.Queue.Wake(s.Context()); err != nil {
+		logger.Warn("failed to wake deliveries", zap.Error(err))
+	}
 
 	heartbeat := time.NewTicker(time.Minute)
 	defer heartbeat.Stop()
@@ -235,9 +479,7 @@ func (server *Server) HandleForwardCommand(s ssh.Session, flags *flag.FlagSet, a
 			s.Exit(0)
 			return
 		case <-heartbeat.C:
-			runtime.ExpiresAt = models.NewTime(time.Now().Add(time.Hour).UTC())
-
-			if err := runtime.Update(s.Context(), server.DB); err != nil {
+			if err := runtime.Heartbeat(s.Context(), server.DB, time.Now().Add(time.Hour)); err != nil {
 				logger.Error("failed to heartbeat runtime", zap.Error(err))
 				s.Exit(1)
 				return
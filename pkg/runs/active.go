@@ -0,0 +1,116 @@
+package runs
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Active tracks the cancel funcs of in-flight runs so that they can be
+// cancelled by ID, along with the runtimes they're using.
+type Active struct {
+	cancels map[string]context.CancelFunc
+
+	// runtime name => run ID => number of thunks running
+	using map[string]map[string]int
+
+	l sync.Mutex
+}
+
+func NewActive() *Active {
+	return &Active{
+		cancels: map[string]context.CancelFunc{},
+		using:   map[string]map[string]int{},
+	}
+}
+
+type runIDKey struct{}
+
+// RunIDFromContext returns the ID of the run tracked by the context.
+func RunIDFromContext(ctx context.Context) (string, bool) {
+	runID, ok := ctx.Value(runIDKey{}).(string)
+	return runID, ok
+}
+
+// Track returns a context which is cancelled when the run is cancelled.
+//
+// The returned func must be called once the run is done.
+func (active *Active) Track(ctx context.Context, runID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	ctx = context.WithValue(ctx, runIDKey{}, runID)
+
+	active.l.Lock()
+	active.cancels[runID] = cancel
+	active.l.Unlock()
+
+	return ctx, func() {
+		active.l.Lock()
+		delete(active.cancels, runID)
+		active.l.Unlock()
+
+		cancel()
+	}
+}
+
+// Cancel cancels an in-flight run, returning false if it is not in flight.
+func (active *Active) Cancel(runID string) bool {
+	active.l.Lock()
+	cancel, found := active.cancels[runID]
+	active.l.Unlock()
+
+	if !found {
+		return false
+	}
+
+	cancel()
+
+	return true
+}
+
+// Use records that the context's run is using the named runtime.
+//
+// The returned func must be called once the runtime is no longer in use.
+func (active *Active) Use(ctx context.Context, runtimeName string) func() {
+	runID, ok := RunIDFromContext(ctx)
+	if !ok {
+		return func() {}
+	}
+
+	active.l.Lock()
+	runs, found := active.using[runtimeName]
+	if !found {
+		runs = map[string]int{}
+		active.using[runtimeName] = runs
+	}
+	runs[runID]++
+	active.l.Unlock()
+
+	return func() {
+		active.l.Lock()
+		runs[runID]--
+		if runs[runID] == 0 {
+			delete(runs, runID)
+		}
+		if len(runs) == 0 {
+			delete(active.using, runtimeName)
+		}
+		active.l.Unlock()
+	}
+}
+
+// Using returns the IDs of the runs using the named runtime.
+//
+// Only runs in flight on this node are known.
+func (active *Active) Using(runtimeName string) []string {
+	active.l.Lock()
+	defer active.l.Unlock()
+
+	var runIDs []string
+	for runID := range active.using[runtimeName] {
+		runIDs = append(runIDs, runID)
+	}
+
+	sort.Strings(runIDs)
+
+	return runIDs
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"strings"
 	"time"
 
 	"github.com/aoldershaw/ansi"
@@ -18,7 +19,9 @@ import (
 	"go.uber.org/zap"
 )
 
-func Record(ctx context.Context, db models.DB, bucket *blobs.Bucket, run *models.Run, tape *progrock.Tape, ok bool) error {
+// Record stores the logs of each of the run's vertices, scrubbed of secrets,
+// and completes the run.
+func Record(ctx context.Context, db models.DB, bucket *blobs.Bucket, redactor *Redactor, run *models.Run, tape *progrock.Tape, ok bool) error {
 	logger := zapctx.FromContext(ctx)
 
 	completedAt := models.NewTime(time.Now().UTC())
@@ -32,58 +35,42 @@ func Record(ctx context.Context, db models.DB, bucket *blobs.Bucket, run *models
 		run.Succeeded = sql.NullInt64{Int64: 0, Valid: true}
 	}
 
-	err := tape.EachVertex(func(v *progrock.Vertex, l *ui.Vterm) error {
-		var startTime, endTime models.Time
-		if v.Started != nil {
-			startTime = models.NewTime(v.Started.AsTime().UTC())
-		}
-		if v.Completed != nil {
-			endTime = models.NewTime(v.Completed.AsTime().UTC())
-		}
-
-		var vErr sql.NullString
-		if v.Error != nil {
-			vErr.String = v.GetError()
-			vErr.Valid = true
-		}
-
-		var cached int
-		if v.Cached {
-			cached = 1
-		}
+	redaction := redactor.Run(run)
 
-		vtx := &models.Vertex{
-			Digest:    v.Id,
-			RunID:     run.ID,
-			Name:      v.Name,
-			StartTime: &startTime,
-			EndTime:   &endTime,
-			Error:     vErr,
-			Cached:    cached,
-		}
+	err := tape.EachVertex(func(v *progrock.Vertex, l *ui.Vterm) error {
+		vtx := VertexModel(run.ID, v, redaction)
 
-		htmlBuf := new(bytes.Buffer)
 		if l.UsedHeight() > 0 {
-			logs := l.Bytes(0, l.UsedHeight())
+			logs, redacted := redaction.Redact(l.Bytes(0, l.UsedHeight()))
+			if redacted {
+				logger.Warn("redacted secrets from logs",
+					zap.String("run", run.ID),
+					zap.String("vertex", v.Id))
+
+				run.Redacted = 1
+			}
 
 			if err := bucket.WriteAll(ctx, blobs.VertexRawLogKey(vtx), logs, nil); err != nil {
 				return fmt.Errorf("store raw logs: %w", err)
 			}
 
-			var lines ansi.Lines
-			writer := ansi.NewWriter(&lines,
-				// arbitrary, matched my screen
-				ansi.WithInitialScreenSize(67, 316))
-			if _, err := writer.Write(logs); err != nil {
-				return fmt.Errorf("write log: %w", err)
+			html, err := RenderHTML(logs)
+			if err != nil {
+				return err
 			}
 
-			if err := ANSIHTML.Execute(htmlBuf, lines); err != nil {
-				return fmt.Errorf("render html: %w", err)
+			if err := bucket.WriteAll(ctx, blobs.VertexHTMLLogKey(vtx), html, nil); err != nil {
+				return fmt.Errorf("store html logs: %w", err)
 			}
 
-			if err := bucket.WriteAll(ctx, blobs.VertexHTMLLogKey(vtx), htmlBuf.Bytes(), nil); err != nil {
-				return fmt.Errorf("store html logs: %w", err)
+			text, err := PlainText(logs)
+			if err != nil {
+				return err
+			}
+
+			if err := models.IndexVertexLog(ctx, db, run.ID, vtx.Digest, text); err != nil {
+				// logs can still be viewed, just not found by searching
+				logger.Warn("failed to index logs", zap.Error(err))
 			}
 		}
 
@@ -128,6 +115,89 @@ func Record(ctx context.Context, db models.DB, bucket *blobs.Bucket, run *models
 	return nil
 }
 
+// VertexModel converts a progrock vertex into a vertex belonging to the run,
+// scrubbing secrets from its name and error.
+func VertexModel(runID string, v *progrock.Vertex, redaction *Redaction) *models.Vertex {
+	var startTime, endTime models.Time
+	if v.Started != nil {
+		startTime = models.NewTime(v.Started.AsTime().UTC())
+	}
+	if v.Completed != nil {
+		endTime = models.NewTime(v.Completed.AsTime().UTC())
+	}
+
+	var vErr sql.NullString
+	if v.Error != nil {
+		vErr.String = redaction.RedactString(v.GetError())
+		vErr.Valid = true
+	}
+
+	var cached int
+	if v.Cached {
+		cached = 1
+	}
+
+	return &models.Vertex{
+		Digest:    v.Id,
+		RunID:     runID,
+		Name:      redaction.RedactString(v.Name),
+		StartTime: &startTime,
+		EndTime:   &endTime,
+		Error:     vErr,
+		Cached:    cached,
+	}
+}
+
+// RenderHTML renders raw terminal output as HTML using ANSIHTML.
+func RenderHTML(logs []byte) ([]byte, error) {
+	lines, err := parseLines(logs)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBuf := new(bytes.Buffer)
+	if err := ANSIHTML.Execute(htmlBuf, lines); err != nil {
+		return nil, fmt.Errorf("render html: %w", err)
+	}
+
+	// mark redactions so they stand out from the output around them
+	return bytes.ReplaceAll(htmlBuf.Bytes(), []byte(Redacted), redactedHTML), nil
+}
+
+// PlainText renders raw terminal output as plain text, stripping escape
+// sequences. Each line corresponds to a line rendered by RenderHTML.
+func PlainText(logs []byte) (string, error) {
+	lines, err := parseLines(logs)
+	if err != nil {
+		return "", err
+	}
+
+	text := new(strings.Builder)
+	for _, line := range lines {
+		for _, chunk := range line {
+			text.Write(chunk.Data)
+		}
+
+		text.WriteString("\n")
+	}
+
+	return text.String(), nil
+}
+
+func parseLines(logs []byte) (ansi.Lines, error) {
+	var lines ansi.Lines
+	writer := ansi.NewWriter(&lines,
+		// arbitrary, matched my screen
+		ansi.WithInitialScreenSize(67, 316))
+	if _, err := writer.Write(logs); err != nil {
+		return nil, fmt.Errorf("write log: %w", err)
+	}
+
+	return lines, nil
+}
+
+var redactedHTML = []byte(`<span class="redacted">` + Redacted + `</span>`)
+
 // TODO: support modifiers (bold/etc) - it's a bit tricky, may need changes
 // upstream
 var ANSIHTML = template.Must(template.New("ansi").Parse(`{{- range . -}}
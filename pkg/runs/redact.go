@@ -0,0 +1,256 @@
+package runs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/vito/bass-loop/pkg/cfg"
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/bass/pkg/bass"
+)
+
+// Redacted replaces each secret in stored logs.
+const Redacted = "[REDACTED]"
+
+// DefaultPatterns match well-known kinds of credentials.
+var DefaultPatterns = []string{
+	// GitHub tokens
+	`\bgh[pousr]_[A-Za-z0-9]{36,251}\b`,
+	`\bgithub_pat_[A-Za-z0-9_]{22,244}\b`,
+
+	// AWS access key IDs and secret access keys
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	`(?i)\baws_secret_access_key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}\b`,
+
+	// private key blocks, e.g. SSH and TLS keys
+	`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`,
+}
+
+// Redactor scrubs secrets from logs before they leave the process, whether
+// they're streamed live, reported to a forge, or stored.
+//
+// Logs are scrubbed of anything matching its patterns and of the values of the
+// secrets registered for the run.
+type Redactor struct {
+	// Patterns match secrets in the logs of every run.
+	Patterns []*regexp.Regexp
+
+	// run ID => values of the secrets registered for the run
+	values  map[string][][]byte
+	valuesL sync.Mutex
+}
+
+// NewRedactor returns a redactor using the default patterns along with any
+// patterns configured in REDACT_PATTERNS_PATH.
+func NewRedactor(config *cfg.Config) (*Redactor, error) {
+	patterns := DefaultPatterns
+
+	if config.Redact.PatternsPath != "" {
+		configured, err := readPatterns(config.Redact.PatternsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, configured...)
+	}
+
+	redactor := &Redactor{
+		values: map[string][][]byte{},
+	}
+
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact pattern %q: %w", pattern, err)
+		}
+
+		redactor.Patterns = append(redactor.Patterns, re)
+	}
+
+	return redactor, nil
+}
+
+// Register registers the values of the secrets in the thunk so that they're
+// redacted from the run's logs.
+//
+// The values are only held in memory until the run is recorded. Callers must
+// Forget them instead if the run will never be recorded.
+func (redactor *Redactor) Register(runID string, thunk bass.Thunk) {
+	values := secretValues(thunk)
+	if len(values) == 0 {
+		return
+	}
+
+	redactor.valuesL.Lock()
+	redactor.values[runID] = append(redactor.values[runID], values...)
+	redactor.valuesL.Unlock()
+}
+
+// Forget forgets the values registered for the run, e.g. when it fails
+// before it can be recorded.
+func (redactor *Redactor) Forget(runID string) {
+	redactor.valuesL.Lock()
+	delete(redactor.values, runID)
+	redactor.valuesL.Unlock()
+}
+
+// Redaction returns the redaction for the logs of a run that's still in
+// flight, using the values registered for the run so far.
+func (redactor *Redactor) Redaction(runID string) *Redaction {
+	redactor.valuesL.Lock()
+	values := append([][]byte(nil), redactor.values[runID]...)
+	redactor.valuesL.Unlock()
+
+	return &Redaction{
+		patterns: redactor.Patterns,
+		values:   values,
+	}
+}
+
+// Run returns the redaction for the run's logs, forgetting the values
+// registered for the run.
+func (redactor *Redactor) Run(run *models.Run) *Redaction {
+	redactor.valuesL.Lock()
+	values := redactor.values[run.ID]
+	delete(redactor.values, run.ID)
+	redactor.valuesL.Unlock()
+
+	return &Redaction{
+		patterns: redactor.Patterns,
+		values:   values,
+	}
+}
+
+// Redaction scrubs secrets from a run's logs.
+type Redaction struct {
+	patterns []*regexp.Regexp
+	values   [][]byte
+}
+
+// Redact returns the logs with any secrets replaced, and whether anything was
+// replaced.
+func (redaction *Redaction) Redact(logs []byte) ([]byte, bool) {
+	var redacted bool
+	for _, value := range redaction.values {
+		if bytes.Contains(logs, value) {
+			logs = bytes.ReplaceAll(logs, value, []byte(Redacted))
+			redacted = true
+		}
+	}
+
+	for _, re := range redaction.patterns {
+		if re.Match(logs) {
+			logs = re.ReplaceAllLiteral(logs, []byte(Redacted))
+			redacted = true
+		}
+	}
+
+	return logs, redacted
+}
+
+// RedactString returns the string with any secrets replaced.
+func (redaction *Redaction) RedactString(str string) string {
+	redacted, _ := redaction.Redact([]byte(str))
+	return string(redacted)
+}
+
+// readPatterns reads one pattern per line, skipping blank lines and lines
+// starting with #.
+func readPatterns(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read redact patterns: %w", err)
+	}
+
+	defer file.Close()
+
+	var patterns []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		patterns = append(patterns, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read redact patterns: %w", err)
+	}
+
+	return patterns, nil
+}
+
+// secretValues returns the values of the secrets in the thunk.
+func secretValues(thunk bass.Thunk) [][]byte {
+	var values [][]byte
+	walkSecrets(thunk, func(secret bass.Secret) {
+		if value := secret.Reveal(); len(value) > 0 {
+			values = append(values, value)
+		}
+	})
+
+	return values
+}
+
+func walkSecrets(val bass.Value, f func(bass.Secret)) {
+	switch x := val.(type) {
+	case bass.Secret:
+		f(x)
+	case bass.Thunk:
+		if x.Image != nil && x.Image.Thunk != nil {
+			walkSecrets(*x.Image.Thunk, f)
+		}
+
+		for _, arg := range x.Args {
+			walkSecrets(arg, f)
+		}
+
+		for _, in := range x.Stdin {
+			walkSecrets(in, f)
+		}
+
+		if x.Env != nil {
+			walkSecrets(x.Env, f)
+		}
+
+		if x.Dir != nil && x.Dir.ThunkDir != nil {
+			walkSecrets(*x.Dir.ThunkDir, f)
+		}
+
+		for _, mount := range x.Mounts {
+			if mount.Source.Secret != nil {
+				f(*mount.Source.Secret)
+			}
+
+			if mount.Source.ThunkPath != nil {
+				walkSecrets(*mount.Source.ThunkPath, f)
+			}
+		}
+	case bass.ThunkPath:
+		walkSecrets(x.Thunk, f)
+	case bass.ThunkAddr:
+		walkSecrets(x.Thunk, f)
+	case *bass.Scope:
+		_ = x.Each(func(_ bass.Symbol, v bass.Value) error {
+			walkSecrets(v, f)
+			return nil
+		})
+	case bass.List:
+		vals, err := bass.ToSlice(x)
+		if err != nil {
+			return
+		}
+
+		for _, v := range vals {
+			walkSecrets(v, f)
+		}
+	}
+}
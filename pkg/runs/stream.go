@@ -0,0 +1,287 @@
+package runs
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/vito/bass-loop/pkg/models"
+	"github.com/vito/progrock"
+	"github.com/vito/progrock/ui"
+)
+
+// Streams tracks the progress of runs that are still in flight so that they
+// can be followed live, before Record is called.
+type Streams struct {
+	streams map[string]*Stream
+	l       sync.Mutex
+}
+
+func NewStreams() *Streams {
+	return &Streams{
+		streams: map[string]*Stream{},
+	}
+}
+
+// Start begins streaming progress for the given run, scrubbing secrets with
+// the given redaction. The returned Stream should be written to alongside the
+// run's tape and closed once the run has been recorded.
+func (streams *Streams) Start(runID string, redaction *Redaction) *Stream {
+	stream := &Stream{
+		RunID: runID,
+
+		redaction: redaction,
+
+		vertexes: map[string]*progrock.Vertex{},
+		logs:     map[string]*ui.Vterm{},
+		subs:     map[*Subscription]struct{}{},
+		done:     make(chan struct{}),
+
+		streams: streams,
+	}
+
+	streams.l.Lock()
+	streams.streams[runID] = stream
+	streams.l.Unlock()
+
+	return stream
+}
+
+// Get returns the stream for an in-flight run.
+func (streams *Streams) Get(runID string) (*Stream, bool) {
+	streams.l.Lock()
+	defer streams.l.Unlock()
+	stream, found := streams.streams[runID]
+	return stream, found
+}
+
+func (streams *Streams) remove(stream *Stream) {
+	streams.l.Lock()
+	defer streams.l.Unlock()
+
+	if streams.streams[stream.RunID] == stream {
+		delete(streams.streams, stream.RunID)
+	}
+}
+
+// Stream is a progrock.Writer that fans out vertex updates to subscribers.
+type Stream struct {
+	RunID string
+
+	redaction *Redaction
+
+	order    []string
+	vertexes map[string]*progrock.Vertex
+	logs     map[string]*ui.Vterm
+	subs     map[*Subscription]struct{}
+	done     chan struct{}
+	closed   bool
+	l        sync.Mutex
+
+	streams *Streams
+}
+
+var _ progrock.Writer = &Stream{}
+
+// Update is the current state of a vertex in an in-flight run.
+type Update struct {
+	// Num is the vertex's position in the run, starting from 1.
+	Num int
+
+	Vertex *models.Vertex
+
+	// LogHTML is the vertex's log lines starting from LogOffset. Lines before
+	// it were sent in an earlier update and haven't changed.
+	LogHTML   []byte
+	LogOffset int
+}
+
+// WriteStatus implements progrock.Writer.
+func (stream *Stream) WriteStatus(status *progrock.StatusUpdate) error {
+	stream.l.Lock()
+	defer stream.l.Unlock()
+
+	changed := map[string]struct{}{}
+
+	for _, v := range status.Vertexes {
+		if v.Started == nil {
+			// skip pending vertexes, same as progrock.Tape
+			continue
+		}
+
+		existing, found := stream.vertexes[v.Id]
+		if !found {
+			stream.order = append(stream.order, v.Id)
+		} else if existing.Completed != nil && v.Cached {
+			// don't clobber the "real" vertex with a cache
+			continue
+		}
+
+		stream.vertexes[v.Id] = v
+		changed[v.Id] = struct{}{}
+	}
+
+	for _, l := range status.Logs {
+		term, found := stream.logs[l.Vertex]
+		if !found {
+			term = ui.NewVterm()
+			stream.logs[l.Vertex] = term
+		}
+
+		if _, err := term.Write(l.Data); err != nil {
+			return fmt.Errorf("write logs: %w", err)
+		}
+
+		changed[l.Vertex] = struct{}{}
+	}
+
+	if len(changed) == 0 {
+		return nil
+	}
+
+	for sub := range stream.subs {
+		sub.mark(changed)
+	}
+
+	return nil
+}
+
+// Close marks the stream as done, notifying all subscribers and removing it
+// from the set of in-flight runs.
+func (stream *Stream) Close() error {
+	stream.l.Lock()
+	if !stream.closed {
+		stream.closed = true
+		close(stream.done)
+	}
+	stream.l.Unlock()
+
+	stream.streams.remove(stream)
+
+	return nil
+}
+
+// Done is closed once the run has been recorded.
+func (stream *Stream) Done() <-chan struct{} {
+	return stream.done
+}
+
+// Subscribe returns a subscription which initially has every vertex seen so
+// far marked as changed.
+func (stream *Stream) Subscribe() *Subscription {
+	stream.l.Lock()
+	defer stream.l.Unlock()
+
+	sub := &Subscription{
+		stream:  stream,
+		changed: map[string]struct{}{},
+		sent:    map[string]int{},
+		notify:  make(chan struct{}, 1),
+	}
+
+	initial := map[string]struct{}{}
+	for _, id := range stream.order {
+		initial[id] = struct{}{}
+	}
+
+	sub.mark(initial)
+
+	stream.subs[sub] = struct{}{}
+
+	return sub
+}
+
+func (stream *Stream) unsubscribe(sub *Subscription) {
+	stream.l.Lock()
+	delete(stream.subs, sub)
+	stream.l.Unlock()
+}
+
+// Subscription tracks which vertexes have changed since they were last sent
+// to a subscriber.
+type Subscription struct {
+	stream *Stream
+
+	changed map[string]struct{}
+	notify  chan struct{}
+	l       sync.Mutex
+
+	// how many log lines have been sent for each vertex; only touched by Next
+	sent map[string]int
+}
+
+// Changed receives whenever there are new updates to collect via Next.
+func (sub *Subscription) Changed() <-chan struct{} {
+	return sub.notify
+}
+
+// Next returns updates for every vertex that has changed since the last call.
+//
+// Only the log lines written since the last call are rendered, along with the
+// last line sent before, which may have been written to since. Earlier lines
+// are assumed not to change, which holds for logs that don't move the cursor
+// back up.
+func (sub *Subscription) Next() ([]*Update, error) {
+	sub.l.Lock()
+	changed := sub.changed
+	sub.changed = map[string]struct{}{}
+	sub.l.Unlock()
+
+	stream := sub.stream
+	stream.l.Lock()
+	defer stream.l.Unlock()
+
+	var updates []*Update
+	for i, id := range stream.order {
+		if _, ok := changed[id]; !ok {
+			continue
+		}
+
+		update := &Update{
+			Num:    i + 1,
+			Vertex: VertexModel(stream.RunID, stream.vertexes[id], stream.redaction),
+		}
+
+		if term, found := stream.logs[id]; found && term.UsedHeight() > 0 {
+			used := term.UsedHeight()
+
+			offset := sub.sent[id] - 1
+			if offset < 0 {
+				offset = 0
+			}
+
+			logs, _ := stream.redaction.Redact(term.Bytes(offset, used-offset))
+
+			html, err := RenderHTML(logs)
+			if err != nil {
+				return nil, err
+			}
+
+			update.LogHTML = html
+			update.LogOffset = offset
+
+			sub.sent[id] = used
+		}
+
+		updates = append(updates, update)
+	}
+
+	return updates, nil
+}
+
+// Close stops receiving updates.
+func (sub *Subscription) Close() {
+	sub.stream.unsubscribe(sub)
+}
+
+func (sub *Subscription) mark(ids map[string]struct{}) {
+	sub.l.Lock()
+	for id := range ids {
+		sub.changed[id] = struct{}{}
+	}
+	sub.l.Unlock()
+
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,105 @@
+package runs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vito/progrock"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestSubscriptionNext(t *testing.T) {
+	stream := NewStreams().Start("some-run", &Redaction{})
+	defer stream.Close()
+
+	vertex := &progrock.Vertex{
+		Id:      "some-digest",
+		Name:    "some vertex",
+		Started: timestamppb.Now(),
+	}
+
+	write := func(logs string) {
+		t.Helper()
+
+		err := stream.WriteStatus(&progrock.StatusUpdate{
+			Vertexes: []*progrock.Vertex{vertex},
+			Logs: []*progrock.VertexLog{
+				{Vertex: vertex.Id, Data: []byte(logs)},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	next := func(sub *Subscription) *Update {
+		t.Helper()
+
+		updates, err := sub.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(updates) != 1 {
+			t.Fatalf("expected 1 update, got %d", len(updates))
+		}
+
+		return updates[0]
+	}
+
+	sub := stream.Subscribe()
+	defer sub.Close()
+
+	write("one\ntwo\n")
+
+	update := next(sub)
+	if update.LogOffset != 0 {
+		t.Errorf("expected the first update to start at line 0, got %d", update.LogOffset)
+	}
+
+	for _, line := range []string{"one", "two"} {
+		if !strings.Contains(string(update.LogHTML), line) {
+			t.Errorf("expected %q in logs, got %q", line, update.LogHTML)
+		}
+	}
+
+	write("thr")
+
+	update = next(sub)
+	if update.LogOffset != 1 {
+		t.Errorf("expected the last line sent to be sent again, got offset %d", update.LogOffset)
+	}
+
+	if strings.Contains(string(update.LogHTML), "one") {
+		t.Errorf("expected lines sent before not to be sent again, got %q", update.LogHTML)
+	}
+
+	write("ee\nfour\n")
+
+	update = next(sub)
+	if update.LogOffset != 2 {
+		t.Errorf("expected the incomplete line to be sent again, got offset %d", update.LogOffset)
+	}
+
+	for _, line := range []string{"three", "four"} {
+		if !strings.Contains(string(update.LogHTML), line) {
+			t.Errorf("expected %q in logs, got %q", line, update.LogHTML)
+		}
+	}
+
+	t.Run("new subscribers get every line", func(t *testing.T) {
+		late := stream.Subscribe()
+		defer late.Close()
+
+		update := next(late)
+		if update.LogOffset != 0 {
+			t.Errorf("expected the first update to start at line 0, got %d", update.LogOffset)
+		}
+
+		for _, line := range []string{"one", "two", "three", "four"} {
+			if !strings.Contains(string(update.LogHTML), line) {
+				t.Errorf("expected %q in logs, got %q", line, update.LogHTML)
+			}
+		}
+	})
+}
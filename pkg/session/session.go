@@ -0,0 +1,188 @@
+// Package session keeps track of users signed in to the web UI.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vito/bass-loop/pkg/models"
+)
+
+// CookieName is the name of the cookie holding the session token.
+const CookieName = "loop_session"
+
+// TTL is how long a session lasts before the user must sign in again.
+const TTL = 30 * 24 * time.Hour
+
+// Session is the session of the current request.
+type Session struct {
+	// User is the signed-in user, or nil if the request is anonymous.
+	User *models.User
+
+	model *models.Session
+}
+
+// Load loads the session for the request from its cookie.
+//
+// Requests without a valid session are anonymous.
+func Load(r *http.Request, db *models.Conn) (*Session, error) {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return &Session{}, nil
+	}
+
+	ctx := r.Context()
+
+	model, err := models.SessionByID(ctx, db, tokenID(cookie.Value))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &Session{}, nil
+		}
+
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+
+	if time.Now().After(model.ExpiresAt.Time()) {
+		if err := model.Delete(ctx, db); err != nil {
+			return nil, fmt.Errorf("delete expired session: %w", err)
+		}
+
+		return &Session{}, nil
+	}
+
+	user, err := model.User(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("get session user: %w", err)
+	}
+
+	return &Session{
+		User:  user,
+		model: model,
+	}, nil
+}
+
+// SignedIn returns true if the request has a signed-in user.
+func (session *Session) SignedIn() bool {
+	return session != nil && session.User != nil
+}
+
+// CSRFFormKey is the form field holding the CSRF token.
+const CSRFFormKey = "csrf_token"
+
+// CSRFToken returns the token that forms which change things on the user's
+// behalf must submit, so that other sites can't submit them. Anonymous
+// sessions have no token.
+//
+// The token is derived from the session's ID, which is only known to the
+// server, so it can't be forged without the session cookie.
+func (session *Session) CSRFToken() string {
+	if session == nil || session.model == nil {
+		return ""
+	}
+
+	return tokenID("csrf:" + session.model.ID)
+}
+
+// VerifyCSRF returns true if the request submitted the session's CSRF token.
+func (session *Session) VerifyCSRF(r *http.Request) bool {
+	expected := session.CSRFToken()
+	if expected == "" {
+		return false
+	}
+
+	given := r.PostFormValue(CSRFFormKey)
+
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// Start starts a session for the user, setting the session cookie on the
+// response.
+//
+// The user's expired sessions are cleaned up along the way.
+func Start(ctx context.Context, db *models.Conn, w http.ResponseWriter, user *models.User, secure bool) error {
+	existing, err := models.SessionsByUserID(ctx, db, user.ID)
+	if err != nil {
+		return fmt.Errorf("get sessions: %w", err)
+	}
+
+	now := time.Now().UTC()
+
+	for _, s := range existing {
+		if now.After(s.ExpiresAt.Time()) {
+			if err := s.Delete(ctx, db); err != nil {
+				return fmt.Errorf("delete expired session: %w", err)
+			}
+		}
+	}
+
+	token, err := RandomToken()
+	if err != nil {
+		return err
+	}
+
+	model := &models.Session{
+		ID:        tokenID(token),
+		UserID:    user.ID,
+		CreatedAt: models.NewTime(now),
+		ExpiresAt: models.NewTime(now.Add(TTL)),
+	}
+
+	if err := model.Insert(ctx, db); err != nil {
+		return fmt.Errorf("save session: %w", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  model.ExpiresAt.Time(),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+// End ends the session, if any, and clears the session cookie.
+func (session *Session) End(ctx context.Context, db *models.Conn, w http.ResponseWriter) error {
+	if session.model != nil {
+		if err := session.model.Delete(ctx, db); err != nil {
+			return fmt.Errorf("delete session: %w", err)
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	return nil
+}
+
+// RandomToken returns a random hex-encoded token.
+func RandomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// tokenID returns the ID under which the session for a token is stored.
+func tokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}